@@ -0,0 +1,19 @@
+package main
+
+import "time"
+
+// Clock tells the time. Reports that depend on the current date read it from
+// clock so tests can fix it.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the system clock
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// clock is the Clock used for the current time
+var clock Clock = realClock{}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// LocationConfig describes a parkrun location ahead of scraping it
+type LocationConfig struct {
+	Name string `json:"name"`
+	// ISO 3166-1 alpha-3 country code
+	Country    string  `json:"country"`
+	DistanceKm float64 `json:"distance_km"`
+	// parkrun site the location belongs to, e.g. parkrun.org.uk
+	Domain string `json:"domain"`
+	// Site the location's results are fetched from, e.g. a mirror. Defaults
+	// to the domain's site.
+	BaseURL string `json:"base_url"`
+}
+
+// defaultConfigPath is where the parse command looks for location config
+const defaultConfigPath = "locations.json"
+
+// locationConfigs holds per-location config keyed by slug, loaded at startup
+var locationConfigs = map[string]LocationConfig{}
+
+// LoadLocationConfigs reads location config from a JSON file keyed by slug.
+// A missing file is not an error and gives an empty config.
+func LoadLocationConfigs(path string) (map[string]LocationConfig, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]LocationConfig{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %v", err)
+	}
+
+	configs := make(map[string]LocationConfig)
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %v", path, err)
+	}
+	return configs, nil
+}
+
+// getLocationConfig returns the config for a location, with defaults filled in.
+// A country-qualified location like bushy:GBR uses config keyed by that, then
+// by its slug, and always takes the given country. Without a domain or base URL,
+// results come from the country's own parkrun site.
+func getLocationConfig(location string) LocationConfig {
+	slug, country := splitLocation(location)
+	config, ok := locationConfigs[location]
+	if !ok {
+		config = locationConfigs[slug]
+	}
+	if country != "" {
+		config.Country = country
+	}
+	if config.Country == "" {
+		config.Country = countryForDomain(config.Domain)
+	}
+	if config.Country == "" {
+		config.Country = "AUS"
+	}
+	if config.DistanceKm == 0 {
+		config.DistanceKm = 5
+	}
+	if config.Domain == "" {
+		config.Domain = domainForCountry(config.Country)
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = baseURLForDomain(config.Domain)
+	}
+	return config
+}
+
+// isCountryCode reports whether code looks like an ISO 3166-1 alpha-3 code,
+// i.e. three uppercase letters
+func isCountryCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// configuresSite reports whether a location's config says where its results
+// come from, rather than leaving it to the country
+func configuresSite(location string) bool {
+	slug, _ := splitLocation(location)
+	config, ok := locationConfigs[location]
+	if !ok {
+		config = locationConfigs[slug]
+	}
+	return config.Domain != "" || config.BaseURL != ""
+}
+
+// setLocationDomain points a location at a parkrun site, keeping the rest of
+// its config
+func setLocationDomain(location, domain string) {
+	slug, _ := splitLocation(location)
+	config, ok := locationConfigs[location]
+	if !ok {
+		config = locationConfigs[slug]
+	}
+	config.Domain = domain
+	config.BaseURL = ""
+	locationConfigs[location] = config
+}
+
+// LoadFlagConfig reads a JSON file of flag values keyed by flag name, e.g.
+// {"db": "data/parkrun.db", "rate-limit-backoff": "5m", "clear": true}
+func LoadFlagConfig(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading flag config: %v", err)
+	}
+
+	config := make(map[string]interface{})
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing flag config %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// applyFlagConfig sets flags from config on every flag set that defines them.
+// Flags already given on the command line are left alone, and flags parsed
+// afterwards override the config, so the precedence is defaults < config < flags.
+func applyFlagConfig(config map[string]interface{}, flagSets ...*flag.FlagSet) error {
+	for name, value := range config {
+		found := false
+		for _, fs := range flagSets {
+			if fs.Lookup(name) == nil {
+				continue
+			}
+			found = true
+			if isFlagSet(fs, name) {
+				continue
+			}
+			if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+				return fmt.Errorf("invalid value for %s in flag config: %v", name, err)
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown flag %q in flag config", name)
+		}
+	}
+	return nil
+}
+
+// isFlagSet reports whether a flag was given on the command line
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
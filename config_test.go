@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadLocationConfigs(t *testing.T) {
+	// A missing file gives an empty config
+	configs, err := LoadLocationConfigs(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("LoadLocationConfigs failed: %v", err)
+	}
+	if len(configs) != 0 {
+		t.Errorf("Expected no configs, got %v", configs)
+	}
+
+	path := filepath.Join(t.TempDir(), "locations.json")
+	err = os.WriteFile(path, []byte(`{not json`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadLocationConfigs(path); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+}
+
+func TestGetLocationConfigDefaults(t *testing.T) {
+	config := getLocationConfig("not-configured")
+	if config.Country != "AUS" || config.DistanceKm != 5 || config.BaseURL != resultsBaseURL {
+		t.Errorf("Expected AUS 5km defaults, got %+v", config)
+	}
+}
+
+func TestGetLocationConfigCountrySite(t *testing.T) {
+	tests := []struct {
+		location, want string
+	}{
+		{"bushy:GBR", "https://www.parkrun.org.uk"},
+		{"kensington:USA", "https://www.parkrun.us"},
+		{"somewhere:XYZ", resultsBaseURL},
+	}
+	for _, tt := range tests {
+		if got := getLocationConfig(tt.location).BaseURL; got != tt.want {
+			t.Errorf("getLocationConfig(%q).BaseURL = %q, want %q", tt.location, got, tt.want)
+		}
+	}
+}
+
+func TestScrapeUsesLocationConfig(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	server := newFakeParkrunServer(t, servePages(map[int]string{
+		1: fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30")),
+	}))
+	defer server.Close()
+
+	// Send the default site nowhere so results must come from the configured one
+	resultsBaseURL = "http://127.0.0.1:0"
+
+	path := filepath.Join(t.TempDir(), "locations.json")
+	err := os.WriteFile(path, []byte(`{
+		"test-park": {
+			"name": "Test Park",
+			"country": "GBR",
+			"distance_km": 2,
+			"base_url": "`+server.URL+`"
+		}
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldConfigs := locationConfigs
+	defer func() { locationConfigs = oldConfigs }()
+	locationConfigs, err = LoadLocationConfigs(path)
+	if err != nil {
+		t.Fatalf("LoadLocationConfigs failed: %v", err)
+	}
+
+	result, err := Scrape(db, "test-park", ScrapeOptions{})
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	if result.EventsStored != 1 {
+		t.Errorf("Expected 1 event stored from the configured site, got %d", result.EventsStored)
+	}
+
+	var location Location
+	err = db.QueryRow(`
+		SELECT name, country, distance_km 
+		FROM locations WHERE slug = 'test-park'`).Scan(&location.Name, &location.Country, &location.DistanceKm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Name != "Test Park" || location.Country != "GBR" || location.DistanceKm != 2 {
+		t.Errorf("Expected configured location to be stored, got %+v", location)
+	}
+}
+
+func TestApplyFlagConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "parkrun.json")
+	err := os.WriteFile(path, []byte(`{"db": "file.db", "rate-limit-backoff": "1m", "clear": true, "from": 12}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadFlagConfig(path)
+	if err != nil {
+		t.Fatalf("LoadFlagConfig failed: %v", err)
+	}
+
+	// Global flags are parsed before the config is applied
+	global := flag.NewFlagSet("parkrun", flag.ContinueOnError)
+	db := global.String("db", "./parkrun.db", "")
+	if err := global.Parse([]string{"--db", "cli.db"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Command flags are parsed after it
+	parse := flag.NewFlagSet("parse", flag.ContinueOnError)
+	clear := parse.Bool("clear", false, "")
+	from := parse.Int("from", 0, "")
+	backoff := parse.Duration("rate-limit-backoff", 3*time.Minute, "")
+
+	if err := applyFlagConfig(config, global, parse); err != nil {
+		t.Fatalf("applyFlagConfig failed: %v", err)
+	}
+	if err := parse.Parse([]string{"--from", "3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if *db != "cli.db" {
+		t.Errorf("Expected --db from the command line, got %q", *db)
+	}
+	if *from != 3 {
+		t.Errorf("Expected --from from the command line, got %d", *from)
+	}
+	if !*clear || *backoff != time.Minute {
+		t.Errorf("Expected clear and 1m backoff from the config, got %v and %v", *clear, *backoff)
+	}
+
+	if err := applyFlagConfig(map[string]interface{}{"no-such-flag": 1}, global, parse); err == nil {
+		t.Error("Expected an error for an unknown flag")
+	}
+	fresh := flag.NewFlagSet("parse", flag.ContinueOnError)
+	fresh.Int("from", 0, "")
+	if err := applyFlagConfig(map[string]interface{}{"from": "soon"}, fresh); err == nil {
+		t.Error("Expected an error for an invalid value")
+	}
+}
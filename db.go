@@ -1,103 +1,807 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
 )
 
-// CreateTables creates the necessary database tables if they don't exist
-func CreateTables(db *sql.DB) {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS locations (
+// locationsTableSQL creates the locations table under the given name. The same
+// slug can be used by parkruns in different countries.
+const locationsTableSQL = `CREATE TABLE IF NOT EXISTS %s (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			slug TEXT UNIQUE NOT NULL,
+			slug TEXT NOT NULL,
 			name TEXT,
-			country TEXT NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS events (
+			country TEXT NOT NULL,
+			distance_km REAL NOT NULL DEFAULT 5,
+			domain TEXT,
+			UNIQUE(slug, country)
+		)`
+
+// tableSchemas creates each table with the latest schema, in dependency order
+var tableSchemas = []struct {
+	name, sql string
+}{
+	{"locations", fmt.Sprintf(locationsTableSQL, "locations")},
+	{"events", `CREATE TABLE IF NOT EXISTS events (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			event_number INTEGER NOT NULL,
 			location_id INTEGER NOT NULL,
 			date DATE NOT NULL,
 			url TEXT NOT NULL,
+			excluded INTEGER NOT NULL DEFAULT 0,
+			results_hash TEXT,
+			event_note TEXT,
 			UNIQUE(event_number, location_id),
 			FOREIGN KEY (location_id) REFERENCES locations(id)
-		)`,
-		`CREATE TABLE IF NOT EXISTS results (
+		)`},
+	{"runners", `CREATE TABLE IF NOT EXISTS runners (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			athlete_id INTEGER NOT NULL UNIQUE,
+			name TEXT NOT NULL,
+			club TEXT,
+			last_seen DATE
+		)`},
+	{"results", `CREATE TABLE IF NOT EXISTS results (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			position INTEGER NOT NULL,
 			name TEXT NOT NULL,
 			time_seconds INTEGER,
+			time_raw TEXT,
 			age_grade TEXT,
 			age_category TEXT,
 			note TEXT,
 			total_runs INTEGER,
 			event_id INTEGER,
+			athlete_id INTEGER,
+			gender TEXT,
+			gender_position INTEGER,
+			location_runs INTEGER,
+			runner_id INTEGER,
+			club TEXT,
 			UNIQUE(position, event_id),
+			FOREIGN KEY (event_id) REFERENCES events(id),
+			FOREIGN KEY (runner_id) REFERENCES runners(id)
+		)`},
+	{"scrape_runs", `CREATE TABLE IF NOT EXISTS scrape_runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			location_id INTEGER NOT NULL,
+			started_at TIMESTAMP NOT NULL,
+			finished_at TIMESTAMP NOT NULL,
+			events_stored INTEGER NOT NULL,
+			results_stored INTEGER NOT NULL,
+			events_skipped INTEGER NOT NULL,
+			events_unchanged INTEGER NOT NULL,
+			errors INTEGER NOT NULL,
+			stop_reason TEXT NOT NULL,
+			FOREIGN KEY (location_id) REFERENCES locations(id)
+		)`},
+	{"leaderboard_cache", `CREATE TABLE IF NOT EXISTS leaderboard_cache (
+			location_id INTEGER NOT NULL,
+			board TEXT NOT NULL,
+			entries TEXT NOT NULL,
+			refreshed_at TIMESTAMP NOT NULL,
+			min_age_grade REAL NOT NULL DEFAULT 0,
+			PRIMARY KEY (location_id, board),
+			FOREIGN KEY (location_id) REFERENCES locations(id)
+		)`},
+	{"volunteers", `CREATE TABLE IF NOT EXISTS volunteers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			event_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			role TEXT NOT NULL DEFAULT '',
+			UNIQUE(event_id, name, role),
 			FOREIGN KEY (event_id) REFERENCES events(id)
-		)`,
+		)`},
+	{"aliases", `CREATE TABLE IF NOT EXISTS aliases (
+			location_id INTEGER NOT NULL,
+			alias TEXT NOT NULL,
+			canonical TEXT NOT NULL,
+			PRIMARY KEY (location_id, alias),
+			FOREIGN KEY (location_id) REFERENCES locations(id)
+		)`},
+}
+
+// How many times a write is tried while the database is locked, and the wait
+// before the first retry. The wait doubles after each retry.
+var (
+	busyAttempts  = 5
+	busyRetryWait = 50 * time.Millisecond
+)
+
+// withRetry runs a write, trying again with a growing wait while SQLite reports
+// the database busy or locked by another connection, e.g. a report running
+// alongside a scrape. fn must return the database error unwrapped or wrapped
+// with %w so it can be recognised.
+func withRetry(fn func() error) error {
+	wait := busyRetryWait
+	err := fn()
+	for attempt := 1; attempt < busyAttempts && isBusy(err); attempt++ {
+		log.Printf("Database is locked, retrying in %v", wait)
+		time.Sleep(wait)
+		wait *= 2
+		err = fn()
 	}
+	return err
+}
+
+// isBusy reports whether err is SQLite saying the database is busy or locked
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
 
-	for _, query := range queries {
-		_, err := db.Exec(query)
+// CreateTables creates the necessary database tables if they don't exist
+func CreateTables(db *sql.DB) {
+	for _, table := range tableSchemas {
+		err := withRetry(func() error {
+			_, err := db.Exec(table.sql)
+			return err
+		})
 		if err != nil {
 			log.Fatal("Failed to create table:", err)
 		}
 	}
+
+	// Columns added after the tables were first created
+	columns := []struct {
+		table, column, definition string
+	}{
+		{"locations", "distance_km", "REAL NOT NULL DEFAULT 5"},
+		{"locations", "domain", "TEXT"},
+		{"events", "excluded", "INTEGER NOT NULL DEFAULT 0"},
+		{"events", "results_hash", "TEXT"},
+		{"events", "event_note", "TEXT"},
+		{"results", "athlete_id", "INTEGER"},
+		{"results", "gender", "TEXT"},
+		{"results", "gender_position", "INTEGER"},
+		{"results", "location_runs", "INTEGER"},
+		{"results", "runner_id", "INTEGER REFERENCES runners(id)"},
+		{"results", "time_raw", "TEXT"},
+		{"results", "club", "TEXT"},
+		{"runners", "last_seen", "DATE"},
+		{"leaderboard_cache", "min_age_grade", "REAL NOT NULL DEFAULT 0"},
+	}
+	for _, c := range columns {
+		err := addColumnIfMissing(db, c.table, c.column, c.definition)
+		if err != nil {
+			log.Fatal("Failed to migrate table:", err)
+		}
+	}
+	if err := migrateLocationUniqueness(db); err != nil {
+		log.Fatal("Failed to migrate table:", err)
+	}
+	if err := migrateRunners(db); err != nil {
+		log.Fatal("Failed to migrate table:", err)
+	}
 	log.Printf("Database tables ready")
 }
 
-// StoreEvent stores an event in the database and returns its ID
+// migrateRunners fills the runners table from results stored before it
+// existed, or copied in by a rebuild, and links those results to it. Each
+// runner gets the name and club from their latest run. Results without an
+// athlete ID aren't linked to a runner.
+func migrateRunners(db *sql.DB) error {
+	var unlinked bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM results WHERE athlete_id > 0 AND runner_id IS NULL
+		)`).Scan(&unlinked)
+	if err != nil || !unlinked {
+		return err
+	}
+	log.Printf("Linking results to the runners table")
+
+	statements := []string{
+		// SQLite takes the name and club from the row with the MAX date
+		`INSERT OR IGNORE INTO runners (athlete_id, name, club, last_seen)
+			SELECT athlete_id, name, club, last_seen FROM (
+				SELECT r.athlete_id, r.name, r.club, date(MAX(e.date)) AS last_seen
+				FROM results r
+				JOIN events e ON r.event_id = e.id
+				WHERE r.athlete_id > 0
+				AND r.runner_id IS NULL
+				GROUP BY r.athlete_id
+			)`,
+		`UPDATE results SET runner_id = (
+				SELECT runners.id FROM runners WHERE runners.athlete_id = results.athlete_id
+			)
+			WHERE athlete_id > 0
+			AND runner_id IS NULL`,
+	}
+	err = withRetry(func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return fmt.Errorf("error migrating runners: %v", err)
+	}
+	return nil
+}
+
+// migrateLocationUniqueness rebuilds a locations table from an older version,
+// where slugs were unique on their own, so the same slug can exist in several
+// countries. SQLite can't drop a constraint, so the table is copied.
+func migrateLocationUniqueness(db *sql.DB) error {
+	slugUnique, err := hasUniqueIndexOn(db, "locations", "slug")
+	if err != nil || !slugUnique {
+		return err
+	}
+	log.Printf("Migrating locations to be unique by slug and country")
+
+	statements := []string{
+		fmt.Sprintf(locationsTableSQL, "locations_new"),
+		`INSERT INTO locations_new (id, slug, name, country, distance_km, domain)
+			SELECT id, slug, name, country, distance_km, domain FROM locations`,
+		`DROP TABLE locations`,
+		`ALTER TABLE locations_new RENAME TO locations`,
+	}
+	err = withRetry(func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return fmt.Errorf("error migrating locations: %v", err)
+	}
+	return nil
+}
+
+// RebuildDatabase recreates every table with the latest schema and copies the
+// data back from a backup taken first at backupPath. This covers schema changes
+// that ALTER TABLE can't make. The rebuild is one transaction, so if it fails
+// the database is left as it was.
+func RebuildDatabase(db *sql.DB, backupPath string) error {
+	if err := BackupDatabase(db, backupPath); err != nil {
+		return fmt.Errorf("not rebuilding without a backup: %v", err)
+	}
+
+	// An attached database is only visible on the connection that attached it
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting connection: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS backup`, backupPath); err != nil {
+		return fmt.Errorf("error attaching backup: %v", err)
+	}
+	defer conn.ExecContext(ctx, `DETACH DATABASE backup`)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	for i := len(tableSchemas) - 1; i >= 0; i-- {
+		if _, err := tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS main.%s", tableSchemas[i].name)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error dropping %s: %v", tableSchemas[i].name, err)
+		}
+	}
+	for _, table := range tableSchemas {
+		if _, err := tx.Exec(table.sql); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error creating %s: %v", table.name, err)
+		}
+	}
+
+	// Only columns in both the old and new tables are copied
+	for _, table := range tableSchemas {
+		oldColumns, err := tableColumns(tx, "backup", table.name)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		newColumns, err := tableColumns(tx, "main", table.name)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		var columns []string
+		for _, column := range newColumns {
+			for _, old := range oldColumns {
+				if column == old {
+					columns = append(columns, column)
+				}
+			}
+		}
+		if len(columns) == 0 {
+			// A table added since the backup's schema
+			continue
+		}
+
+		list := strings.Join(columns, ", ")
+		_, err = tx.Exec(fmt.Sprintf("INSERT INTO main.%s (%s) SELECT %s FROM backup.%s",
+			table.name, list, list, table.name))
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error copying %s: %v", table.name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// tableColumns returns the names of a table's columns in the given schema
+func tableColumns(tx *sql.Tx, schema, table string) ([]string, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA %s.table_info(%s)", schema, table))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s.%s columns: %v", schema, table, err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, fmt.Errorf("error scanning %s.%s columns: %v", schema, table, err)
+		}
+		columns = append(columns, name)
+	}
+	return columns, nil
+}
+
+// hasUniqueIndexOn reports whether a table has a unique index on exactly the given column
+func hasUniqueIndexOn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA index_list(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("error reading %s indexes: %v", table, err)
+	}
+	var uniqueIndexes []string
+	for rows.Next() {
+		var seq, unique, partial int
+		var name, origin string
+		if err := rows.Scan(&seq, &name, &unique, &origin, &partial); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("error scanning %s indexes: %v", table, err)
+		}
+		if unique == 1 {
+			uniqueIndexes = append(uniqueIndexes, name)
+		}
+	}
+	rows.Close()
+
+	for _, index := range uniqueIndexes {
+		var columns []string
+		infoRows, err := db.Query(fmt.Sprintf("PRAGMA index_info(%q)", index))
+		if err != nil {
+			return false, fmt.Errorf("error reading index %s: %v", index, err)
+		}
+		for infoRows.Next() {
+			var seqno, cid int
+			var name string
+			if err := infoRows.Scan(&seqno, &cid, &name); err != nil {
+				infoRows.Close()
+				return false, fmt.Errorf("error scanning index %s: %v", index, err)
+			}
+			columns = append(columns, name)
+		}
+		infoRows.Close()
+		if len(columns) == 1 && columns[0] == column {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// addColumnIfMissing adds a column to a table created by an older version
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("error reading %s columns: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("error scanning %s columns: %v", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	rows.Close()
+
+	err = withRetry(func() error {
+		_, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error adding %s.%s: %v", table, column, err)
+	}
+	return nil
+}
+
+// ErrImplausibleDate means an event's date is outside the range parkruns can
+// have been held in, usually because it was parsed wrongly
+var ErrImplausibleDate = errors.New("implausible event date")
+
+// checkEventDate returns ErrImplausibleDate if an event's date can't be right
+func checkEventDate(event Event) error {
+	if !isPlausibleEventDate(event.Date) {
+		return fmt.Errorf("%w: event %d dated %s", ErrImplausibleDate, event.EventNumber, event.Date.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// StoreEvent stores an event in the database and returns its ID. Events with
+// an implausible date are rejected.
 func StoreEvent(db *sql.DB, event Event) (int64, error) {
+	if err := checkEventDate(event); err != nil {
+		return 0, err
+	}
+
+	// Update in place on re-scrape so the event keeps its ID, note and excluded flag
 	query := `
-	INSERT OR REPLACE INTO events (
-		event_number, location_id, date, url
-	) VALUES (?, ?, ?, ?)`
+	INSERT INTO events (
+		event_number, location_id, date, url, results_hash
+	) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (event_number, location_id) DO UPDATE SET
+		date = excluded.date,
+		url = excluded.url,
+		results_hash = excluded.results_hash
+	RETURNING id`
 
-	result, err := db.Exec(query, event.EventNumber, event.LocationID, event.Date, event.URL)
+	var eventID int64
+	err := withRetry(func() error {
+		return db.QueryRow(query, event.EventNumber, event.LocationID, event.Date, event.URL, event.ResultsHash).Scan(&eventID)
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	return eventID, nil
+}
+
+// SetEventNote sets a free-text note on an event, e.g. "heatwave" or "course diverted".
+// An empty note removes it.
+func SetEventNote(db *sql.DB, urlSlug string, eventNumber int, note string) error {
+	var value interface{}
+	if note != "" {
+		value = note
+	}
+	locationID, err := getLocationID(db, urlSlug)
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec(`
+		UPDATE events SET event_note = ?
+		WHERE event_number = ?
+		AND location_id = ?`, value, eventNumber, locationID)
+	if err != nil {
+		return fmt.Errorf("error updating event: %v", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error updating event: %v", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("event %d %w for location '%s'", eventNumber, ErrNotFound, urlSlug)
+	}
+	return nil
+}
+
+// AddAliases records other spellings of a runner's name at a location, e.g.
+// "J SMITH" for "Jane SMITH", so reports count them as one runner when there's
+// no athlete ID to go on. Aliases already pointing at one of the other names
+// are moved to the canonical name so they never chain.
+func AddAliases(db *sql.DB, urlSlug string, canonical string, also []string) error {
+	locationID, err := getLocationID(db, urlSlug)
+	if err != nil {
+		return err
+	}
+
+	return withRetry(func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		// The canonical name can't itself be an alias
+		_, err = tx.Exec(`DELETE FROM aliases WHERE location_id = ? AND alias = ?`, locationID, canonical)
+		if err != nil {
+			return fmt.Errorf("error updating aliases: %w", err)
+		}
+		for _, alias := range also {
+			if alias == canonical {
+				continue
+			}
+			_, err = tx.Exec(`
+				INSERT INTO aliases (location_id, alias, canonical) VALUES (?, ?, ?)
+				ON CONFLICT (location_id, alias) DO UPDATE SET canonical = excluded.canonical`,
+				locationID, alias, canonical)
+			if err != nil {
+				return fmt.Errorf("error storing alias: %w", err)
+			}
+			_, err = tx.Exec(`
+				UPDATE aliases SET canonical = ?
+				WHERE location_id = ? AND canonical = ?`, canonical, locationID, alias)
+			if err != nil {
+				return fmt.Errorf("error updating aliases: %w", err)
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// GetEventNote returns an event's note, or "" if it has none
+func GetEventNote(db *sql.DB, urlSlug string, eventNumber int) (string, error) {
+	locationID, err := getLocationID(db, urlSlug)
+	if err != nil {
+		return "", err
+	}
+	var note sql.NullString
+	err = db.QueryRow(`
+		SELECT event_note
+		FROM events
+		WHERE location_id = ? AND event_number = ?`, locationID, eventNumber).Scan(&note)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("event %d %w for location '%s'", eventNumber, ErrNotFound, urlSlug)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error getting event note: %v", err)
+	}
+	return note.String, nil
+}
+
+// GetStoredEventHash returns the ID and results hash of an already stored event
+func GetStoredEventHash(db *sql.DB, locationID int, eventNumber int) (int64, string, bool, error) {
+	var eventID int64
+	var hash sql.NullString
+	err := db.QueryRow(`
+		SELECT id, results_hash 
+		FROM events 
+		WHERE location_id = ? AND event_number = ?`, locationID, eventNumber).Scan(&eventID, &hash)
+	if err == sql.ErrNoRows {
+		return 0, "", false, nil
+	}
+	if err != nil {
+		return 0, "", false, fmt.Errorf("error getting stored event: %v", err)
+	}
+	return eventID, hash.String, true, nil
 }
 
-// StoreResults stores multiple results in the database
-func StoreResults(db *sql.DB, results []Result, eventID int64) {
+// DeleteEventResults removes the stored results for an event so it can be re-stored
+func DeleteEventResults(db *sql.DB, eventID int64) error {
+	_, err := db.Exec(`DELETE FROM results WHERE event_id = ?`, eventID)
+	if err != nil {
+		return fmt.Errorf("error deleting results: %v", err)
+	}
+	return nil
+}
+
+// StoreVolunteers replaces the volunteers stored for an event and sets each
+// volunteer's EventID
+func StoreVolunteers(db *sql.DB, volunteers []Volunteer, eventID int64) error {
+	for i := range volunteers {
+		volunteers[i].EventID = eventID
+	}
+	return withRetry(func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		_, err = tx.Exec(`DELETE FROM volunteers WHERE event_id = ?`, eventID)
+		if err != nil {
+			return fmt.Errorf("error deleting volunteers: %w", err)
+		}
+		for _, volunteer := range volunteers {
+			_, err = tx.Exec(`
+				INSERT OR IGNORE INTO volunteers (event_id, name, role) 
+				VALUES (?, ?, ?)`, volunteer.EventID, volunteer.Name, volunteer.Role)
+			if err != nil {
+				return fmt.Errorf("error storing volunteer: %w", err)
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// hashResults returns a hash of an event's results and volunteers that changes
+// if any stored field changes
+func hashResults(results []Result, volunteers []Volunteer) string {
+	h := sha256.New()
+	for _, v := range volunteers {
+		fmt.Fprintf(h, "volunteer|%s|%s\n", v.Name, v.Role)
+	}
+	for _, r := range results {
+		fmt.Fprintf(h, "%d|%s|%s|%d|%s|%s|%s|%t|%d|%d|%s|%d|%s\n",
+			r.Position, r.Name, r.Time, r.TimeSeconds, r.AgeGrade, r.AgeCategory, r.Note, r.NoteMissing,
+			r.TotalRuns, r.AthleteID, r.Gender, r.GenderPosition, r.Club)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// StoreResults stores multiple results in the database and returns how many
+// were stored. Each runner with an athlete ID is added to the runners table,
+// or has their name and club updated there if this is their latest event, and
+// their result is linked to it, all in one transaction. The time text, as
+// trimmed by extractTime, is kept in time_raw, NULL if there wasn't one, so a
+// missing time can be told apart from one that couldn't be read. Runners
+// without a club have an empty club, and the note is NULL when the page had no
+// achievement data for the result.
+func StoreResults(db *sql.DB, results []Result, eventID int64) int {
 	query := `
 	INSERT OR REPLACE INTO results (
-		position, name, time_seconds, age_grade, age_category, note, total_runs, event_id
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		position, name, time_seconds, time_raw, age_grade, age_category, note, total_runs, event_id, athlete_id,
+		gender, gender_position, runner_id, club
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	seenAthletes := make(map[int]int)
+	for _, result := range results {
+		if result.AthleteID <= 0 {
+			continue
+		}
+		if position, ok := seenAthletes[result.AthleteID]; ok {
+			log.Printf("Warning: athlete %d appears at positions %d and %d", result.AthleteID, position, result.Position)
+		}
+		seenAthletes[result.AthleteID] = result.Position
+	}
 
 	successCount := 0
 	errorCount := 0
 
-	for _, result := range results {
-		var timeSeconds *int
-		if result.TimeSeconds > 0 {
-			timeSeconds = &result.TimeSeconds
-		}
-		result.EventID = eventID
-		_, err := db.Exec(query,
-			result.Position,
-			result.Name,
-			timeSeconds,
-			result.AgeGrade,
-			result.AgeCategory,
-			result.Note,
-			result.TotalRuns,
-			result.EventID,
-		)
+	// A busy database rolls back the whole transaction to be retried, while
+	// any other error only skips that result
+	err := withRetry(func() error {
+		successCount, errorCount = 0, 0
+		tx, err := db.Begin()
 		if err != nil {
-			log.Printf("Error storing result for position %d: %v", result.Position, err)
-			errorCount++
-			continue
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		for _, result := range results {
+			var timeSeconds *int
+			if result.TimeSeconds > 0 {
+				timeSeconds = &result.TimeSeconds
+			}
+			var timeRaw *string
+			if result.Time != "" {
+				timeRaw = &result.Time
+			}
+			var note *string
+			if !result.NoteMissing {
+				note = &result.Note
+			}
+			var genderPosition *int
+			if result.GenderPosition > 0 {
+				genderPosition = &result.GenderPosition
+			}
+			var athleteID *int
+			var runnerID *int64
+			if result.AthleteID > 0 {
+				athleteID = &result.AthleteID
+				id, err := storeRunner(tx, result, eventID)
+				if isBusy(err) {
+					return err
+				}
+				if err != nil {
+					log.Printf("Error storing runner for position %d: %v", result.Position, err)
+					errorCount++
+					continue
+				}
+				runnerID = &id
+			}
+			result.EventID = eventID
+			_, err := tx.Exec(query,
+				result.Position,
+				result.Name,
+				timeSeconds,
+				timeRaw,
+				result.AgeGrade,
+				result.AgeCategory,
+				note,
+				result.TotalRuns,
+				result.EventID,
+				athleteID,
+				result.Gender,
+				genderPosition,
+				runnerID,
+				result.Club,
+			)
+			if isBusy(err) {
+				return err
+			}
+			if err != nil {
+				log.Printf("Error storing result for position %d: %v", result.Position, err)
+				errorCount++
+				continue
+			}
+			successCount++
 		}
-		successCount++
+		return tx.Commit()
+	})
+	if err != nil {
+		log.Printf("Error storing results: %v", err)
+		return 0
 	}
 
 	log.Printf("Database storage complete: %d successful, %d failed", successCount, errorCount)
+	return successCount
+}
+
+// storeRunner adds a result's runner to the runners table and returns their
+// runner ID. A runner already there only has their name and club updated when
+// the event is at least as recent as the last one they were seen at, so a
+// backfill or an out-of-order store doesn't bring back an old name or club.
+func storeRunner(tx *sql.Tx, result Result, eventID int64) (int64, error) {
+	var runnerID int64
+	err := tx.QueryRow(`
+		INSERT INTO runners (athlete_id, name, club, last_seen)
+		VALUES (?, ?, ?, (SELECT date(date) FROM events WHERE id = ?))
+		ON CONFLICT (athlete_id) DO UPDATE
+		SET name = excluded.name, club = excluded.club, last_seen = excluded.last_seen
+		WHERE runners.last_seen IS NULL
+		OR excluded.last_seen >= runners.last_seen
+		RETURNING id`, result.AthleteID, result.Name, result.Club, eventID).Scan(&runnerID)
+	if err == sql.ErrNoRows {
+		// Nothing is returned when the runner was seen more recently
+		err = tx.QueryRow(`SELECT id FROM runners WHERE athlete_id = ?`, result.AthleteID).Scan(&runnerID)
+	}
+	return runnerID, err
+}
+
+// ComputeLocationRuns sets each result's location_runs at a location to how
+// many times the runner had run there, up to and including that event.
+// Runners are matched by athlete ID, or by name for results without one.
+func ComputeLocationRuns(db *sql.DB, locationID int) error {
+	_, err := db.Exec(`
+		UPDATE results SET location_runs = counted.runs
+		FROM (
+			SELECT 
+				r.id,
+				ROW_NUMBER() OVER (
+					PARTITION BY CASE WHEN r.athlete_id > 0 THEN 'id:' || r.athlete_id ELSE 'name:' || r.name END
+					ORDER BY e.date, e.event_number
+				) AS runs
+			FROM results r
+			JOIN events e ON r.event_id = e.id
+			WHERE e.location_id = ?
+			AND r.name != 'Unknown'
+		) AS counted
+		WHERE results.id = counted.id`, locationID)
+	if err != nil {
+		return fmt.Errorf("error computing location runs: %v", err)
+	}
+	return nil
 }
 
 // GetNextEventNumber returns the next event number for a location
@@ -114,18 +818,71 @@ func GetNextEventNumber(db *sql.DB, locationID int) int {
 	return eventID + 1
 }
 
+// GetEventNumberFromDate returns the event a scrape starting at date should
+// begin with: the one after the last stored event before date, or 1 if there
+// isn't one
+func GetEventNumberFromDate(db *sql.DB, locationID int, date time.Time) int {
+	var eventNumber int
+	err := db.QueryRow(`
+		SELECT COALESCE(MAX(event_number), 0)
+		FROM events 
+		WHERE location_id = ?
+		AND date < ?`, locationID, date).Scan(&eventNumber)
+	if err != nil {
+		log.Printf("Error finding the first event from %s: %v, starting from 1", date.Format("2006-01-02"), err)
+		return 1
+	}
+	return eventNumber + 1
+}
+
+// GetLowestEventNumber returns the earliest stored event number for a location, or 0 if there are none
+func GetLowestEventNumber(db *sql.DB, locationID int) int {
+	var eventNumber int
+	err := db.QueryRow(`
+		SELECT COALESCE(MIN(event_number), 0)
+		FROM events 
+		WHERE location_id = ?`, locationID).Scan(&eventNumber)
+	if err != nil {
+		log.Printf("Error getting first event number: %v", err)
+		return 0
+	}
+	return eventNumber
+}
+
+// SetEventExcluded marks an event to be left out of (or put back into) reports
+func SetEventExcluded(db *sql.DB, urlSlug string, eventNumber int, excluded bool) error {
+	locationID, err := getLocationID(db, urlSlug)
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec(`
+		UPDATE events SET excluded = ?
+		WHERE event_number = ?
+		AND location_id = ?`, excluded, eventNumber, locationID)
+	if err != nil {
+		return fmt.Errorf("error updating event: %v", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error updating event: %v", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("event %d %w for location '%s'", eventNumber, ErrNotFound, urlSlug)
+	}
+	return nil
+}
+
 // ClearLocationData removes all data for a specific location
 func ClearLocationData(db *sql.DB, urlSlug string) error {
 	// First get the location ID
-	var locationID int
-	err := db.QueryRow(`SELECT id FROM locations WHERE slug = ?`, urlSlug).Scan(&locationID)
-	if err == sql.ErrNoRows {
-		// Location doesn't exist, nothing to clear
-		return nil
-	}
+	locationID, found, err := findLocationID(db, urlSlug)
 	if err != nil {
 		return fmt.Errorf("error finding location: %v", err)
 	}
+	if !found {
+		// Location doesn't exist, nothing to clear
+		return nil
+	}
 
 	// Start a transaction to ensure all deletes succeed or none do
 	tx, err := db.Begin()
@@ -144,6 +901,17 @@ func ClearLocationData(db *sql.DB, urlSlug string) error {
 		return fmt.Errorf("error deleting results: %v", err)
 	}
 
+	// Delete volunteers for all events at this location
+	_, err = tx.Exec(`
+		DELETE FROM volunteers 
+		WHERE event_id IN (
+			SELECT id FROM events WHERE location_id = ?
+		)`, locationID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting volunteers: %v", err)
+	}
+
 	// Delete events for this location
 	_, err = tx.Exec(`DELETE FROM events WHERE location_id = ?`, locationID)
 	if err != nil {
@@ -151,6 +919,27 @@ func ClearLocationData(db *sql.DB, urlSlug string) error {
 		return fmt.Errorf("error deleting events: %v", err)
 	}
 
+	// Delete the location's scrape history
+	_, err = tx.Exec(`DELETE FROM scrape_runs WHERE location_id = ?`, locationID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting scrape history: %v", err)
+	}
+
+	// Delete the location's cached leaderboard
+	_, err = tx.Exec(`DELETE FROM leaderboard_cache WHERE location_id = ?`, locationID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting cached leaderboard: %v", err)
+	}
+
+	// Delete the location's name aliases
+	_, err = tx.Exec(`DELETE FROM aliases WHERE location_id = ?`, locationID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting aliases: %v", err)
+	}
+
 	// Delete the location itself
 	_, err = tx.Exec(`DELETE FROM locations WHERE id = ?`, locationID)
 	if err != nil {
@@ -166,3 +955,46 @@ func ClearLocationData(db *sql.DB, urlSlug string) error {
 
 	return nil
 }
+
+// RecordScrapeRun saves a finished scrape's counts to the scrape_runs table,
+// so a location's scrapes can be monitored over time
+func RecordScrapeRun(db *sql.DB, result *ScrapeResult) error {
+	_, err := db.Exec(`
+		INSERT INTO scrape_runs (
+			location_id, started_at, finished_at, events_stored, results_stored,
+			events_skipped, events_unchanged, errors, stop_reason
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		result.LocationID, result.StartedAt, result.FinishedAt, result.EventsStored, result.ResultsStored,
+		result.EventsSkipped, result.EventsUnchanged, result.Errors, string(result.StopReason))
+	if err != nil {
+		return fmt.Errorf("error recording scrape run: %v", err)
+	}
+	return nil
+}
+
+// GetScrapeRuns returns a location's recorded scrapes, most recent first
+func GetScrapeRuns(db *sql.DB, locationID int) ([]ScrapeResult, error) {
+	rows, err := db.Query(`
+		SELECT location_id, started_at, finished_at, events_stored, results_stored,
+			events_skipped, events_unchanged, errors, stop_reason
+		FROM scrape_runs
+		WHERE location_id = ?
+		ORDER BY started_at DESC, id DESC`, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var runs []ScrapeResult
+	for rows.Next() {
+		var run ScrapeResult
+		var stopReason string
+		if err := rows.Scan(&run.LocationID, &run.StartedAt, &run.FinishedAt, &run.EventsStored, &run.ResultsStored,
+			&run.EventsSkipped, &run.EventsUnchanged, &run.Errors, &stopReason); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		run.StopReason = StopReason(stopReason)
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
@@ -4,7 +4,10 @@ import (
 	"testing"
 	"time"	
 	"database/sql"
+	"errors"
 	"os"
+	"path/filepath"
+	"reflect"
 )
 
 func TestCreateTables(t *testing.T) {
@@ -34,6 +37,133 @@ func TestCreateTables(t *testing.T) {
 	}
 }
 
+func TestCreateTablesAddsMissingColumns(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Recreate locations as it was before distance_km existed
+	_, err := db.Exec(`DROP TABLE locations`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE locations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			slug TEXT UNIQUE NOT NULL,
+			name TEXT,
+			country TEXT NOT NULL
+		)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO locations (slug, country) VALUES ('old-location', 'AUS')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// And results as they were before time_raw
+	_, err = db.Exec(`
+		DROP TABLE results;
+		CREATE TABLE results (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			position INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			time_seconds INTEGER,
+			event_id INTEGER,
+			UNIQUE(position, event_id)
+		);
+		INSERT INTO results (position, name, time_seconds, event_id) VALUES (1, 'Runner A', 1200, 1);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	CreateTables(db)
+
+	var distance float64
+	err = db.QueryRow(`SELECT distance_km FROM locations WHERE slug = 'old-location'`).Scan(&distance)
+	if err != nil {
+		t.Fatalf("Expected distance_km column to be added: %v", err)
+	}
+	if distance != 5 {
+		t.Errorf("Expected default distance of 5, got %v", distance)
+	}
+
+	// Results stored before time_raw existed have no raw time
+	var timeRaw, club sql.NullString
+	err = db.QueryRow(`SELECT time_raw, club FROM results WHERE position = 1`).Scan(&timeRaw, &club)
+	if err != nil {
+		t.Fatalf("Expected time_raw and club columns to be added: %v", err)
+	}
+	if timeRaw.Valid {
+		t.Errorf("Expected no raw time for an old result, got %q", timeRaw.String)
+	}
+}
+
+func TestLocationsUniqueBySlugAndCountry(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Start from a locations table where slugs were unique on their own
+	_, err := db.Exec(`DROP TABLE locations`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE locations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			slug TEXT UNIQUE NOT NULL,
+			name TEXT,
+			country TEXT NOT NULL,
+			distance_km REAL NOT NULL DEFAULT 5
+		);
+		INSERT INTO locations (id, slug, country) VALUES (1, 'bushy', 'AUS');
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES (1, 1, 1, '2023-01-01', '')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	CreateTables(db)
+
+	// The same slug can now be added for another country
+	_, err = db.Exec(`INSERT INTO locations (id, slug, country) VALUES (2, 'bushy', 'GBR')`)
+	if err != nil {
+		t.Fatalf("Expected the same slug in another country to be allowed: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO locations (slug, country) VALUES ('bushy', 'GBR')`)
+	if err == nil {
+		t.Error("Expected a duplicate slug and country to be rejected")
+	}
+
+	// Existing rows keep their IDs, so events still point at them
+	tests := []struct {
+		location string
+		wantID   int
+		wantErr  bool
+	}{
+		{"bushy:AUS", 1, false},
+		{"bushy:gbr", 2, false},
+		{"bushy", 0, true},
+		{"bushy:NZL", 0, true},
+	}
+	for _, tt := range tests {
+		id, err := getLocationID(db, tt.location)
+		if (err != nil) != tt.wantErr || id != tt.wantID {
+			t.Errorf("getLocationID(%q) = %d, %v, want %d, error %v", tt.location, id, err, tt.wantID, tt.wantErr)
+		}
+	}
+	if next := GetNextEventNumber(db, 1); next != 2 {
+		t.Errorf("Expected bushy:AUS to keep its events, next event is %d", next)
+	}
+
+	locations, err := GetAvailableLocations(db)
+	if err != nil {
+		t.Fatalf("GetAvailableLocations failed: %v", err)
+	}
+	if len(locations) != 2 || locations[0] != "bushy:AUS" || locations[1] != "bushy:GBR" {
+		t.Errorf("Expected qualified locations, got %v", locations)
+	}
+}
+
 func TestGetNextEventNumber(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -199,6 +329,53 @@ func TestStoreEvent(t *testing.T) {
 	}
 }
 
+func TestStoreEventRetriesWhileLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "parkrun.db")
+
+	// The writer gives up on a lock almost straight away, so the retries are what wait for it
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	CreateTables(db)
+	_, err = db.Exec(`INSERT INTO locations (id, slug, country) VALUES (1, 'test-location', 'AUS')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another connection holds a write lock until its transaction is committed
+	other, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	tx, err := other.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`UPDATE locations SET name = 'Test Location'`); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		tx.Commit()
+	}()
+
+	eventID, err := StoreEvent(db, Event{
+		EventNumber: 1,
+		LocationID:  1,
+		Date:        parseDate(t, "2023-01-01"),
+		URL:         "http://example.com/1",
+	})
+	if err != nil {
+		t.Fatalf("Expected the write to succeed once the lock was released: %v", err)
+	}
+	if eventID <= 0 {
+		t.Error("Expected positive event ID")
+	}
+}
+
 func TestStoreResults(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -223,28 +400,37 @@ func TestStoreResults(t *testing.T) {
 		{
 			Position:    1,
 			Name:        "Runner A",
+			Time:        "20:00",
 			TimeSeconds: 1200,
 			AgeGrade:    "65.5%",
 			AgeCategory: "VM35-39",
 			TotalRuns:   10,
 			EventID:     1,
+			Club:        "Test Harriers",
 		},
 		{
 			Position:    2,
 			Name:        "Runner B",
-			TimeSeconds: 1300,
+			Time:        "1:00:00",
+			TimeSeconds: 3600,
 			AgeGrade:    "60.2%",
 			AgeCategory: "VM40-44",
 			TotalRuns:   5,
 			EventID:     1,
 		},
+		{
+			Position: 3,
+			Name:     "Unknown",
+			EventID:  1,
+		},
 	}
 
 	StoreResults(db, results, 1)
 
 	// Verify stored results
 	rows, err := db.Query(`
-		SELECT position, name, time_seconds, age_grade, age_category, total_runs, event_id
+		SELECT position, name, COALESCE(time_seconds, 0), COALESCE(time_raw, ''), COALESCE(age_grade, ''),
+			COALESCE(age_category, ''), total_runs, event_id, club
 		FROM results WHERE event_id = 1 ORDER BY position`)
 	if err != nil {
 		t.Fatal(err)
@@ -258,10 +444,12 @@ func TestStoreResults(t *testing.T) {
 			&r.Position,
 			&r.Name,
 			&r.TimeSeconds,
+			&r.Time,
 			&r.AgeGrade,
 			&r.AgeCategory,
 			&r.TotalRuns,
 			&r.EventID,
+			&r.Club,
 		)
 		if err != nil {
 			t.Fatal(err)
@@ -284,6 +472,9 @@ func TestStoreResults(t *testing.T) {
 		if got.TimeSeconds != want.TimeSeconds {
 			t.Errorf("Time mismatch at %d: got %d, want %d", i, got.TimeSeconds, want.TimeSeconds)
 		}
+		if got.Time != want.Time {
+			t.Errorf("Raw time mismatch at %d: got %q, want %q", i, got.Time, want.Time)
+		}
 		if got.AgeGrade != want.AgeGrade {
 			t.Errorf("Age grade mismatch at %d: got %s, want %s", i, got.AgeGrade, want.AgeGrade)
 		}
@@ -296,6 +487,263 @@ func TestStoreResults(t *testing.T) {
 		if got.EventID != want.EventID {
 			t.Errorf("Event ID mismatch at %d: got %d, want %d", i, got.EventID, want.EventID)
 		}
+		if got.Club != want.Club {
+			t.Errorf("Club mismatch at %d: got %q, want %q", i, got.Club, want.Club)
+		}
+	}
+}
+
+func TestHashResultsCoversStoredFields(t *testing.T) {
+	result := Result{Position: 1, Name: "Runner A", Time: "18:30", TimeSeconds: 1110}
+	volunteers := []Volunteer{{Name: "Volunteer X"}}
+	hash := hashResults([]Result{result}, volunteers)
+
+	changes := map[string]func(*Result){
+		"raw time": func(r *Result) { r.Time = "0:18:30" },
+		"club":     func(r *Result) { r.Club = "Test Harriers" },
+		"note":     func(r *Result) { r.NoteMissing = true },
+	}
+	for name, change := range changes {
+		changed := result
+		change(&changed)
+		if hashResults([]Result{changed}, volunteers) == hash {
+			t.Errorf("Expected a change to the %s to change the hash", name)
+		}
+	}
+
+	// Volunteers are stored with the results, so they count too
+	if hashResults([]Result{result}, append(volunteers, Volunteer{Name: "Volunteer Y"})) == hash {
+		t.Error("Expected another volunteer to change the hash")
+	}
+}
+
+func TestStoreResultsLinksRunners(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	_, err := db.Exec(`
+		INSERT INTO locations (id, slug, country) VALUES (1, 'test-location', 'AUS');
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(1, 1, 1, '2023-01-01', 'http://example.com/1'),
+		(2, 2, 1, '2023-01-08', 'http://example.com/2')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Runner A runs twice, changing their name in between, and the unknown runner has no athlete ID
+	StoreResults(db, []Result{
+		{Position: 1, Name: "Runner A", TimeSeconds: 1200, AthleteID: 1001},
+		{Position: 2, Name: "Unknown"},
+	}, 1)
+	StoreResults(db, []Result{
+		{Position: 1, Name: "Runner A-Smith", TimeSeconds: 1190, AthleteID: 1001, Club: "Test Harriers"},
+	}, 2)
+
+	var runners int
+	var name, club string
+	err = db.QueryRow(`SELECT COUNT(*), MAX(name), MAX(club) FROM runners WHERE athlete_id = 1001`).Scan(&runners, &name, &club)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runners != 1 || name != "Runner A-Smith" || club != "Test Harriers" {
+		t.Errorf("Expected one runners row named Runner A-Smith in Test Harriers, got %d named %s in %q", runners, name, club)
+	}
+
+	var linked, distinctRunners, unknownLinked int
+	err = db.QueryRow(`
+		SELECT 
+			COUNT(runner_id),
+			COUNT(DISTINCT runner_id),
+			COUNT(CASE WHEN name = 'Unknown' AND runner_id IS NOT NULL THEN 1 END)
+		FROM results`).Scan(&linked, &distinctRunners, &unknownLinked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked != 2 || distinctRunners != 1 {
+		t.Errorf("Expected both of Runner A's results linked to one runner, got %d linked to %d runners", linked, distinctRunners)
+	}
+	if unknownLinked != 0 {
+		t.Error("Expected the unknown runner not to be linked to a runner")
+	}
+}
+
+func TestStoreResultsKeepsLatestRunnerName(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	_, err := db.Exec(`
+		INSERT INTO locations (id, slug, country) VALUES (1, 'test-location', 'AUS');
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(1, 1, 1, '2023-01-01', 'http://example.com/1'),
+		(2, 2, 1, '2023-01-08', 'http://example.com/2')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The newer event is stored first, as in a backfill
+	StoreResults(db, []Result{
+		{Position: 1, Name: "Runner A-Smith", TimeSeconds: 1190, AthleteID: 1001, Club: "Test Harriers"},
+	}, 2)
+	StoreResults(db, []Result{
+		{Position: 1, Name: "Runner A", TimeSeconds: 1200, AthleteID: 1001},
+	}, 1)
+
+	var name, club string
+	err = db.QueryRow(`SELECT name, club FROM runners WHERE athlete_id = 1001`).Scan(&name, &club)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Runner A-Smith" || club != "Test Harriers" {
+		t.Errorf("Expected the newer name and club to be kept, got %s in %q", name, club)
+	}
+
+	var linked int
+	err = db.QueryRow(`SELECT COUNT(runner_id) FROM results WHERE athlete_id = 1001`).Scan(&linked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked != 2 {
+		t.Errorf("Expected both results linked to the runner, got %d", linked)
+	}
+}
+
+func TestMigrateRunners(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Results stored before the runners table existed
+	_, err := db.Exec(`
+		UPDATE results SET athlete_id = 1001 WHERE name = 'Runner A';
+		UPDATE results SET name = 'Runner A-Smith' WHERE name = 'Runner A' AND event_id = 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateRunners(db); err != nil {
+		t.Fatalf("migrateRunners failed: %v", err)
+	}
+
+	var runners int
+	var name string
+	err = db.QueryRow(`SELECT COUNT(*), MAX(name) FROM runners`).Scan(&runners, &name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runners != 1 || name != "Runner A-Smith" {
+		t.Errorf("Expected one runner named from their latest run, got %d named %s", runners, name)
+	}
+	var unlinked int
+	err = db.QueryRow(`SELECT COUNT(*) FROM results WHERE athlete_id > 0 AND runner_id IS NULL`).Scan(&unlinked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unlinked != 0 {
+		t.Errorf("Expected every result with an athlete ID to be linked, %d weren't", unlinked)
+	}
+}
+
+func TestSetEventExcluded(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	err := SetEventExcluded(db, "test-park-1", 2, true)
+	if err != nil {
+		t.Fatalf("SetEventExcluded failed: %v", err)
+	}
+
+	stats, err := GetLocationStats(db, 1)
+	if err != nil {
+		t.Fatalf("GetLocationStats failed: %v", err)
+	}
+	if stats["total_events"] != 1 {
+		t.Errorf("Expected 1 event after excluding one, got %v", stats["total_events"])
+	}
+	if stats["total_runners"] != 2 {
+		t.Errorf("Expected 2 runners after excluding an event, got %v", stats["total_runners"])
+	}
+
+	medians, err := GetMedianTimesByAgeCategory(db, 1)
+	if err != nil {
+		t.Fatalf("GetMedianTimesByAgeCategory failed: %v", err)
+	}
+	for _, m := range medians {
+		if m.Category == "VM35-39" && m.Count != 1 {
+			t.Errorf("Expected 1 VM35-39 result after excluding an event, got %d", m.Count)
+		}
+	}
+
+	// Including it again restores the totals
+	err = SetEventExcluded(db, "test-park-1", 2, false)
+	if err != nil {
+		t.Fatalf("SetEventExcluded failed: %v", err)
+	}
+	stats, err = GetLocationStats(db, 1)
+	if err != nil {
+		t.Fatalf("GetLocationStats failed: %v", err)
+	}
+	if stats["total_events"] != 2 {
+		t.Errorf("Expected 2 events after including it again, got %v", stats["total_events"])
+	}
+
+	if err := SetEventExcluded(db, "test-park-1", 99, true); err == nil {
+		t.Error("Expected an error for an unknown event")
+	}
+}
+
+func TestSetEventNote(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	err := SetEventNote(db, "test-park-1", 2, "Heatwave, 38C")
+	if err != nil {
+		t.Fatalf("SetEventNote failed: %v", err)
+	}
+	note, err := GetEventNote(db, "test-park-1", 2)
+	if err != nil {
+		t.Fatalf("GetEventNote failed: %v", err)
+	}
+	if note != "Heatwave, 38C" {
+		t.Errorf("Expected note %q, got %q", "Heatwave, 38C", note)
+	}
+
+	// The note is shown with the event but doesn't change the figures
+	finishers, err := GetLastFinisherTrend(db, 1)
+	if err != nil {
+		t.Fatalf("GetLastFinisherTrend failed: %v", err)
+	}
+	if finishers[0].Note != "" || finishers[1].Note != "Heatwave, 38C" || finishers[1].TimeSeconds != 1190 {
+		t.Errorf("Expected the note on event 2 only, got %+v", finishers)
+	}
+
+	// Re-storing the event keeps its ID and note
+	eventID, err := StoreEvent(db, Event{EventNumber: 2, LocationID: 1, Date: parseDate(t, "2023-01-08"), URL: "http://example.com/2"})
+	if err != nil {
+		t.Fatalf("StoreEvent failed: %v", err)
+	}
+	if eventID != 2 {
+		t.Errorf("Expected re-stored event to keep ID 2, got %d", eventID)
+	}
+	note, err = GetEventNote(db, "test-park-1", 2)
+	if err != nil {
+		t.Fatalf("GetEventNote failed: %v", err)
+	}
+	if note != "Heatwave, 38C" {
+		t.Errorf("Expected note to survive re-storing the event, got %q", note)
+	}
+
+	// An empty note removes it
+	if err := SetEventNote(db, "test-park-1", 2, ""); err != nil {
+		t.Fatalf("SetEventNote failed: %v", err)
+	}
+	if note, _ := GetEventNote(db, "test-park-1", 2); note != "" {
+		t.Errorf("Expected note to be removed, got %q", note)
+	}
+
+	if err := SetEventNote(db, "test-park-1", 99, "note"); err == nil {
+		t.Error("Expected an error for an unknown event")
 	}
 }
 
@@ -369,3 +817,143 @@ func parseDate(t *testing.T, dateStr string) time.Time {
 	}
 	return date
 }
+
+func TestRebuildDatabase(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// A column left over from an old schema, which ALTER TABLE can't drop cleanly
+	_, err := db.Exec(`
+		ALTER TABLE results ADD COLUMN legacy TEXT;
+		UPDATE events SET event_note = 'Heatwave', excluded = 1 WHERE id = 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	countRows := func() map[string]int {
+		counts := make(map[string]int)
+		for _, table := range []string{"locations", "events", "results"} {
+			var count int
+			if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			counts[table] = count
+		}
+		return counts
+	}
+	before := countRows()
+
+	backupPath := filepath.Join(t.TempDir(), "backup.db")
+	if err := RebuildDatabase(db, backupPath); err != nil {
+		t.Fatalf("RebuildDatabase failed: %v", err)
+	}
+
+	if after := countRows(); !reflect.DeepEqual(after, before) {
+		t.Errorf("Row counts after rebuild = %v, want %v", after, before)
+	}
+	if _, err := os.Stat(backupPath); err != nil {
+		t.Errorf("Expected a backup at %s: %v", backupPath, err)
+	}
+	if _, err := db.Exec(`SELECT legacy FROM results`); err == nil {
+		t.Error("Expected the old column to be gone after rebuild")
+	}
+	note, err := GetEventNote(db, "test-park-1", 2)
+	if err != nil || note != "Heatwave" {
+		t.Errorf("Expected the event note to survive, got %q, %v", note, err)
+	}
+
+	// Without a backup nothing is touched
+	if err := RebuildDatabase(db, backupPath); err == nil {
+		t.Error("Expected an error when the backup can't be written")
+	}
+	if after := countRows(); !reflect.DeepEqual(after, before) {
+		t.Errorf("Row counts after refused rebuild = %v, want %v", after, before)
+	}
+}
+
+func TestStoreEventRejectsImplausibleDate(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	_, err := db.Exec(`
+		INSERT INTO locations (id, slug, country) 
+		VALUES (1, 'test-location', 'AUS')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// e.g. a two-digit year read as the wrong century
+	event := Event{EventNumber: 1, LocationID: 1, Date: parseDate(t, "2099-06-05"), URL: "http://example.com/1"}
+	_, err = StoreEvent(db, event)
+	if !errors.Is(err, ErrImplausibleDate) {
+		t.Fatalf("Expected ErrImplausibleDate, got %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no events stored, got %d", count)
+	}
+}
+
+func TestComputeLocationRuns(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Runner A runs a third time at the first park and once at the second
+	_, err := db.Exec(`
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(4, 3, 1, '2023-01-15', '');
+		INSERT INTO results (position, name, time_seconds, total_runs, event_id) VALUES 
+		(1, 'Runner A', 1190, 12, 4),
+		(2, 'Runner A', 1250, 13, 3)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ComputeLocationRuns(db, 1); err != nil {
+		t.Fatalf("ComputeLocationRuns failed: %v", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT r.event_id, r.name, r.total_runs, COALESCE(r.location_runs, 0)
+		FROM results r
+		ORDER BY r.event_id, r.position`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	type count struct {
+		eventID      int
+		name         string
+		totalRuns    int
+		locationRuns int
+	}
+	var got []count
+	for rows.Next() {
+		var c count
+		if err := rows.Scan(&c.eventID, &c.name, &c.totalRuns, &c.locationRuns); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, c)
+	}
+
+	// The scraped total runs are left alone, and the second park isn't counted
+	want := []count{
+		{1, "Runner A", 10, 1},
+		{1, "Runner B", 5, 1},
+		{2, "Runner A", 11, 2},
+		{2, "Runner D", 3, 1},
+		{3, "Runner C", 1, 0},
+		{3, "Runner A", 13, 0},
+		{4, "Runner A", 12, 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Location runs = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Exit codes, so scripts can tell why a command failed
+const (
+	exitOK       = 0
+	exitError    = 1 // Anything not covered below
+	exitUsage    = 2 // Bad arguments or flags
+	exitNotFound = 3 // The location, event or athlete isn't in the database
+	exitNetwork  = 4 // Results couldn't be fetched, e.g. network errors or rate limiting
+	exitPartial  = 5 // A scrape stored some events but hit errors
+)
+
+// ErrNotFound is wrapped by errors for a location, event or athlete that
+// isn't in the database
+var ErrNotFound = errors.New("not found")
+
+// ExitError is an error that exits with a particular code
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// errUsage is returned after printing usage for missing or extra arguments
+var errUsage = &ExitError{Code: exitUsage, Err: errors.New("invalid arguments")}
+
+// usageError marks an error as caused by bad arguments
+func usageError(err error) error {
+	return &ExitError{Code: exitUsage, Err: err}
+}
+
+// scrapeError returns an error for a scrape that didn't fully succeed: a
+// network error if it stored nothing before giving up, or partial data if it
+// stored events but skipped some because of errors
+func scrapeError(result ScrapeResult) error {
+	if result.StopReason == StopTooManyErrors && result.EventsStored == 0 {
+		return &ExitError{Code: exitNetwork, Err: fmt.Errorf("scrape stopped after %d errors without storing any events", result.Errors)}
+	}
+	if result.Errors > 0 {
+		return &ExitError{Code: exitPartial, Err: fmt.Errorf("scrape stored %d events but hit %d errors", result.EventsStored, result.Errors)}
+	}
+	return nil
+}
+
+// exitCode returns the exit code for an error returned by run
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	if errors.Is(err, ErrNotFound) {
+		return exitNotFound
+	}
+	var httpErr *HTTPError
+	var netErr net.Error
+	if errors.As(err, &httpErr) || errors.As(err, &netErr) {
+		return exitNetwork
+	}
+	return exitError
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunExitCodeForUnknownLocation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "parkrun.db")
+	db, err := openDB(path)
+	if err != nil {
+		t.Fatalf("openDB failed: %v", err)
+	}
+	CreateTables(db)
+	db.Close()
+
+	defer func(original string) { dbPath = original }(dbPath)
+
+	err = run([]string{"--db", path, "totals", "Runner A", "nowhere"})
+	if err == nil {
+		t.Fatal("Expected an error for an unknown location")
+	}
+	if code := exitCode(err); code != exitNotFound {
+		t.Errorf("Expected exit code %d, got %d (%v)", exitNotFound, code, err)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, exitOK},
+		{"usage", errUsage, exitUsage},
+		{"not found", fmt.Errorf("location 'nowhere' %w", ErrNotFound), exitNotFound},
+		{"rate limited", fmt.Errorf("fetching event 3: %w", &HTTPError{StatusCode: 429}), exitNetwork},
+		{"network", scrapeError(ScrapeResult{StopReason: StopTooManyErrors, Errors: 3}), exitNetwork},
+		{"partial", scrapeError(ScrapeResult{EventsStored: 5, Errors: 1}), exitPartial},
+		{"other", errors.New("boom"), exitError},
+	}
+
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("%s: expected exit code %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DumpSQL writes a location, its events, runners, results and volunteers as portable SQL INSERT statements
+func DumpSQL(db *sql.DB, locationSlug string, w io.Writer) error {
+	locationID, err := getLocationID(db, locationSlug)
+	if err != nil {
+		return err
+	}
+
+	var location Location
+	var name, domain sql.NullString
+	err = db.QueryRow(`
+		SELECT id, slug, name, country, distance_km, domain
+		FROM locations WHERE id = ?`, locationID).Scan(
+		&location.ID, &location.Slug, &name, &location.Country, &location.DistanceKm, &domain)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+
+	fmt.Fprintf(w, "-- parkrun data for %s\n", locationSlug)
+	fmt.Fprintf(w, "BEGIN;\n")
+	fmt.Fprintf(w, "INSERT INTO locations (id, slug, name, country, distance_km, domain) VALUES (%d, %s, %s, %s, %s, %s);\n",
+		location.ID, sqlString(location.Slug), sqlNullString(name), sqlString(location.Country),
+		strconv.FormatFloat(location.DistanceKm, 'f', -1, 64), sqlNullString(domain))
+
+	rows, err := db.Query(`
+		SELECT id, event_number, date, url, excluded, results_hash, event_note
+		FROM events WHERE location_id = ?
+		ORDER BY event_number`, location.ID)
+	if err != nil {
+		return fmt.Errorf("error querying events: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var event Event
+		var excluded bool
+		var resultsHash, eventNote sql.NullString
+		if err := rows.Scan(&id, &event.EventNumber, &event.Date, &event.URL, &excluded, &resultsHash, &eventNote); err != nil {
+			return fmt.Errorf("error scanning event: %v", err)
+		}
+		excludedValue := 0
+		if excluded {
+			excludedValue = 1
+		}
+		fmt.Fprintf(w, "INSERT INTO events (id, event_number, location_id, date, url, excluded, results_hash, event_note) VALUES (%d, %d, %d, %s, %s, %d, %s, %s);\n",
+			id, event.EventNumber, location.ID, sqlString(event.Date.Format("2006-01-02")), sqlString(event.URL),
+			excludedValue, sqlNullString(resultsHash), sqlNullString(eventNote))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading events: %v", err)
+	}
+
+	// Runners come before their results, which refer to them
+	rows, err = db.Query(`
+		SELECT id, athlete_id, name, club, last_seen
+		FROM runners
+		WHERE id IN (
+			SELECT r.runner_id
+			FROM results r
+			JOIN events e ON r.event_id = e.id
+			WHERE e.location_id = ?
+		)
+		ORDER BY id`, location.ID)
+	if err != nil {
+		return fmt.Errorf("error querying runners: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var athleteID int
+		var runnerName string
+		var club sql.NullString
+		var lastSeen sql.NullTime
+		if err := rows.Scan(&id, &athleteID, &runnerName, &club, &lastSeen); err != nil {
+			return fmt.Errorf("error scanning runner: %v", err)
+		}
+		lastSeenValue := "NULL"
+		if lastSeen.Valid {
+			lastSeenValue = sqlString(lastSeen.Time.Format("2006-01-02"))
+		}
+		fmt.Fprintf(w, "INSERT INTO runners (id, athlete_id, name, club, last_seen) VALUES (%d, %d, %s, %s, %s);\n",
+			id, athleteID, sqlString(runnerName), sqlNullString(club), lastSeenValue)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading runners: %v", err)
+	}
+
+	rows, err = db.Query(`
+		SELECT r.id, r.position, r.name, r.time_seconds, r.time_raw, r.age_grade, r.age_category, r.note, r.total_runs,
+			r.event_id, r.athlete_id, r.gender, r.gender_position, r.location_runs, r.runner_id, r.club
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		ORDER BY e.event_number, r.position`, location.ID)
+	if err != nil {
+		return fmt.Errorf("error querying results: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, eventID int64
+		var position int
+		var runnerName string
+		var timeSeconds, totalRuns, athleteID, genderPosition, locationRuns, runnerID sql.NullInt64
+		var timeRaw, ageGrade, ageCategory, note, gender, club sql.NullString
+		err := rows.Scan(&id, &position, &runnerName, &timeSeconds, &timeRaw, &ageGrade, &ageCategory, &note, &totalRuns,
+			&eventID, &athleteID, &gender, &genderPosition, &locationRuns, &runnerID, &club)
+		if err != nil {
+			return fmt.Errorf("error scanning result: %v", err)
+		}
+		fmt.Fprintf(w, "INSERT INTO results (id, position, name, time_seconds, time_raw, age_grade, age_category, note, total_runs, event_id, athlete_id, gender, gender_position, location_runs, runner_id, club) VALUES (%d, %d, %s, %s, %s, %s, %s, %s, %s, %d, %s, %s, %s, %s, %s, %s);\n",
+			id, position, sqlString(runnerName), sqlNullInt(timeSeconds), sqlNullString(timeRaw), sqlNullString(ageGrade),
+			sqlNullString(ageCategory), sqlNullString(note), sqlNullInt(totalRuns), eventID, sqlNullInt(athleteID),
+			sqlNullString(gender), sqlNullInt(genderPosition), sqlNullInt(locationRuns), sqlNullInt(runnerID), sqlNullString(club))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading results: %v", err)
+	}
+
+	rows, err = db.Query(`
+		SELECT v.id, v.event_id, v.name, v.role
+		FROM volunteers v
+		JOIN events e ON v.event_id = e.id
+		WHERE e.location_id = ?
+		ORDER BY e.event_number, v.id`, location.ID)
+	if err != nil {
+		return fmt.Errorf("error querying volunteers: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var volunteer Volunteer
+		var id int64
+		if err := rows.Scan(&id, &volunteer.EventID, &volunteer.Name, &volunteer.Role); err != nil {
+			return fmt.Errorf("error scanning volunteer: %v", err)
+		}
+		fmt.Fprintf(w, "INSERT INTO volunteers (id, event_id, name, role) VALUES (%d, %d, %s, %s);\n",
+			id, volunteer.EventID, sqlString(volunteer.Name), sqlString(volunteer.Role))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading volunteers: %v", err)
+	}
+
+	fmt.Fprintf(w, "COMMIT;\n")
+	return nil
+}
+
+// ExportRunnerICS writes a runner's parkruns at a location as an iCalendar
+// file, with an all-day event for each run
+func ExportRunnerICS(db *sql.DB, locationSlug, runnerName string, w io.Writer) error {
+	locationID, err := getLocationID(db, locationSlug)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`
+		SELECT e.event_number, e.date, e.url, r.position, COALESCE(r.time_seconds, 0)
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND r.name = ?
+		ORDER BY e.event_number`, locationID, runnerName)
+	if err != nil {
+		return fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	// iCalendar lines end in CRLF
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(w, format+"\r\n", args...)
+	}
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//parkrun-parser//EN")
+	line("CALSCALE:GREGORIAN")
+	for rows.Next() {
+		var eventNumber, position, timeSeconds int
+		var date time.Time
+		var url string
+		if err := rows.Scan(&eventNumber, &date, &url, &position, &timeSeconds); err != nil {
+			return fmt.Errorf("scan error: %v", err)
+		}
+
+		description := fmt.Sprintf("Position %d", position)
+		if timeSeconds > 0 {
+			description = fmt.Sprintf("Finished in %s, position %d", secondsToTime(timeSeconds), position)
+		}
+
+		line("BEGIN:VEVENT")
+		line("UID:%s-%d-%s@parkrun-parser", locationSlug, eventNumber, icsUIDPart(runnerName))
+		line("DTSTAMP:%s", stamp)
+		line("DTSTART;VALUE=DATE:%s", date.Format("20060102"))
+		line("DTEND;VALUE=DATE:%s", date.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:%s", icsText(fmt.Sprintf("%s parkrun #%d", locationSlug, eventNumber)))
+		line("DESCRIPTION:%s", icsText(description))
+		if url != "" {
+			line("URL:%s", url)
+		}
+		line("END:VEVENT")
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading runs: %v", err)
+	}
+	line("END:VCALENDAR")
+	return nil
+}
+
+// ResultRecord is one result row as written by ExportResultsNDJSON
+type ResultRecord struct {
+	Location    string `json:"location"`
+	EventNumber int    `json:"event_number"`
+	Date        string `json:"date"`
+	Position    int    `json:"position"`
+	Name        string `json:"name"`
+	AthleteID   int    `json:"athlete_id,omitempty"`
+	TimeSeconds int    `json:"time_seconds,omitempty"`
+	AgeGrade    string `json:"age_grade,omitempty"`
+	AgeCategory string `json:"age_category,omitempty"`
+	Gender      string `json:"gender,omitempty"`
+	TotalRuns   int    `json:"total_runs,omitempty"`
+	Note        string `json:"note,omitempty"`
+}
+
+// ExportResultsNDJSON writes a location's results as line-delimited JSON, one
+// object per result. Rows are written as they are read, so large locations
+// aren't held in memory.
+func ExportResultsNDJSON(db *sql.DB, locationSlug string, w io.Writer) error {
+	locationID, err := getLocationID(db, locationSlug)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`
+		SELECT e.event_number, e.date, r.position, r.name,
+			COALESCE(r.athlete_id, 0), COALESCE(r.time_seconds, 0), COALESCE(r.age_grade, ''),
+			COALESCE(r.age_category, ''), COALESCE(r.gender, ''), COALESCE(r.total_runs, 0),
+			COALESCE(r.note, '')
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		ORDER BY e.event_number, r.position`, locationID)
+	if err != nil {
+		return fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	// Encode adds the newline after each object
+	encoder := json.NewEncoder(w)
+	for rows.Next() {
+		record := ResultRecord{Location: locationSlug}
+		var date time.Time
+		if err := rows.Scan(&record.EventNumber, &date, &record.Position, &record.Name,
+			&record.AthleteID, &record.TimeSeconds, &record.AgeGrade, &record.AgeCategory,
+			&record.Gender, &record.TotalRuns, &record.Note); err != nil {
+			return fmt.Errorf("scan error: %v", err)
+		}
+		record.Date = date.Format("2006-01-02")
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("error writing result: %v", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading results: %v", err)
+	}
+	return nil
+}
+
+// resultsCSVHeader lists the columns written by ExportResultsCSV
+var resultsCSVHeader = []string{
+	"position", "name", "time_seconds", "formatted_time", "age_grade", "age_category",
+	"note", "total_runs", "event_number", "event_date", "unknown_runner",
+}
+
+// ExportResultsCSV writes every result at a location as CSV, ordered by event
+// and position. Unknown runners are kept, with unknown_runner set to "true".
+// Missing values, such as an untimed finish, are left empty rather than 0.
+func ExportResultsCSV(db *sql.DB, locationSlug string, w io.Writer) error {
+	locationID, err := getLocationID(db, locationSlug)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`
+		SELECT r.position, r.name, r.time_seconds, COALESCE(r.age_grade, ''),
+			COALESCE(r.age_category, ''), COALESCE(r.note, ''), r.total_runs,
+			e.event_number, e.date
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		ORDER BY e.event_number, r.position`, locationID)
+	if err != nil {
+		return fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	out := csv.NewWriter(w)
+	if err := out.Write(resultsCSVHeader); err != nil {
+		return fmt.Errorf("error writing results: %v", err)
+	}
+	for rows.Next() {
+		var position, eventNumber int
+		var name, ageGrade, ageCategory, note string
+		var timeSeconds, totalRuns sql.NullInt64
+		var date time.Time
+		if err := rows.Scan(&position, &name, &timeSeconds, &ageGrade, &ageCategory,
+			&note, &totalRuns, &eventNumber, &date); err != nil {
+			return fmt.Errorf("scan error: %v", err)
+		}
+
+		var seconds, formatted, runs string
+		if timeSeconds.Valid {
+			seconds = strconv.FormatInt(timeSeconds.Int64, 10)
+			formatted = secondsToTime(int(timeSeconds.Int64))
+		}
+		if totalRuns.Valid {
+			runs = strconv.FormatInt(totalRuns.Int64, 10)
+		}
+		err := out.Write([]string{
+			strconv.Itoa(position), name, seconds, formatted, ageGrade, ageCategory,
+			note, runs, strconv.Itoa(eventNumber), date.Format("2006-01-02"),
+			strconv.FormatBool(name == "Unknown"),
+		})
+		if err != nil {
+			return fmt.Errorf("error writing results: %v", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading results: %v", err)
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return fmt.Errorf("error writing results: %v", err)
+	}
+	return nil
+}
+
+// ReportTime is a time in a JSON report, both formatted and in seconds
+type ReportTime struct {
+	Time        string `json:"time"`
+	TimeSeconds int    `json:"time_seconds"`
+}
+
+// ReportJSON is a location's report for other tools to read
+type ReportJSON struct {
+	Location        string                  `json:"location"`
+	Meta            ReportMeta              `json:"meta"`
+	Stats           ReportStatsJSON         `json:"stats"`
+	TopParticipants []ReportParticipantJSON `json:"top_participants"`
+	AgeCategories   []ReportCategoryJSON    `json:"age_categories"`
+}
+
+// ReportStatsJSON is the location overview in a JSON report. Dates are YYYY-MM-DD.
+type ReportStatsJSON struct {
+	FirstEvent         string  `json:"first_event"`
+	LastEvent          string  `json:"last_event"`
+	TotalEvents        int     `json:"total_events"`
+	TotalRunners       int     `json:"total_runners"`
+	AvgParticipants    float64 `json:"avg_participants"`
+	BiggestEventDate   string  `json:"biggest_event_date"`
+	BiggestEventCount  int     `json:"biggest_event_count"`
+	SmallestEventDate  string  `json:"smallest_event_date"`
+	SmallestEventCount int     `json:"smallest_event_count"`
+}
+
+// ReportParticipantJSON is one of the location's most frequent runners
+type ReportParticipantJSON struct {
+	Name      string `json:"name"`
+	TotalRuns int    `json:"total_runs"`
+}
+
+// ReportCategoryJSON is an age category's median time
+type ReportCategoryJSON struct {
+	Category string     `json:"category"`
+	Count    int        `json:"count"`
+	Median   ReportTime `json:"median"`
+}
+
+// GenerateReportJSON returns the overview, top participants and age category
+// medians of a location's report as an indented JSON document
+func GenerateReportJSON(db *sql.DB, locationSlug string) ([]byte, error) {
+	locationID, err := getLocationID(db, locationSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	report := ReportJSON{Location: locationSlug}
+	report.Meta, err = reportMeta(db, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := GetLocationStats(db, locationID)
+	if err != nil {
+		return nil, err
+	}
+	report.Stats = ReportStatsJSON{
+		FirstEvent:         stats["first_event"].(time.Time).Format("2006-01-02"),
+		LastEvent:          stats["last_event"].(time.Time).Format("2006-01-02"),
+		TotalEvents:        stats["total_events"].(int),
+		TotalRunners:       stats["total_runners"].(int),
+		AvgParticipants:    stats["avg_participants"].(float64),
+		BiggestEventDate:   stats["biggest_event_date"].(time.Time).Format("2006-01-02"),
+		BiggestEventCount:  stats["biggest_event_count"].(int),
+		SmallestEventDate:  stats["smallest_event_date"].(time.Time).Format("2006-01-02"),
+		SmallestEventCount: stats["smallest_event_count"].(int),
+	}
+
+	// The same ten runners as the text report
+	runners, err := GetTopParticipants(db, locationID, 10)
+	if err != nil {
+		return nil, err
+	}
+	report.TopParticipants = []ReportParticipantJSON{}
+	for _, runner := range runners {
+		report.TopParticipants = append(report.TopParticipants, ReportParticipantJSON{Name: runner.Name, TotalRuns: runner.TotalRuns})
+	}
+
+	categories, err := GetMedianTimesByAgeCategory(db, locationID)
+	if err != nil {
+		return nil, err
+	}
+	report.AgeCategories = []ReportCategoryJSON{}
+	for _, category := range categories {
+		report.AgeCategories = append(report.AgeCategories, ReportCategoryJSON{
+			Category: category.Category,
+			Count:    category.Count,
+			Median:   ReportTime{Time: category.Median, TimeSeconds: category.MedianSeconds},
+		})
+	}
+
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding report: %v", err)
+	}
+	return encoded, nil
+}
+
+// icsText escapes text for an iCalendar property value
+func icsText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// icsUIDPart turns a runner's name into something safe to use in an event UID
+func icsUIDPart(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, name)
+}
+
+// BackupDatabase writes a consistent snapshot of the whole database to a new
+// SQLite file at destPath, which must not already exist
+func BackupDatabase(db *sql.DB, destPath string) error {
+	if _, err := os.Stat(destPath); err == nil {
+		return fmt.Errorf("backup destination %s already exists", destPath)
+	}
+	_, err := db.Exec(`VACUUM INTO ?`, destPath)
+	if err != nil {
+		return fmt.Errorf("error backing up database: %v", err)
+	}
+	return nil
+}
+
+// ReplaceBackup is BackupDatabase for a destPath that may already exist. The
+// snapshot goes to a temporary file in the same directory first, so an
+// existing backup is only replaced once the new one is complete.
+func ReplaceBackup(db *sql.DB, destPath string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(destPath), filepath.Base(destPath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary backup: %v", err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	// VACUUM INTO accepts an empty file
+	_, err = db.Exec(`VACUUM INTO ?`, tmpPath)
+	if err != nil {
+		return fmt.Errorf("error backing up database: %v", err)
+	}
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		return fmt.Errorf("error replacing backup: %v", err)
+	}
+	return nil
+}
+
+// sqlString quotes a string as a standard SQL literal, doubling any single quotes
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// sqlNullString quotes a nullable string, writing NULL when it is not set
+func sqlNullString(s sql.NullString) string {
+	if !s.Valid {
+		return "NULL"
+	}
+	return sqlString(s.String)
+}
+
+// sqlNullInt formats a nullable integer, writing NULL when it is not set
+func sqlNullInt(i sql.NullInt64) string {
+	if !i.Valid {
+		return "NULL"
+	}
+	return strconv.FormatInt(i.Int64, 10)
+}
+
+// WriteTourismGraph writes the runners shared between locations as a graph, in
+// JSON as a list of edges or in Graphviz DOT with the shared count as weight
+func WriteTourismGraph(db *sql.DB, format string, w io.Writer) error {
+	edges, err := GetTourismEdges(db)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		if edges == nil {
+			edges = []TourismEdge{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(edges); err != nil {
+			return fmt.Errorf("error writing graph: %v", err)
+		}
+	case "dot":
+		fmt.Fprintf(w, "graph tourism {\n")
+		for _, edge := range edges {
+			fmt.Fprintf(w, "  %s -- %s [weight=%d, label=\"%d\"];\n",
+				strconv.Quote(edge.From), strconv.Quote(edge.To), edge.SharedRunners, edge.SharedRunners)
+		}
+		fmt.Fprintf(w, "}\n")
+	default:
+		return fmt.Errorf("unknown format '%s' (use json or dot)", format)
+	}
+	return nil
+}
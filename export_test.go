@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDumpSQL(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	_, err := db.Exec(`
+		INSERT INTO results (position, name, time_seconds, event_id) VALUES 
+		(5, 'Liam O''Brien', NULL, 2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO runners (id, athlete_id, name, club, last_seen) VALUES (1, 1001, 'Runner A', 'Test Harriers', '2023-01-08');
+		UPDATE results SET athlete_id = 1001, runner_id = 1, gender = 'Male', gender_position = 1
+		WHERE event_id = 2 AND position = 3;
+		INSERT INTO volunteers (event_id, name, role) VALUES (2, 'Volunteer X', 'Timekeeper')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = DumpSQL(db, "test-park-1", &out)
+	if err != nil {
+		t.Fatalf("DumpSQL failed: %v", err)
+	}
+	dump := out.String()
+
+	for _, want := range []string{
+		"INSERT INTO locations (id, slug, name, country, distance_km",
+		"VALUES (1, 'test-park-1', NULL, 'AUS', 5",
+		"VALUES (2, 2, 1, '2023-01-08', 'http://example.com/2'",
+		"5, 'Liam O''Brien', NULL,",
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("Expected dump to contain %q, got:\n%s", want, dump)
+		}
+	}
+
+	// Only the requested location's data is included
+	if strings.Contains(dump, "Runner C") {
+		t.Errorf("Expected dump to exclude other locations, got:\n%s", dump)
+	}
+
+	// Replaying the dump into an empty database gives the same rows back
+	replay, replayCleanup := setupTestDB(t)
+	defer replayCleanup()
+	if _, err := replay.Exec(dump); err != nil {
+		t.Fatalf("Failed to replay dump: %v", err)
+	}
+	var name string
+	err = replay.QueryRow(`SELECT name FROM results WHERE position = 5`).Scan(&name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Liam O'Brien" {
+		t.Errorf("Expected replayed name Liam O'Brien, got %s", name)
+	}
+
+	var genderPosition int
+	var club, role string
+	err = replay.QueryRow(`
+		SELECT r.gender_position, ru.club, v.role
+		FROM results r
+		JOIN runners ru ON ru.id = r.runner_id
+		JOIN volunteers v ON v.event_id = r.event_id
+		WHERE r.event_id = 2 AND r.position = 3`).Scan(&genderPosition, &club, &role)
+	if err != nil {
+		t.Fatalf("Expected the runner, gender position and volunteer to be replayed: %v", err)
+	}
+	if genderPosition != 1 || club != "Test Harriers" || role != "Timekeeper" {
+		t.Errorf("Got gender position %d, club %q and role %q", genderPosition, club, role)
+	}
+}
+
+func TestBackupDatabase(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	destPath := filepath.Join(t.TempDir(), "backup.db")
+	if err := BackupDatabase(db, destPath); err != nil {
+		t.Fatalf("BackupDatabase failed: %v", err)
+	}
+
+	backup, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+
+	for _, table := range []string{"locations", "events", "results"} {
+		var want, got int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&want); err != nil {
+			t.Fatal(err)
+		}
+		if err := backup.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&got); err != nil {
+			t.Fatalf("Error reading %s from backup: %v", table, err)
+		}
+		if got != want {
+			t.Errorf("Expected %d %s in backup, got %d", want, table, got)
+		}
+	}
+
+	// An existing backup isn't overwritten
+	if err := BackupDatabase(db, destPath); err == nil {
+		t.Error("Expected an error when the destination exists")
+	}
+}
+
+func TestReplaceBackup(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	dir := t.TempDir()
+	destPath := filepath.Join(dir, "backup.db")
+	if err := os.WriteFile(destPath, []byte("old backup"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ReplaceBackup(db, destPath); err != nil {
+		t.Fatalf("ReplaceBackup failed: %v", err)
+	}
+	backup, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	var count int
+	if err := backup.QueryRow("SELECT COUNT(*) FROM results").Scan(&count); err != nil || count != 5 {
+		t.Errorf("Expected 5 results in the replaced backup, got %d (%v)", count, err)
+	}
+
+	// A failed backup leaves the old one alone and no temporary file behind
+	if err := os.WriteFile(destPath, []byte("old backup"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if err := ReplaceBackup(db, destPath); err == nil {
+		t.Error("Expected an error backing up a closed database")
+	}
+	if data, err := os.ReadFile(destPath); err != nil || string(data) != "old backup" {
+		t.Errorf("Expected the old backup to be kept, got %q (%v)", data, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the backup in %s, got %d files", dir, len(entries))
+	}
+}
+
+func TestExportRunnerICS(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// An untimed run still gets an event, just without a time
+	_, err := db.Exec(`
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES (4, 3, 1, '2023-01-15', 'http://example.com/4');
+		INSERT INTO results (position, name, time_seconds, event_id) VALUES (1, 'Runner A', NULL, 4)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := ExportRunnerICS(db, "test-park-1", "Runner A", &out); err != nil {
+		t.Fatalf("ExportRunnerICS failed: %v", err)
+	}
+	ics := out.String()
+
+	if !strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(ics, "END:VCALENDAR\r\n") {
+		t.Errorf("Expected a VCALENDAR block, got:\n%s", ics)
+	}
+	if got := strings.Count(ics, "BEGIN:VEVENT\r\n"); got != 3 {
+		t.Errorf("Expected 3 VEVENTs, got %d", got)
+	}
+	if got := strings.Count(ics, "END:VEVENT\r\n"); got != 3 {
+		t.Errorf("Expected 3 VEVENT ends, got %d", got)
+	}
+	for _, want := range []string{
+		"DTSTART;VALUE=DATE:20230101\r\n",
+		"DESCRIPTION:Finished in 20:00\\, position 1\r\n",
+		"DTSTART;VALUE=DATE:20230115\r\n",
+		"DESCRIPTION:Position 1\r\n",
+		"SUMMARY:test-park-1 parkrun #3\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("Expected ICS to contain %q, got:\n%s", want, ics)
+		}
+	}
+	if strings.Contains(ics, "Unknown") {
+		t.Errorf("Expected unknown times to be left out, got:\n%s", ics)
+	}
+
+	if err := ExportRunnerICS(db, "missing-park", "Runner A", &out); err == nil {
+		t.Error("Expected an error for an unknown location")
+	}
+}
+
+func TestExportResultsNDJSON(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// A name that needs escaping and a result without a time
+	_, err := db.Exec(`
+		INSERT INTO results (position, name, time_seconds, event_id) VALUES 
+		(5, 'Liam "Speedy" O''Brien', NULL, 2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := ExportResultsNDJSON(db, "test-park-1", &out); err != nil {
+		t.Fatalf("ExportResultsNDJSON failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	var stored int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM results r JOIN events e ON r.event_id = e.id WHERE e.location_id = 1`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != stored {
+		t.Fatalf("Expected %d lines, got %d:\n%s", stored, len(lines), out.String())
+	}
+
+	var records []ResultRecord
+	for i, line := range lines {
+		var record ResultRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Line %d is not valid JSON: %v\n%s", i+1, err, line)
+		}
+		records = append(records, record)
+	}
+
+	first := ResultRecord{Location: "test-park-1", EventNumber: 1, Date: "2023-01-01", Position: 1,
+		Name: "Runner A", TimeSeconds: 1200, AgeGrade: "65.5%", AgeCategory: "VM35-39", TotalRuns: 10}
+	if records[0] != first {
+		t.Errorf("First record = %+v, want %+v", records[0], first)
+	}
+	last := records[len(records)-1]
+	if last.Name != `Liam "Speedy" O'Brien` || last.EventNumber != 2 || last.TimeSeconds != 0 {
+		t.Errorf("Unexpected last record %+v", last)
+	}
+}
+
+func TestWriteTourismGraph(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	_, err := db.Exec(`
+		UPDATE results SET athlete_id = 1001 WHERE name = 'Runner A';
+		INSERT INTO results (position, name, time_seconds, event_id, athlete_id) VALUES 
+		(2, 'Runner A', 1250, 3, 1001)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dot bytes.Buffer
+	if err := WriteTourismGraph(db, "dot", &dot); err != nil {
+		t.Fatalf("WriteTourismGraph failed: %v", err)
+	}
+	want := "graph tourism {\n  \"test-park-1\" -- \"test-park-2\" [weight=1, label=\"1\"];\n}\n"
+	if dot.String() != want {
+		t.Errorf("DOT output = %q, want %q", dot.String(), want)
+	}
+
+	var out bytes.Buffer
+	if err := WriteTourismGraph(db, "json", &out); err != nil {
+		t.Fatalf("WriteTourismGraph failed: %v", err)
+	}
+	var edges []TourismEdge
+	if err := json.Unmarshal(out.Bytes(), &edges); err != nil {
+		t.Fatalf("Invalid JSON %q: %v", out.String(), err)
+	}
+	if len(edges) != 1 || edges[0] != (TourismEdge{From: "test-park-1", To: "test-park-2", SharedRunners: 1}) {
+		t.Errorf("Unexpected JSON edges %+v", edges)
+	}
+
+	if err := WriteTourismGraph(db, "csv", &out); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestGenerateReportJSON(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	encoded, err := GenerateReportJSON(db, "test-park-1")
+	if err != nil {
+		t.Fatalf("GenerateReportJSON failed: %v", err)
+	}
+
+	var report ReportJSON
+	if err := json.Unmarshal(encoded, &report); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%s", err, encoded)
+	}
+	if report.Stats.TotalEvents != 2 || report.Stats.FirstEvent != "2023-01-01" || report.Meta.LatestEvent != 2 {
+		t.Errorf("Unexpected stats: %+v %+v", report.Stats, report.Meta)
+	}
+	if len(report.TopParticipants) == 0 || report.TopParticipants[0] != (ReportParticipantJSON{Name: "Runner A", TotalRuns: 2}) {
+		t.Errorf("Expected Runner A first with 2 runs, got %+v", report.TopParticipants)
+	}
+	want := ReportCategoryJSON{Category: "VM35-39", Count: 3, Median: ReportTime{Time: "19:50", TimeSeconds: 1190}}
+	if len(report.AgeCategories) == 0 || report.AgeCategories[0] != want {
+		t.Errorf("Expected %+v first, got %+v", want, report.AgeCategories)
+	}
+
+	// Consumers rely on the field names
+	for _, field := range []string{`"top_participants"`, `"age_categories"`, `"time_seconds": 1190`, `"total_events": 2`} {
+		if !strings.Contains(string(encoded), field) {
+			t.Errorf("Expected %s in the report, got:\n%s", field, encoded)
+		}
+	}
+}
+
+func TestExportResultsCSV(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	_, err := db.Exec(`
+		INSERT INTO results (position, name, time_seconds, event_id) VALUES 
+		(5, 'Unknown', NULL, 2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := ExportResultsCSV(db, "test-park-1", &buf); err != nil {
+		t.Fatalf("ExportResultsCSV failed: %v", err)
+	}
+
+	want := `position,name,time_seconds,formatted_time,age_grade,age_category,note,total_runs,event_number,event_date,unknown_runner
+1,Runner A,1200,20:00,65.5%,VM35-39,,10,1,2023-01-01,false
+2,Runner B,1500,25:00,60.2%,VM40-44,,5,1,2023-01-01,false
+3,Runner A,1180,19:40,66.0%,VM35-39,,11,2,2023-01-08,false
+4,Runner D,1190,19:50,65.8%,VM35-39,,3,2,2023-01-08,false
+5,Unknown,,,,,,,2,2023-01-08,true
+`
+	if got := buf.String(); got != want {
+		t.Errorf("ExportResultsCSV() =\n%s\nwant\n%s", got, want)
+	}
+}
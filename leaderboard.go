@@ -0,0 +1,197 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// leaderboardSize is how many runners each cached leaderboard keeps
+const leaderboardSize = 10
+
+// LeaderboardEntry is one runner's place on a leaderboard. Value is a run
+// count for the participants board and a time in seconds for the fastest board.
+type LeaderboardEntry struct {
+	Rank  int    `json:"rank"`
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
+
+// Leaderboard holds a location's top-N lists and when they were computed
+type Leaderboard struct {
+	LocationID  int       `json:"location_id"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+	// MinAgeGrade is the lowest age grade counted in FastestTimes, 0 for every run
+	MinAgeGrade     float64            `json:"min_age_grade"`
+	TopParticipants []LeaderboardEntry `json:"top_participants"`
+	FastestTimes    []LeaderboardEntry `json:"fastest_times"`
+}
+
+// GetFastestRunners returns each runner's best time at a location, fastest
+// first, with runners grouped like GetTopParticipants. Only runs with an age
+// grade of at least minAgeGrade percent are counted, or every run if it's 0.
+func GetFastestRunners(db *sql.DB, locationID int, limit int, minAgeGrade float64) ([]LeaderboardEntry, error) {
+	rows, err := db.Query(`
+		SELECT
+			COALESCE(a.canonical, ru.name, r.name) as runner_name,
+			MIN(r.time_seconds) as best
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		LEFT JOIN aliases a ON a.location_id = e.location_id AND a.alias = r.name
+		LEFT JOIN runners ru ON ru.id = r.runner_id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.name != 'Unknown'
+		AND r.time_seconds > 0
+		AND (? <= 0 OR CAST(REPLACE(r.age_grade, '%', '') AS REAL) >= ?)
+		GROUP BY runner_name
+		ORDER BY best, runner_name
+		LIMIT ?`, locationID, minAgeGrade, minAgeGrade, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []LeaderboardEntry
+	for rows.Next() {
+		entry := LeaderboardEntry{Rank: len(entries) + 1}
+		if err := rows.Scan(&entry.Name, &entry.Value); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// computeLeaderboard runs the report queries behind a location's leaderboard,
+// counting only runs with an age grade of at least minAgeGrade in the fastest
+// times
+func computeLeaderboard(db *sql.DB, locationID int, minAgeGrade float64) (Leaderboard, error) {
+	board := Leaderboard{LocationID: locationID, MinAgeGrade: minAgeGrade}
+
+	runners, err := GetTopParticipants(db, locationID, leaderboardSize)
+	if err != nil {
+		return Leaderboard{}, err
+	}
+	for i, runner := range runners {
+		board.TopParticipants = append(board.TopParticipants, LeaderboardEntry{Rank: i + 1, Name: runner.Name, Value: runner.TotalRuns})
+	}
+
+	board.FastestTimes, err = GetFastestRunners(db, locationID, leaderboardSize, minAgeGrade)
+	if err != nil {
+		return Leaderboard{}, err
+	}
+	return board, nil
+}
+
+// RefreshLeaderboard recomputes a location's leaderboard and replaces its
+// cached copy in the leaderboard_cache table, which records minAgeGrade too
+func RefreshLeaderboard(db *sql.DB, locationID int, minAgeGrade float64) (Leaderboard, error) {
+	board, err := computeLeaderboard(db, locationID, minAgeGrade)
+	if err != nil {
+		return Leaderboard{}, err
+	}
+	board.RefreshedAt = clock.Now().UTC()
+
+	boards := map[string][]LeaderboardEntry{
+		"participants": board.TopParticipants,
+		"fastest":      board.FastestTimes,
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Leaderboard{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	for name, entries := range boards {
+		encoded, err := json.Marshal(entries)
+		if err != nil {
+			tx.Rollback()
+			return Leaderboard{}, fmt.Errorf("error encoding %s leaderboard: %v", name, err)
+		}
+		_, err = tx.Exec(`
+			INSERT OR REPLACE INTO leaderboard_cache (location_id, board, entries, refreshed_at, min_age_grade)
+			VALUES (?, ?, ?, ?, ?)`, locationID, name, string(encoded), board.RefreshedAt, board.MinAgeGrade)
+		if err != nil {
+			tx.Rollback()
+			return Leaderboard{}, fmt.Errorf("error caching %s leaderboard: %v", name, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Leaderboard{}, fmt.Errorf("error committing transaction: %v", err)
+	}
+	return board, nil
+}
+
+// GetCachedLeaderboard reads a location's leaderboard from the cache without
+// running the report queries. found is false if it has never been refreshed.
+func GetCachedLeaderboard(db *sql.DB, locationID int) (board Leaderboard, found bool, err error) {
+	rows, err := db.Query(`
+		SELECT board, entries, refreshed_at, min_age_grade
+		FROM leaderboard_cache
+		WHERE location_id = ?`, locationID)
+	if err != nil {
+		return Leaderboard{}, false, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	board.LocationID = locationID
+	for rows.Next() {
+		var name, encoded string
+		var refreshedAt time.Time
+		var minAgeGrade float64
+		if err := rows.Scan(&name, &encoded, &refreshedAt, &minAgeGrade); err != nil {
+			return Leaderboard{}, false, fmt.Errorf("scan error: %v", err)
+		}
+
+		var entries []LeaderboardEntry
+		if err := json.Unmarshal([]byte(encoded), &entries); err != nil {
+			return Leaderboard{}, false, fmt.Errorf("error decoding %s leaderboard: %v", name, err)
+		}
+		switch name {
+		case "participants":
+			board.TopParticipants = entries
+		case "fastest":
+			board.FastestTimes = entries
+		}
+		board.RefreshedAt = refreshedAt
+		board.MinAgeGrade = minAgeGrade
+		found = true
+	}
+	return board, found, nil
+}
+
+// LeaderboardHandler serves each location's cached leaderboard as JSON at
+// /leaderboard/<location-slug>, without running the report queries. A
+// location whose leaderboard has never been refreshed is not found.
+func LeaderboardHandler(db *sql.DB) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/leaderboard/", func(w http.ResponseWriter, r *http.Request) {
+		slug := strings.TrimPrefix(r.URL.Path, "/leaderboard/")
+		locationID, err := getLocationID(db, slug)
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		board, found, err := GetCachedLeaderboard(db, locationID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, fmt.Sprintf("no leaderboard cached for '%s', run refresh-leaderboard first", slug), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(board)
+	})
+	return mux
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRefreshLeaderboard(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	_, found, err := GetCachedLeaderboard(db, 1)
+	if err != nil {
+		t.Fatalf("GetCachedLeaderboard failed: %v", err)
+	}
+	if found {
+		t.Fatal("Expected no cached leaderboard before a refresh")
+	}
+
+	defer func(original Clock) { clock = original }(clock)
+	now := time.Date(2024, 1, 6, 9, 0, 0, 0, time.UTC)
+	clock = fixedClock(now)
+	refreshed, err := RefreshLeaderboard(db, 1, 0)
+	if err != nil {
+		t.Fatalf("RefreshLeaderboard failed: %v", err)
+	}
+
+	cached, found, err := GetCachedLeaderboard(db, 1)
+	if err != nil {
+		t.Fatalf("GetCachedLeaderboard failed: %v", err)
+	}
+	if !found {
+		t.Fatal("Expected a cached leaderboard after a refresh")
+	}
+	if !cached.RefreshedAt.Equal(now) || !refreshed.RefreshedAt.Equal(now) {
+		t.Errorf("Unexpected refresh time %v, refreshed at %v", cached.RefreshedAt, refreshed.RefreshedAt)
+	}
+
+	// The cached lists match running the queries now
+	live, err := computeLeaderboard(db, 1, 0)
+	if err != nil {
+		t.Fatalf("computeLeaderboard failed: %v", err)
+	}
+	live.RefreshedAt = cached.RefreshedAt
+	if !reflect.DeepEqual(cached, live) {
+		t.Errorf("Cached leaderboard %+v doesn't match live %+v", cached, live)
+	}
+
+	wantFastest := []LeaderboardEntry{
+		{Rank: 1, Name: "Runner A", Value: 1180},
+		{Rank: 2, Name: "Runner D", Value: 1190},
+		{Rank: 3, Name: "Runner B", Value: 1500},
+	}
+	if !reflect.DeepEqual(cached.FastestTimes, wantFastest) {
+		t.Errorf("Cached fastest times = %+v, want %+v", cached.FastestTimes, wantFastest)
+	}
+	if len(cached.TopParticipants) != 3 || cached.TopParticipants[0] != (LeaderboardEntry{Rank: 1, Name: "Runner A", Value: 2}) {
+		t.Errorf("Unexpected cached top participants %+v", cached.TopParticipants)
+	}
+}
+
+func TestLeaderboardHandler(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	handler := LeaderboardHandler(db)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get("/leaderboard/test-park-1"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 before a refresh, got %d", rec.Code)
+	}
+	if rec := get("/leaderboard/nowhere"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown location, got %d", rec.Code)
+	}
+
+	refreshed, err := RefreshLeaderboard(db, 1, 0)
+	if err != nil {
+		t.Fatalf("RefreshLeaderboard failed: %v", err)
+	}
+
+	// The handler reads the cache, so a later result doesn't show until the next refresh
+	_, err = db.Exec(`INSERT INTO results (event_id, position, name, time_seconds) VALUES (2, 5, 'Runner E', 1000)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := get("/leaderboard/test-park-1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var served Leaderboard
+	if err := json.Unmarshal(rec.Body.Bytes(), &served); err != nil {
+		t.Fatalf("Error decoding leaderboard: %v", err)
+	}
+	if !reflect.DeepEqual(served.FastestTimes, refreshed.FastestTimes) || !served.RefreshedAt.Equal(refreshed.RefreshedAt) {
+		t.Errorf("Served leaderboard %+v doesn't match the cached %+v", served, refreshed)
+	}
+}
+
+func TestGetFastestRunnersMinAgeGrade(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Runner A's 1200 (65.5%), Runner D's 1190 (65.8%) and Runner B's 1500 (60.2%) are below the minimum
+	fastest, err := GetFastestRunners(db, 1, leaderboardSize, 65.9)
+	if err != nil {
+		t.Fatalf("GetFastestRunners failed: %v", err)
+	}
+	want := []LeaderboardEntry{{Rank: 1, Name: "Runner A", Value: 1180}}
+	if !reflect.DeepEqual(fastest, want) {
+		t.Errorf("GetFastestRunners() = %+v, want %+v", fastest, want)
+	}
+
+	// The cache records the minimum it was refreshed with
+	if _, err := RefreshLeaderboard(db, 1, 65.9); err != nil {
+		t.Fatalf("RefreshLeaderboard failed: %v", err)
+	}
+	cached, _, err := GetCachedLeaderboard(db, 1)
+	if err != nil {
+		t.Fatalf("GetCachedLeaderboard failed: %v", err)
+	}
+	if cached.MinAgeGrade != 65.9 || !reflect.DeepEqual(cached.FastestTimes, want) {
+		t.Errorf("Expected the cache to hold %+v at a minimum of 65.9%%, got %+v", want, cached)
+	}
+}
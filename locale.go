@@ -0,0 +1,80 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locale holds the text a results page uses in a country's language, so run
+// counts and dates can be read from non-English parkrun sites
+type Locale struct {
+	// RunsWords follow a runner's total run count, like "parkruns" in "250 parkruns"
+	RunsWords []string
+	// DateFormats are tried before the English ones
+	DateFormats []string
+
+	runsPattern *regexp.Regexp
+}
+
+// newLocale builds a locale that also accepts the English words, which
+// non-English sites still use in places
+func newLocale(runsWords []string, dateFormats ...string) Locale {
+	words := append(append([]string{}, runsWords...), "parkruns", "parkrun")
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	// Ordinals like "1st" or "100." and a word boundary that allows non-ASCII letters
+	pattern := regexp.MustCompile(`(?i)(\d+)(?:st|nd|rd|th|\.)?\s+(?:` + strings.Join(quoted, "|") + `)(?:[^\pL\pN]|$)`)
+	return Locale{RunsWords: words, DateFormats: dateFormats, runsPattern: pattern}
+}
+
+// englishLocale is used for countries without their own locale
+var englishLocale = newLocale(nil)
+
+// locales holds the locale for each non-English country, keyed by ISO 3166-1
+// alpha-3 code
+var locales = map[string]Locale{
+	"AUT": newLocale([]string{"Läufe", "Lauf"}, "02.01.2006", "2.1.2006"),
+	"DEU": newLocale([]string{"Läufe", "Lauf"}, "02.01.2006", "2.1.2006"),
+	"DNK": newLocale([]string{"løb"}, "02-01-2006", "02.01.2006"),
+	"FIN": newLocale([]string{"parkrunia"}, "2.1.2006", "02.01.2006"),
+	"JPN": newLocale(nil, "2006/01/02", "2006/1/2"),
+	"NLD": newLocale(nil, "02-01-2006", "2-1-2006"),
+	"NOR": newLocale([]string{"løp"}, "02.01.2006", "2.1.2006"),
+	"POL": newLocale([]string{"parkrunów", "parkruny"}, "02.01.2006", "2.1.2006"),
+	"SWE": newLocale([]string{"lopp"}, "2006-01-02"),
+}
+
+// localeFor returns the locale for a country, falling back to English
+func localeFor(country string) Locale {
+	if locale, ok := locales[country]; ok {
+		return locale
+	}
+	return englishLocale
+}
+
+// parseTotalRuns gets a runner's total run count from a result's detail text,
+// returning 0 if there isn't one
+func (l Locale) parseTotalRuns(text string) int {
+	match := l.runsPattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0
+	}
+	totalRuns, _ := strconv.Atoi(match[1])
+	return totalRuns
+}
+
+// parseDate parses an event date in one of the locale's formats, falling back
+// to the English ones
+func (l Locale) parseDate(dateText string) (time.Time, error) {
+	trimmed := strings.TrimSpace(dateText)
+	for _, format := range l.DateFormats {
+		if date, err := time.Parse(format, trimmed); err == nil {
+			return date, nil
+		}
+	}
+	return parseEventDate(dateText)
+}
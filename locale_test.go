@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocaleParseTotalRuns(t *testing.T) {
+	tests := []struct {
+		country string
+		text    string
+		want    int
+	}{
+		{"POL", "57 parkrunów", 57},
+		{"POL", "3 parkruny", 3},
+		{"POL", "250 parkruns", 250},
+		{"DEU", "100. Lauf", 100},
+		{"DEU", "12 Läufe", 12},
+		{"SWE", "8 lopp", 8},
+		{"DEU", "12 Laufzeit", 0},
+		{"GBR", "250 parkruns", 250},
+		{"GBR", "12 Läufe", 0},
+		{"AUS", "3 parkrunners", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.country+" "+tt.text, func(t *testing.T) {
+			if got := localeFor(tt.country).parseTotalRuns(tt.text); got != tt.want {
+				t.Errorf("parseTotalRuns(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocaleParseDate(t *testing.T) {
+	want := time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		country  string
+		dateText string
+		wantErr  bool
+	}{
+		{"DEU", "06.01.2024", false},
+		{"POL", " 6.1.2024 ", false},
+		{"SWE", "2024-01-06", false},
+		{"DNK", "06-01-2024", false},
+		{"JPN", "2024/01/06", false},
+		// English formats still work everywhere
+		{"DEU", "06/01/2024", false},
+		{"AUS", "06.01.2024", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.country+" "+tt.dateText, func(t *testing.T) {
+			got, err := localeFor(tt.country).parseDate(tt.dateText)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(want) {
+				t.Errorf("parseDate() = %v, want %v", got, want)
+			}
+		})
+	}
+}
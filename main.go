@@ -1,199 +1,1626 @@
 package main
 
 import (
+	"bufio"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+var (
+	waitBetweenRequests = 10 * time.Second
+	rateLimitBackoff    = 180 * time.Second
+
+	// minSensibleDelay is the shortest --delay that's kind to parkrun's servers
+	minSensibleDelay = 5 * time.Second
+
+	// rateLimitStatuses are the HTTP statuses treated as rate limiting rather than errors
+	rateLimitStatuses = map[int]bool{405: true}
+)
+
+// dbPath is where the SQLite database is kept, set with --db
+var dbPath = "./parkrun.db"
 
 func main() {
+	if err := run(os.Args[1:]); err != nil {
+		log.Print(err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// run runs the command line and returns an error whose exit code says what
+// went wrong, see exitCode
+func run(arguments []string) error {
 	// Define commands
 	parseCmd := flag.NewFlagSet("parse", flag.ExitOnError)
 	clearData := parseCmd.Bool("clear", false, "Clear existing location data before parsing")
+	from := parseCmd.String("from", "", "Re-scrape from this event number or date (YYYY-MM-DD), skipping events that haven't changed")
+	to := parseCmd.String("to", "", "Stop after the last event on or before this date (YYYY-MM-DD)")
+	backfill := parseCmd.Bool("backfill", false, "Scrape backwards from before the earliest stored event to event 1")
+	yes := parseCmd.Bool("yes", false, "Start scraping without asking for confirmation")
+	noStore := parseCmd.Bool("no-store", false, "Scrape and print a summary without writing to the database")
+	insecure := parseCmd.Bool("insecure", false, "Skip TLS certificate verification (for testing only)")
+	socks5 := parseCmd.String("socks5", "", "Connect through a SOCKS5 proxy at host:port, e.g. Tor at 127.0.0.1:9050")
+	caCertPath := parseCmd.String("ca-cert", "", "PEM file of extra CA certificates to trust, e.g. for a mirror")
+	locationsPath := parseCmd.String("locations", defaultConfigPath, "Location config file")
+	country := parseCmd.String("country", "AUS", "ISO 3166-1 alpha-3 country code of the location, which also picks the site scraped")
+	domain := parseCmd.String("domain", "", "parkrun site to scrape, e.g. parkrun.org.uk. Remembered for later scrapes of the location.")
+	backoff := parseCmd.Duration("rate-limit-backoff", rateLimitBackoff, "How long to wait when rate limited and the server gives no Retry-After")
+	parseCmd.DurationVar(backoff, "backoff", rateLimitBackoff, "Short for --rate-limit-backoff")
+	workers := parseCmd.Int("workers", 1, "How many events to fetch at once. Requests are still spaced by --delay overall.")
+	delay := parseCmd.Duration("delay", waitBetweenRequests, fmt.Sprintf("Wait between requests to the results site. Don't go below %v, or parkrun is hammered and will rate limit you.", minSensibleDelay))
+	retryInitial := parseCmd.Duration("retry-initial", retryPolicy.InitialDelay, "Wait before retrying an event after a server or network error")
+	retryMax := parseCmd.Duration("retry-max", retryPolicy.MaxDelay, "Longest wait between retries after server or network errors")
+	retryMultiplier := parseCmd.Float64("retry-multiplier", retryPolicy.Multiplier, "How much the wait grows after each server or network error")
+	retryAttempts := parseCmd.Int("retry-attempts", retryPolicy.Attempts, "How many times to retry an event after server or network errors in a row")
+	rateLimit403429 := parseCmd.Bool("rate-limit-403-429", false, "Back off on HTTP 403 and 429 like a 405 rate limit")
+
+	reportCmd := flag.NewFlagSet("report", flag.ExitOnError)
+	allSections := reportCmd.Bool("all", false, "Print every report section, including the slower analyses")
+	reportJSON := reportCmd.Bool("json", false, "Print the overview, top participants and age category medians as JSON")
+	reportEvent := reportCmd.Int("event", 0, "Only list the runners at this event number who hadn't run at the location before")
+	sectionNames := reportCmd.String("sections", "", "Comma-separated optional sections to add to the report, e.g. plateaued,gender-gap")
+
+	matrixCmd := flag.NewFlagSet("matrix", flag.ExitOnError)
+	sortColumn := matrixCmd.String("sort", "name", "Column to sort by: name, events, participants, median or agegrade")
+
+	tourismCmd := flag.NewFlagSet("tourism", flag.ExitOnError)
+	graphFormat := tourismCmd.String("format", "json", "Output format: json or dot")
+
+	statusCmd := flag.NewFlagSet("status", flag.ExitOnError)
+	statusSort := statusCmd.String("sort", "name", "Sort by name, or stale to list the longest since an event first")
+
+	serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
+	serveAddr := serveCmd.String("addr", ":9100", "Address to serve /metrics and /leaderboard on")
+
+	checkCmd := flag.NewFlagSet("check", flag.ExitOnError)
+	checkLocationsPath := checkCmd.String("locations", defaultConfigPath, "Location config file")
+
+	excludeCmd := flag.NewFlagSet("exclude", flag.ExitOnError)
+	undo := excludeCmd.Bool("undo", false, "Include the event in reports again")
+
+	annotateCmd := flag.NewFlagSet("annotate", flag.ExitOnError)
+	annotateEvent := annotateCmd.Int("event", 0, "Event number to annotate")
+
+	aliasCmd := flag.NewFlagSet("alias", flag.ExitOnError)
+	canonical := aliasCmd.String("canonical", "", "The name to count the runner under")
+	also := aliasCmd.String("also", "", "Comma-separated other spellings of the name")
+
+	backupCmd := flag.NewFlagSet("backup", flag.ExitOnError)
+	force := backupCmd.Bool("force", false, "Overwrite the destination if it already exists")
+
+	runnerCmd := flag.NewFlagSet("runner", flag.ExitOnError)
+	runnerExact := runnerCmd.Bool("exact", false, "Match the whole runner name rather than any name containing it")
+
+	pointsCmd := flag.NewFlagSet("points", flag.ExitOnError)
+	since := pointsCmd.String("since", "", "Only count events on or after this date (YYYY-MM-DD)")
+	until := pointsCmd.String("until", "", "Only count events on or before this date (YYYY-MM-DD)")
+	scheme := pointsCmd.String("scheme", "", "Comma-separated points for each age-graded place, e.g. 10,8,6")
+
+	// Global flags come before the command
+	globalFlags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	globalFlags.StringVar(&dbPath, "db", dbPath, "Path to the SQLite database")
+	globalFlags.BoolVar(&quiet, "quiet", false, "Don't log the URL, status and size of each page fetched")
+	noColor := globalFlags.Bool("no-color", false, "Print reports without colour")
+	minAgeGrade := globalFlags.Float64("min-age-grade", 0, "Only count runs with at least this age grade percentage in club points and cached fastest times")
+	flagConfigPath := globalFlags.String("config", "", "JSON file of defaults for any flag, keyed by flag name")
+	globalFlags.Usage = printUsage
+	globalFlags.Parse(arguments)
+	args := append([]string{os.Args[0]}, globalFlags.Args()...)
+
+	// Flags from the config file fill in anything not given on the command line
+	if *flagConfigPath != "" {
+		flagConfig, err := LoadFlagConfig(*flagConfigPath)
+		if err != nil {
+			return err
+		}
+		err = applyFlagConfig(flagConfig, globalFlags, parseCmd, reportCmd, matrixCmd, tourismCmd, statusCmd, serveCmd, checkCmd, excludeCmd, annotateCmd, aliasCmd, backupCmd, pointsCmd, runnerCmd)
+		if err != nil {
+			return err
+		}
+	}
+
+	colorOutput = shouldColor(os.Stdout, *noColor)
+	if *minAgeGrade < 0 || *minAgeGrade > 100 {
+		return usageError(fmt.Errorf("invalid --min-age-grade %v, use a percentage from 0 to 100", *minAgeGrade))
+	}
+
+	// Check if we have enough arguments
+	if len(args) < 2 {
+		printUsage()
+		return errUsage
+	}
+
+	command := args[1]
+
+	switch command {
+	case "parse":
+		// Parse flags for the parse command
+		err := parseCmd.Parse(args[2:])
+		if err != nil {
+			return err
+		}
+
+		// Check if we have a location argument
+		if parseCmd.NArg() < 1 {
+			printUsage()
+			return errUsage
+		}
+
+		urlSlug := parseCmd.Arg(0)
+
+		// Allow flags after the slug too, e.g. parse <slug> --no-store
+		err = parseCmd.Parse(parseCmd.Args()[1:])
+		if err != nil {
+			return err
+		}
+
+		fromEvent, fromDate, err := parseFromFlag(*from)
+		if err != nil {
+			return usageError(err)
+		}
+		var toDate time.Time
+		if *to != "" {
+			toDate, err = time.Parse("2006-01-02", *to)
+			if err != nil {
+				return usageError(fmt.Errorf("invalid --to date '%s', use YYYY-MM-DD", *to))
+			}
+		}
+
+		locationConfigs, err = LoadLocationConfigs(*locationsPath)
+		if err != nil {
+			return err
+		}
+		if !isCountryCode(*country) {
+			return usageError(fmt.Errorf("invalid --country '%s', use an ISO 3166-1 alpha-3 code like GBR", *country))
+		}
+		if isFlagSet(parseCmd, "country") {
+			slug, qualified := splitLocation(urlSlug)
+			if qualified != "" && qualified != *country {
+				return usageError(fmt.Errorf("location %s conflicts with --country %s", urlSlug, *country))
+			}
+			urlSlug = slug + ":" + *country
+		}
+		if *domain != "" {
+			siteDomain := normaliseDomain(*domain)
+			if countryForDomain(siteDomain) == "" {
+				return usageError(fmt.Errorf("invalid --domain '%s', use a parkrun site like parkrun.org.uk", *domain))
+			}
+			setLocationDomain(urlSlug, siteDomain)
+		}
+
+		// Scrape into the location for the configured country unless one was given
+		if _, country := splitLocation(urlSlug); country == "" {
+			urlSlug += ":" + getLocationConfig(urlSlug).Country
+		}
+
+		httpClient, err = ScrapeConfig{CACertPath: *caCertPath, Insecure: *insecure, SOCKS5: *socks5}.NewHTTPClient()
+		if err != nil {
+			return err
+		}
+		if *insecure {
+			log.Printf("Warning: TLS certificate verification is disabled")
+		}
+
+		if *delay < 0 || *backoff < 0 {
+			return usageError(fmt.Errorf("invalid --delay or --backoff, durations can't be negative"))
+		}
+		if *delay < minSensibleDelay {
+			log.Printf("Warning: --delay %v is under %v and may get you rate limited", *delay, minSensibleDelay)
+		}
+		rateLimitBackoff = *backoff
+		waitBetweenRequests = *delay
+		if *retryMultiplier < 1 || *retryInitial < 0 || *retryMax < *retryInitial || *retryAttempts < 0 {
+			return usageError(fmt.Errorf("invalid retry policy, --retry-multiplier must be at least 1, --retry-max at least --retry-initial and --retry-attempts not negative"))
+		}
+		retryPolicy.InitialDelay = *retryInitial
+		retryPolicy.MaxDelay = *retryMax
+		retryPolicy.Multiplier = *retryMultiplier
+		retryPolicy.Attempts = *retryAttempts
+		if *workers < 1 {
+			return usageError(fmt.Errorf("invalid --workers %d, use 1 or more", *workers))
+		}
+		if *rateLimit403429 {
+			rateLimitStatuses[403] = true
+			rateLimitStatuses[429] = true
+		}
+
+		if *noStore && *backfill {
+			return usageError(fmt.Errorf("--backfill needs stored events, it can't be used with --no-store"))
+		}
+		ask := !*yes
+		if ask && !stdinIsTerminal() {
+			log.Printf("Not a terminal, scraping without asking to confirm")
+			ask = false
+		}
+		if ask && *backfill {
+			ok, err := askToScrape(os.Stdin, os.Stdout, lowestStoredEventNumber(urlSlug)-1)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				log.Printf("Scrape cancelled")
+				return nil
+			}
+		} else if ask {
+			startEvent := 1
+			if !*noStore && !*clearData {
+				startEvent = nextStoredEventNumber(urlSlug)
+			}
+			if !fromDate.IsZero() && !*noStore {
+				startEvent = storedEventNumberFromDate(urlSlug, fromDate)
+			}
+			if fromEvent > 0 {
+				startEvent = fromEvent
+			}
+			ok, err := confirmScrape(os.Stdin, os.Stdout, urlSlug, startEvent)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				log.Printf("Scrape cancelled")
+				return nil
+			}
+		}
+
+		options := ScrapeOptions{
+			Clear:     *clearData,
+			FromEvent: fromEvent,
+			FromDate:  fromDate,
+			ToDate:    toDate,
+			Backfill:  *backfill,
+			Workers:   *workers,
+		}
+		log.Printf("Starting parkrun scraper for %s...", urlSlug)
+		if *noStore {
+			summary := scrapeWithoutStoring(urlSlug, options)
+			printScrapeSummary(os.Stdout, urlSlug, summary)
+			return nil
+		}
+		_, err = parseAndStoreResults(urlSlug, options)
+		return err
+
+	case "report":
+		err := reportCmd.Parse(args[2:])
+		if err != nil {
+			return err
+		}
+		if reportCmd.NArg() != 1 {
+			printUsage()
+			return errUsage
+		}
+
+		sections, err := selectReportSections(strings.Split(*sectionNames, ","), *allSections)
+		if err != nil {
+			return err
+		}
+
+		if *reportEvent < 0 || (*reportEvent > 0 && *reportJSON) {
+			return usageError(fmt.Errorf("invalid --event %d, use a positive event number without --json", *reportEvent))
+		}
+
+		urlSlug := reportCmd.Arg(0)
+		db := connectDB()
+		defer db.Close()
+
+		if *reportEvent != 0 {
+			return PrintEventFirstTimers(db, urlSlug, *reportEvent)
+		}
+
+		if *reportJSON {
+			report, err := GenerateReportJSON(db, urlSlug)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(report))
+			return nil
+		}
+
+		log.Printf("Generating report for %s...", urlSlug)
+		err = PrintReports(db, urlSlug, sections)
+		if err != nil {
+			return err
+		}
+
+	case "compare":
+		if len(args) != 4 {
+			printUsage()
+			return errUsage
+		}
+
+		location1 := args[2]
+		location2 := args[3]
+
+		db := connectDB()
+		defer db.Close()
+
+		log.Printf("Generating comparison report for %s and %s...", location1, location2)
+		err := PrintComparisonReport(db, location1, location2)
+		if err != nil {
+			return err
+		}
+
+	case "matrix":
+		err := matrixCmd.Parse(args[2:])
+		if err != nil {
+			return err
+		}
+
+		db := connectDB()
+		defer db.Close()
+
+		err = PrintLocationMatrix(db, *sortColumn)
+		if err != nil {
+			return err
+		}
+
+	case "tourism":
+		err := tourismCmd.Parse(args[2:])
+		if err != nil {
+			return err
+		}
+
+		db := connectDB()
+		defer db.Close()
+
+		out := bufio.NewWriter(os.Stdout)
+		err = WriteTourismGraph(db, *graphFormat, out)
+		if err == nil {
+			err = out.Flush()
+		}
+		if err != nil {
+			return err
+		}
+
+	case "status":
+		err := statusCmd.Parse(args[2:])
+		if err != nil {
+			return err
+		}
+
+		db := connectDB()
+		defer db.Close()
+
+		err = PrintLocationStatus(db, *statusSort)
+		if err != nil {
+			return err
+		}
+
+	case "serve":
+		err := serveCmd.Parse(args[2:])
+		if err != nil {
+			return err
+		}
+
+		db := connectDB()
+		defer db.Close()
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", MetricsHandler(db))
+		mux.Handle("/leaderboard/", LeaderboardHandler(db))
+		log.Printf("Serving scrape metrics at http://%s/metrics and cached leaderboards at http://%s/leaderboard/<location-slug>", *serveAddr, *serveAddr)
+		err = http.ListenAndServe(*serveAddr, mux)
+		if err != nil {
+			return err
+		}
+
+	case "compare-for":
+		if len(args) != 5 {
+			printUsage()
+			return errUsage
+		}
+
+		runnerName := args[2]
+		location1 := args[3]
+		location2 := args[4]
+
+		db := connectDB()
+		defer db.Close()
+
+		log.Printf("Generating comparison report for %s at %s and %s...", runnerName, location1, location2)
+		err := PrintRunnerComparisonReport(db, runnerName, location1, location2)
+		if err != nil {
+			return err
+		}
+
+	case "totals":
+		if len(args) != 4 {
+			printUsage()
+			return errUsage
+		}
+
+		runnerName := args[2]
+		urlSlug := args[3]
+		db := connectDB()
+		defer db.Close()
+
+		err := PrintRunnerTotals(db, runnerName, urlSlug)
+		if err != nil {
+			return err
+		}
+
+	case "progression":
+		if len(args) != 4 {
+			printUsage()
+			return errUsage
+		}
+
+		runnerName := args[2]
+		urlSlug := args[3]
+		db := connectDB()
+		defer db.Close()
+
+		err := PrintRunnerAgeGradeProgression(db, runnerName, urlSlug)
+		if err != nil {
+			return err
+		}
+
+	case "pbs":
+		if len(args) != 4 {
+			printUsage()
+			return errUsage
+		}
+
+		runnerName := args[2]
+		urlSlug := args[3]
+		db := connectDB()
+		defer db.Close()
+
+		err := PrintRunnerPBEvents(db, runnerName, urlSlug)
+		if err != nil {
+			return err
+		}
+
+	case "profile":
+		if len(args) != 3 {
+			printUsage()
+			return errUsage
+		}
+
+		runner := args[2]
+		db := connectDB()
+		defer db.Close()
+
+		err := PrintGlobalRunnerProfile(db, runner)
+		if err != nil {
+			return err
+		}
+
+	case "runner":
+		err := runnerCmd.Parse(args[2:])
+		if err != nil {
+			return err
+		}
+		if runnerCmd.NArg() != 2 {
+			printUsage()
+			return errUsage
+		}
+
+		urlSlug := runnerCmd.Arg(0)
+		runnerName := runnerCmd.Arg(1)
+		db := connectDB()
+		defer db.Close()
+
+		err = PrintRunnerHistory(db, urlSlug, runnerName, *runnerExact)
+		if err != nil {
+			return err
+		}
+
+	case "categories":
+		if len(args) != 4 {
+			printUsage()
+			return errUsage
+		}
+
+		runnerName := args[2]
+		urlSlug := args[3]
+		db := connectDB()
+		defer db.Close()
+
+		err := PrintRunnerCategoryHistory(db, runnerName, urlSlug)
+		if err != nil {
+			return err
+		}
+
+	case "points":
+		err := pointsCmd.Parse(args[2:])
+		if err != nil {
+			return err
+		}
+		if pointsCmd.NArg() != 1 {
+			printUsage()
+			return errUsage
+		}
+
+		var fromDate, toDate time.Time
+		if *since != "" {
+			fromDate, err = time.Parse("2006-01-02", *since)
+			if err != nil {
+				return usageError(fmt.Errorf("invalid --since date %q", *since))
+			}
+		}
+		if *until != "" {
+			toDate, err = time.Parse("2006-01-02", *until)
+			if err != nil {
+				return usageError(fmt.Errorf("invalid --until date %q", *until))
+			}
+		}
+		if *scheme != "" {
+			clubPointsScheme, err = parsePointsScheme(*scheme)
+			if err != nil {
+				return err
+			}
+		}
+
+		db := connectDB()
+		defer db.Close()
+
+		err = PrintClubPoints(db, pointsCmd.Arg(0), fromDate, toDate, *minAgeGrade)
+		if err != nil {
+			return err
+		}
+
+	case "podium":
+		if len(args) != 4 {
+			printUsage()
+			return errUsage
+		}
+
+		urlSlug := args[2]
+		eventNumber, err := strconv.Atoi(args[3])
+		if err != nil {
+			return usageError(fmt.Errorf("invalid event number %q", args[3]))
+		}
+		db := connectDB()
+		defer db.Close()
+
+		err = PrintEventGenderPodium(db, urlSlug, eventNumber)
+		if err != nil {
+			return err
+		}
+
+	case "exclude":
+		err := excludeCmd.Parse(args[2:])
+		if err != nil {
+			return err
+		}
+		if excludeCmd.NArg() != 2 {
+			printUsage()
+			return errUsage
+		}
+
+		urlSlug := excludeCmd.Arg(0)
+		eventNumber, err := strconv.Atoi(excludeCmd.Arg(1))
+		if err != nil {
+			return usageError(fmt.Errorf("invalid event number %q", excludeCmd.Arg(1)))
+		}
+		db := connectDB()
+		defer db.Close()
+
+		err = SetEventExcluded(db, urlSlug, eventNumber, !*undo)
+		if err != nil {
+			return err
+		}
+		if *undo {
+			log.Printf("Event %d at %s is included in reports again", eventNumber, urlSlug)
+		} else {
+			log.Printf("Event %d at %s is now excluded from reports", eventNumber, urlSlug)
+		}
+
+	case "annotate":
+		err := annotateCmd.Parse(args[2:])
+		if err != nil {
+			return err
+		}
+		if annotateCmd.NArg() < 1 {
+			printUsage()
+			return errUsage
+		}
+		urlSlug := annotateCmd.Arg(0)
+
+		// Allow flags after the slug too, e.g. annotate <slug> --event 5 "note"
+		err = annotateCmd.Parse(annotateCmd.Args()[1:])
+		if err != nil {
+			return err
+		}
+		if annotateCmd.NArg() != 1 || *annotateEvent <= 0 {
+			printUsage()
+			return errUsage
+		}
+		note := annotateCmd.Arg(0)
+
+		db := connectDB()
+		defer db.Close()
+
+		err = SetEventNote(db, urlSlug, *annotateEvent, note)
+		if err != nil {
+			return err
+		}
+		if note == "" {
+			log.Printf("Removed the note from event %d at %s", *annotateEvent, urlSlug)
+		} else {
+			log.Printf("Event %d at %s noted: %s", *annotateEvent, urlSlug, note)
+		}
+
+	case "alias":
+		err := aliasCmd.Parse(args[2:])
+		if err != nil {
+			return err
+		}
+		if aliasCmd.NArg() < 1 {
+			printUsage()
+			return errUsage
+		}
+		urlSlug := aliasCmd.Arg(0)
+
+		// Allow flags after the slug too, e.g. alias <slug> --canonical "Jane SMITH"
+		err = aliasCmd.Parse(aliasCmd.Args()[1:])
+		if err != nil {
+			return err
+		}
+		var aliases []string
+		for _, name := range strings.Split(*also, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				aliases = append(aliases, name)
+			}
+		}
+		if aliasCmd.NArg() != 0 || *canonical == "" || len(aliases) == 0 {
+			printUsage()
+			return errUsage
+		}
+
+		db := connectDB()
+		defer db.Close()
+
+		err = AddAliases(db, urlSlug, *canonical, aliases)
+		if err != nil {
+			return err
+		}
+		log.Printf("%s at %s is now also counted as %s", *canonical, urlSlug, strings.Join(aliases, ", "))
+
+	case "check":
+		err := checkCmd.Parse(args[2:])
+		if err != nil {
+			return err
+		}
+		if checkCmd.NArg() < 1 {
+			printUsage()
+			return errUsage
+		}
+
+		locationConfigs, err = LoadLocationConfigs(*checkLocationsPath)
+		if err != nil {
+			return err
+		}
+
+		checks := checkLocations(checkCmd.Args())
+		printLocationChecks(os.Stdout, checks)
+		return locationChecksError(checks)
+
+	case "events":
+		if len(args) != 3 {
+			printUsage()
+			return errUsage
+		}
+
+		if countryForDomain(normaliseDomain(args[2])) == "" {
+			return usageError(fmt.Errorf("invalid domain '%s', use a parkrun site like parkrun.org.uk", args[2]))
+		}
+		slugs, err := ListEventsForCountry(args[2])
+		if err != nil {
+			return err
+		}
+		for _, slug := range slugs {
+			fmt.Println(slug)
+		}
+
+	case "verify":
+		if len(args) != 3 {
+			printUsage()
+			return errUsage
+		}
+
+		urlSlug := args[2]
+		db := connectDB()
+		defer db.Close()
+
+		err := PrintVerifyReport(db, urlSlug)
+		if err != nil {
+			return err
+		}
+
+	case "dump-sql":
+		if len(args) != 3 {
+			printUsage()
+			return errUsage
+		}
 
-	// Check if we have enough arguments
-	if len(os.Args) < 2 {
-		printUsage()
-		os.Exit(1)
-	}
+		urlSlug := args[2]
+		db := connectDB()
+		defer db.Close()
 
-	command := os.Args[1]
+		err := DumpSQL(db, urlSlug, os.Stdout)
+		if err != nil {
+			return err
+		}
 
-	switch command {
-	case "parse":
-		// Parse flags for the parse command
-		err := parseCmd.Parse(os.Args[2:])
+	case "export":
+		if len(args) != 3 {
+			printUsage()
+			return errUsage
+		}
+
+		urlSlug := args[2]
+		db := connectDB()
+		defer db.Close()
+
+		out := bufio.NewWriter(os.Stdout)
+		err := ExportResultsCSV(db, urlSlug, out)
+		if err == nil {
+			err = out.Flush()
+		}
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
-		// Check if we have a location argument
-		if parseCmd.NArg() < 1 {
+	case "export-ndjson":
+		if len(args) != 3 {
 			printUsage()
-			os.Exit(1)
+			return errUsage
 		}
 
-		urlSlug := parseCmd.Arg(0)
-		log.Printf("Starting parkrun scraper for %s...", urlSlug)
-		parseAndStoreResults(urlSlug, *clearData)
+		urlSlug := args[2]
+		db := connectDB()
+		defer db.Close()
 
-	case "report":
-		if len(os.Args) < 3 {
+		out := bufio.NewWriter(os.Stdout)
+		err := ExportResultsNDJSON(db, urlSlug, out)
+		if err == nil {
+			err = out.Flush()
+		}
+		if err != nil {
+			return err
+		}
+
+	case "calendar":
+		if len(args) != 4 {
 			printUsage()
-			os.Exit(1)
+			return errUsage
 		}
 
-		urlSlug := os.Args[2]
+		urlSlug := args[2]
+		runnerName := args[3]
 		db := connectDB()
 		defer db.Close()
 
-		log.Printf("Generating report for %s...", urlSlug)
-		err := PrintReports(db, urlSlug)
+		err := ExportRunnerICS(db, urlSlug, runnerName, os.Stdout)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
-	case "compare":
-		if len(os.Args) != 4 {
+	case "backup":
+		err := backupCmd.Parse(args[2:])
+		if err != nil {
+			return err
+		}
+		if backupCmd.NArg() != 1 {
 			printUsage()
-			os.Exit(1)
+			return errUsage
 		}
 
-		location1 := os.Args[2]
-		location2 := os.Args[3]
+		destPath := backupCmd.Arg(0)
+		db := connectDB()
+		defer db.Close()
+
+		if *force {
+			err = ReplaceBackup(db, destPath)
+		} else {
+			err = BackupDatabase(db, destPath)
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Backed up %s to %s", dbPath, destPath)
+
+	case "refresh-leaderboard":
+		if len(args) != 3 {
+			printUsage()
+			return errUsage
+		}
 
+		urlSlug := args[2]
 		db := connectDB()
 		defer db.Close()
 
-		log.Printf("Generating comparison report for %s and %s...", location1, location2)
-		err := PrintComparisonReport(db, location1, location2)
+		locationID, err := getLocationID(db, urlSlug)
+		if err != nil {
+			return err
+		}
+		board, err := RefreshLeaderboard(db, locationID, *minAgeGrade)
+		if err != nil {
+			return err
+		}
+		log.Printf("Cached leaderboard for %s at %s: %d top participants, %d fastest times",
+			urlSlug, board.RefreshedAt.Local().Format("2006-01-02 15:04"), len(board.TopParticipants), len(board.FastestTimes))
+
+	case "history":
+		if len(args) != 3 {
+			printUsage()
+			return errUsage
+		}
+
+		urlSlug := args[2]
+		db := connectDB()
+		defer db.Close()
+
+		err := PrintScrapeHistory(db, urlSlug)
+		if err != nil {
+			return err
+		}
+
+	case "rebuild":
+		if len(args) > 3 {
+			printUsage()
+			return errUsage
+		}
+
+		backupPath := dbPath + ".backup-" + time.Now().Format("20060102-150405")
+		if len(args) == 3 {
+			backupPath = args[2]
+		}
+
+		db := connectDB()
+		defer db.Close()
+
+		err := RebuildDatabase(db, backupPath)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
+		log.Printf("Rebuilt %s with the latest schema. The old data is backed up in %s", dbPath, backupPath)
 
 	default:
 		printUsage()
-		os.Exit(1)
+		return errUsage
 	}
+	return nil
 }
 
 func printUsage() {
-	fmt.Println("Commands:")
-	fmt.Println("  Parse:    parkrun parse [--clear] <parkrun-slug>")
-	fmt.Println("  Report:   parkrun report <parkrun-slug>")
+	fmt.Println("Usage: parkrun [--db <path>] [--config <file.json>] [--quiet] [--no-color] [--min-age-grade <percent>] <command> [arguments]")
+	fmt.Println("\nCommands:")
+	fmt.Println("  Parse:    parkrun parse [flags] <parkrun-slug>")
+	fmt.Println("  Report:   parkrun report [--all] [--sections plateaued,gender-gap] [--event <event-number>] <parkrun-slug>")
 	fmt.Println("  Compare:  parkrun compare <parkrun-slug1> <parkrun-slug2>")
+	fmt.Println("  Matrix:   parkrun matrix [--sort name|events|participants|median|agegrade]")
+	fmt.Println("  Status:   parkrun status [--sort name|stale]")
+	fmt.Println("  Tourism:  parkrun tourism [--format json|dot]")
+	fmt.Println("  Serve:    parkrun serve [--addr :9100]")
+	fmt.Println("  Compare for runner:  parkrun compare-for <runner-name> <parkrun-slug1> <parkrun-slug2>")
+	fmt.Println("  Totals:   parkrun totals <runner-name> <parkrun-slug>")
+	fmt.Println("  Progression: parkrun progression <runner-name> <parkrun-slug>")
+	fmt.Println("  PBs:      parkrun pbs <runner-name> <parkrun-slug>")
+	fmt.Println("  Runner:   parkrun runner [--exact] <parkrun-slug> <runner-name>")
+	fmt.Println("  Profile:  parkrun profile <runner-name|athlete-id>")
+	fmt.Println("  Categories: parkrun categories <runner-name> <parkrun-slug>")
+	fmt.Println("  Points:   parkrun points [--since YYYY-MM-DD] [--until YYYY-MM-DD] [--scheme 10,8,6] <parkrun-slug>")
+	fmt.Println("  Podium:   parkrun podium <parkrun-slug> <event-number>")
+	fmt.Println("  Exclude:  parkrun exclude [--undo] <parkrun-slug> <event-number>")
+	fmt.Println("  Annotate: parkrun annotate <parkrun-slug> --event <event-number> \"<note>\"")
+	fmt.Println("  Alias:    parkrun alias <parkrun-slug> --canonical \"<name>\" --also \"<name>,<name>\"")
+	fmt.Println("  Verify:   parkrun verify <parkrun-slug>")
+	fmt.Println("  Check:    parkrun check [--locations locations.json] <parkrun-slug> [<parkrun-slug>...]")
+	fmt.Println("  Events:   parkrun events <country-domain, e.g. parkrun.org.uk>")
+	fmt.Println("  History:  parkrun history <parkrun-slug>")
+	fmt.Println("  Leaderboard cache: parkrun refresh-leaderboard <parkrun-slug>")
+	fmt.Println("  Dump SQL: parkrun dump-sql <parkrun-slug>")
+	fmt.Println("  CSV:      parkrun export <parkrun-slug> > results.csv")
+	fmt.Println("  NDJSON:   parkrun export-ndjson <parkrun-slug> > results.ndjson")
+	fmt.Println("  Calendar: parkrun calendar <parkrun-slug> <runner-name> > runs.ics")
+	fmt.Println("  Backup:   parkrun backup [--force] <out.db>")
+	fmt.Println("  Rebuild:  parkrun rebuild [backup.db]")
 	fmt.Println("\nFlags for parse command:")
 	fmt.Println("  --clear    Clear existing location data before parsing")
+	fmt.Println("  --backfill Scrape backwards from before the earliest stored event to event 1")
+	fmt.Println("  --from     Re-scrape from this event number or date (YYYY-MM-DD), skipping events that haven't changed")
+	fmt.Println("  --to       Stop after the last event on or before this date (YYYY-MM-DD)")
+	fmt.Println("  --no-store Scrape and print a summary without writing to the database")
+	fmt.Println("  --yes      Start without asking to confirm how many events will be fetched")
+	fmt.Println("  --rate-limit-403-429  Back off on HTTP 403 and 429 like a 405 rate limit")
+	fmt.Println("  --rate-limit-backoff, --backoff  Wait when rate limited without a Retry-After (default 3m0s)")
+	fmt.Println("  --delay    Wait between requests (default 10s). Keep it at 5s or more to avoid hammering parkrun.")
+	fmt.Println("  --locations  Location config file (default locations.json)")
+	fmt.Println("  --ca-cert  PEM file of extra CA certificates to trust, e.g. for a mirror")
+	fmt.Println("  --insecure Skip TLS certificate verification (for testing only)")
+	fmt.Println("  --socks5   Connect through a SOCKS5 proxy at host:port, e.g. Tor at 127.0.0.1:9050")
+	fmt.Println("\nGlobal flags:")
+	fmt.Println("  --db       Path to the SQLite database (default ./parkrun.db)")
+	fmt.Println("  --config   JSON file of defaults for any flag, keyed by flag name. Flags given on the command line win.")
+	fmt.Println("  --no-color Print reports without colour. Colour is also off when output isn't a terminal or NO_COLOR is set.")
+	fmt.Println("  --quiet    Don't log the URL, status and size of each page fetched")
+	fmt.Println("  --min-age-grade  Only count runs with at least this age grade percentage (e.g. 70) in club points and cached fastest times")
 	fmt.Println("\nExamples:")
 	fmt.Println("  parkrun parse oaklandsestatereserve")
 	fmt.Println("  parkrun report oaklandsestatereserve")
 	fmt.Println("  parkrun compare bushy westerfolds")
+	fmt.Println("  parkrun compare-for \"Jane Smith\" bushy westerfolds")
+}
+
+// nextStoredEventNumber returns the event a scrape of the location would resume from
+func nextStoredEventNumber(urlSlug string) int {
+	db := connectDB()
+	defer db.Close()
+
+	// A location that hasn't been scraped yet starts from the beginning
+	locationID, err := getLocationID(db, urlSlug)
+	if err != nil {
+		return 1
+	}
+	return GetNextEventNumber(db, locationID)
+}
+
+// storedEventNumberFromDate returns the event a scrape from date will start at
+func storedEventNumberFromDate(urlSlug string, date time.Time) int {
+	db := connectDB()
+	defer db.Close()
+
+	locationID, err := getLocationID(db, urlSlug)
+	if err != nil {
+		return 1
+	}
+	return GetEventNumberFromDate(db, locationID, date)
+}
+
+// parseFromFlag reads --from as either an event number or a YYYY-MM-DD date
+func parseFromFlag(value string) (int, time.Time, error) {
+	if value == "" {
+		return 0, time.Time{}, nil
+	}
+	if eventNumber, err := strconv.Atoi(value); err == nil {
+		return eventNumber, time.Time{}, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("invalid --from '%s', use an event number or YYYY-MM-DD", value)
+	}
+	return 0, date, nil
+}
+
+// lowestStoredEventNumber returns the earliest event stored for a location, or 0 if there are none
+func lowestStoredEventNumber(urlSlug string) int {
+	db := connectDB()
+	defer db.Close()
+
+	locationID, err := getLocationID(db, urlSlug)
+	if err != nil {
+		return 0
+	}
+	return GetLowestEventNumber(db, locationID)
+}
+
+// confirmScrape says how many events a scrape from startEvent will fetch and
+// how long it should take, and asks whether to go ahead. If the latest event
+// can't be found it carries on without asking.
+func confirmScrape(in io.Reader, out io.Writer, urlSlug string, startEvent int) (bool, error) {
+	slug, _ := splitLocation(urlSlug)
+	latestEvent, err := checkLocationAt(getLocationConfig(urlSlug).BaseURL, slug)
+	if err != nil {
+		log.Printf("Warning: could not find the latest event for %s: %v", urlSlug, err)
+		return true, nil
+	}
+
+	count := latestEvent - startEvent + 1
+	if count <= 0 {
+		fmt.Fprintf(out, "Already up to date with event %d.\n", latestEvent)
+		return false, nil
+	}
+	return askToScrape(in, out, count)
+}
+
+// LocationCheck is the result of checking a location exists on its results site
+type LocationCheck struct {
+	Location    string
+	LatestEvent int
+	Err         error
+}
+
+// checkLocations looks up the latest event of each location with one fetch of
+// its latest results page, waiting between requests like a scrape. Nothing is
+// stored.
+func checkLocations(locations []string) []LocationCheck {
+	var checks []LocationCheck
+	for i, location := range locations {
+		if i > 0 {
+			time.Sleep(waitBetweenRequests)
+		}
+		slug, _ := splitLocation(location)
+		latestEvent, err := checkLocationAt(getLocationConfig(location).BaseURL, slug)
+		checks = append(checks, LocationCheck{Location: location, LatestEvent: latestEvent, Err: err})
+	}
+	return checks
+}
+
+// printLocationChecks prints one line per location saying whether it was found
+func printLocationChecks(w io.Writer, checks []LocationCheck) {
+	for _, check := range checks {
+		if check.Err != nil {
+			fmt.Fprintf(w, "%s: error: %v\n", check.Location, check.Err)
+			continue
+		}
+		fmt.Fprintf(w, "%s: OK, latest event #%d\n", check.Location, check.LatestEvent)
+	}
+}
+
+// locationChecksError returns an error wrapping the first failed check, if any
+// failed. A location missing from its site (HTTP 404) counts as not found.
+func locationChecksError(checks []LocationCheck) error {
+	failed := 0
+	var first error
+	for _, check := range checks {
+		if check.Err != nil {
+			failed++
+			if first == nil {
+				first = check.Err
+			}
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	var httpErr *HTTPError
+	if errors.As(first, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%d of %d locations failed the check, e.g. %w: %w", failed, len(checks), ErrNotFound, first)
+	}
+	return fmt.Errorf("%d of %d locations failed the check: %w", failed, len(checks), first)
+}
+
+// askToScrape asks whether to go ahead with fetching count events. Running out
+// of input before an answer is a usage error, so a script that forgot --yes
+// fails rather than quietly doing nothing.
+func askToScrape(in io.Reader, out io.Writer, count int) (bool, error) {
+	if count <= 0 {
+		fmt.Fprintf(out, "No events to fetch.\n")
+		return false, nil
+	}
+	fmt.Fprintf(out, "About to fetch %d events (~%d minutes). Continue? [y/N] ",
+		count, estimateScrapeMinutes(count, waitBetweenRequests))
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if err != nil && answer == "" {
+		return false, usageError(fmt.Errorf("no answer to continue, pass --yes to scrape without asking"))
+	}
+	return answer == "y" || answer == "yes", nil
+}
+
+// stdinIsTerminal reports whether stdin is a terminal rather than a pipe or
+// file, as it is when run from cron
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
-func parseAndStoreResults(urlSlug string, clearData bool) {
+// estimateScrapeMinutes estimates how many minutes fetching count events takes
+// with wait between requests, rounded up
+func estimateScrapeMinutes(count int, wait time.Duration) int {
+	total := time.Duration(count) * wait
+	return int((total + time.Minute - 1) / time.Minute)
+}
+
+// parseAndStoreResults scrapes a location into the database and prints how
+// many events and results were added and skipped, which it also returns
+func parseAndStoreResults(urlSlug string, options ScrapeOptions) (ScrapeResult, error) {
 	db := connectDB()
 	defer db.Close()
 
+	startedAt := time.Now()
+	result, err := Scrape(db, urlSlug, options)
+	if err != nil {
+		return ScrapeResult{}, err
+	}
+	log.Printf("Scrape of %s finished in %v", urlSlug, time.Since(startedAt).Round(time.Second))
+	printScrapeResult(os.Stdout, urlSlug, result)
+	return result, scrapeError(result)
+}
+
+// StopReason describes why a scrape finished
+type StopReason string
+
+const (
+	StopEndOfEvents   StopReason = "reached end of events"
+	StopTooManyErrors StopReason = "too many consecutive errors"
+	StopPending       StopReason = "results not published yet"
+	StopPastDateRange StopReason = "passed the end of the date range"
+)
+
+// ScrapeOptions controls which events a scrape fetches
+type ScrapeOptions struct {
+	// Clear removes the location's existing data first
+	Clear bool
+	// FromEvent re-scrapes from this event number instead of the next new one
+	FromEvent int
+	// FromDate and ToDate limit the scrape to events in a date range. Events
+	// before FromDate aren't stored and the scrape stops after ToDate. Either
+	// can be zero.
+	FromDate time.Time
+	ToDate   time.Time
+	// Backfill scrapes downwards from before the earliest stored event to event 1
+	Backfill bool
+	// Workers is how many events are fetched at once. The delay between
+	// requests is shared, so more workers doesn't mean more load on the site.
+	Workers int
+}
+
+// ScrapeResult records what happened during a scrape
+type ScrapeResult struct {
+	EventsStored    int
+	ResultsStored   int
+	EventsSkipped   int
+	EventsUnchanged int
+	// RowsSkipped counts result rows the parser couldn't use, by reason
+	RowsSkipped ParseStats
+	Errors      int
+	StopReason  StopReason
+	// Set on the runs Scrape records to its history
+	LocationID int
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// errEventUnchanged is returned by a scrape handler for an event that is
+// already stored with the same results
+var errEventUnchanged = errors.New("event unchanged")
+
+// scraper returns the scrape loop for options, fetching with several workers
+// if more than one is asked for
+func (options ScrapeOptions) scraper() func(config LocationConfig, urlSlug string, startEvent, step int, handle func(Event, []Result) (int, error)) ScrapeResult {
+	if options.Workers <= 1 {
+		return scrapeEvents
+	}
+	return func(config LocationConfig, urlSlug string, startEvent, step int, handle func(Event, []Result) (int, error)) ScrapeResult {
+		return scrapeEventsConcurrently(config, urlSlug, startEvent, step, options.Workers, handle)
+	}
+}
+
+// checkDateRange returns errBeforeDateRange or errPastDateRange for an event
+// outside the options' dates
+func (options ScrapeOptions) checkDateRange(event Event) error {
+	if !options.FromDate.IsZero() && event.Date.Before(options.FromDate) {
+		return errBeforeDateRange
+	}
+	if !options.ToDate.IsZero() && event.Date.After(options.ToDate) {
+		return errPastDateRange
+	}
+	return nil
+}
+
+// errBeforeDateRange and errPastDateRange are returned by a scrape handler for
+// events outside the date range being scraped
+var (
+	errBeforeDateRange = errors.New("event before date range")
+	errPastDateRange   = errors.New("event past date range")
+)
+
+// Scrape fetches all new events for a location and stores them in the database
+func Scrape(db *sql.DB, urlSlug string, options ScrapeOptions) (ScrapeResult, error) {
 	CreateTables(db)
+	startedAt := clock.Now()
+
+	// The same slug can be used in several countries, so the location is
+	// identified by both
+	slug, _ := splitLocation(urlSlug)
+	config := getLocationConfig(urlSlug)
+	location := slug + ":" + config.Country
 
 	// Clear existing data if requested
-	if clearData {
-		err := ClearLocationData(db, urlSlug)
+	if options.Clear {
+		err := ClearLocationData(db, location)
 		if err != nil {
-			log.Fatal("Failed to clear existing data:", err)
+			return ScrapeResult{}, fmt.Errorf("failed to clear existing data: %v", err)
 		}
-		log.Printf("Cleared existing data for %s", urlSlug)
+		log.Printf("Cleared existing data for %s", location)
+	}
+
+	var name interface{}
+	if config.Name != "" {
+		name = config.Name
 	}
 
 	// Insert or get location
 	var locationID int
 	err := db.QueryRow(`
-		INSERT OR IGNORE INTO locations (slug, country) 
-		VALUES (?, ?) 
-		RETURNING id`, urlSlug, "AUS").Scan(&locationID)
+		INSERT OR IGNORE INTO locations (slug, name, country, distance_km, domain) 
+		VALUES (?, ?, ?, ?, ?) 
+		RETURNING id`, slug, name, config.Country, config.DistanceKm, config.Domain).Scan(&locationID)
 
 	if err != nil {
 		// If insert didn't return id, get the existing one
 		err = db.QueryRow(`
 			SELECT id FROM locations 
-			WHERE slug = ?`, urlSlug).Scan(&locationID)
+			WHERE slug = ? AND country = ?`, slug, config.Country).Scan(&locationID)
 		if err != nil {
-			log.Fatal("Failed to get location ID:", err)
+			return ScrapeResult{}, fmt.Errorf("failed to get location ID: %v", err)
 		}
 	}
 	log.Printf("Using location ID: %d", locationID)
 
+	// Later scrapes use the domain the location was stored with, unless
+	// config or --domain gives another, which is then stored instead
+	var storedDomain sql.NullString
+	err = db.QueryRow(`SELECT domain FROM locations WHERE id = ?`, locationID).Scan(&storedDomain)
+	if err != nil {
+		return ScrapeResult{}, fmt.Errorf("failed to get location domain: %v", err)
+	}
+	if storedDomain.String != "" && !configuresSite(location) {
+		config.Domain = storedDomain.String
+		config.BaseURL = baseURLForDomain(config.Domain)
+	} else if storedDomain.String != config.Domain {
+		_, err = db.Exec(`UPDATE locations SET domain = ? WHERE id = ?`, config.Domain, locationID)
+		if err != nil {
+			return ScrapeResult{}, fmt.Errorf("failed to store location domain: %v", err)
+		}
+	}
+
+	// Every run is recorded, even one with nothing to fetch
+	finish := func(result ScrapeResult) (ScrapeResult, error) {
+		run := result
+		run.LocationID = locationID
+		run.StartedAt = startedAt
+		run.FinishedAt = clock.Now()
+		if err := RecordScrapeRun(db, &run); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		return result, nil
+	}
+
 	//  Database might be non-empty, so start from the next event number.
 	eventID := GetNextEventNumber(db, locationID)
+	step := 1
+	if !options.FromDate.IsZero() {
+		eventID = GetEventNumberFromDate(db, locationID, options.FromDate)
+	}
+	if options.FromEvent > 0 {
+		eventID = options.FromEvent
+	}
+	if options.Backfill {
+		// Work down from just before the earliest stored event
+		eventID = GetLowestEventNumber(db, locationID) - 1
+		step = -1
+		if eventID < 1 {
+			log.Printf("No earlier events to backfill")
+			return finish(ScrapeResult{StopReason: StopEndOfEvents})
+		}
+	}
 	log.Printf("Starting from event number: %d", eventID)
 
-	waitBetweenRequests := 10 * time.Second
-	rateLimitBackoff := 180 * time.Second
+	scrape := options.scraper()
+	storeEvent := func(event Event, results []Result) (int, error) {
+		if err := options.checkDateRange(event); err != nil {
+			return 0, err
+		}
+
+		// Reject a bad date before any stored results are replaced
+		if err := checkEventDate(event); err != nil {
+			return 0, err
+		}
+
+		event.LocationID = locationID
+		event.ResultsHash = hashResults(results, event.Volunteers)
+
+		// Skip events that haven't changed since they were last stored
+		oldEventID, oldHash, found, err := GetStoredEventHash(db, locationID, event.EventNumber)
+		if err != nil {
+			return 0, err
+		}
+		if found && oldHash == event.ResultsHash {
+			return 0, errEventUnchanged
+		}
+		if found {
+			err := DeleteEventResults(db, oldEventID)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		// Store event data and get the event ID
+		dbEventID, err := StoreEvent(db, event)
+		if err != nil {
+			return 0, err
+		}
+
+		// Store results with the correct event ID
+		stored := 0
+		if len(results) > 0 {
+			stored = StoreResults(db, results, dbEventID)
+		}
+		if err := StoreVolunteers(db, event.Volunteers, dbEventID); err != nil {
+			return stored, err
+		}
+		return stored, nil
+	}
+
+	// Log progress after each event, as a long scrape can run for hours
+	processed := 0
+	result := scrape(config, slug, eventID, step, func(event Event, results []Result) (int, error) {
+		stored, err := storeEvent(event, results)
+		processed++
+		log.Printf("Processed event %d: %d events this session, %v elapsed",
+			event.EventNumber, processed, time.Since(startedAt).Round(time.Second))
+		return stored, err
+	})
+
+	// New events change the location run counts of everything after them
+	if result.EventsStored > 0 {
+		if err := ComputeLocationRuns(db, locationID); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	return finish(result)
+}
+
+// maxConsecutiveErrors is how many failed fetches in a row stop a scrape,
+// unless they're transient errors, which are retried by the retry policy
+const maxConsecutiveErrors = 3
+
+// scrapeEvents fetches events for a location from its configured site one at a time,
+// starting from startEvent and moving by step (1 forwards, -1 backwards), and
+// passes each parsed event to handle, which returns how many results it kept.
+// It stops at the end of the location's events, below event 1, or after too
+// many consecutive errors. Events that handle fails on are skipped.
+func scrapeEvents(config LocationConfig, urlSlug string, startEvent, step int, handle func(Event, []Result) (int, error)) ScrapeResult {
+	var scrapeResult ScrapeResult
+	eventID := startEvent
 	consecutiveErrors := 0
-	maxConsecutiveErrors := 3 // Stop after 3 consecutive errors
 
 	for {
-		event, results, err := ParseResults(urlSlug, eventID)
+		// Scraping backwards ends at the first event
+		if eventID < 1 {
+			log.Printf("Reached the first event. Scraping complete.")
+			scrapeResult.StopReason = StopEndOfEvents
+			return scrapeResult
+		}
+
+		event, results, parseStats, err := parseResultsFrom(config.BaseURL, localeFor(config.Country), urlSlug, eventID)
+		if errors.Is(err, ErrResultsPending) {
+			log.Printf("Results for event %d are not published yet. Run again later to pick them up.", eventID)
+			scrapeResult.StopReason = StopPending
+			return scrapeResult
+		}
+		if errors.Is(err, ErrNoResults) {
+			logNoResults(eventID, event)
+			scrapeResult.EventsSkipped++
+			eventID += step
+			time.Sleep(waitBetweenRequests)
+			continue
+		}
 		if err != nil {
 			log.Printf("Error processing event %d: %v", eventID, err)
 
+			if backoff, limited := rateLimitWait(err); limited {
+				log.Printf("Rate limited, waiting %d seconds before retry...", backoff/time.Second)
+				time.Sleep(backoff)
+				continue
+			}
 			if httpErr, ok := err.(*HTTPError); ok {
 				switch httpErr.StatusCode {
-				case 405:
-					log.Printf("Rate limited, waiting %d seconds before retry...", rateLimitBackoff/time.Second)
-					time.Sleep(rateLimitBackoff)
-					continue
 				case 425:
 					log.Printf("Reached end of events (425 error). Scraping complete.")
-					return
+					scrapeResult.StopReason = StopEndOfEvents
+					return scrapeResult
 				}
 			}
 
+			scrapeResult.Errors++
 			consecutiveErrors++
-			if consecutiveErrors >= maxConsecutiveErrors {
-				log.Printf("Reached %d consecutive errors. Stopping.", maxConsecutiveErrors)
+			if consecutiveErrors >= maxFailures(err) {
+				log.Printf("Reached %d consecutive errors. Stopping.", consecutiveErrors)
+				scrapeResult.StopReason = StopTooManyErrors
 				break
 			}
-			time.Sleep(waitBetweenRequests)
+			time.Sleep(retryWait(err, consecutiveErrors))
 			continue
 		}
 
-		event.LocationID = locationID
-
-		// Reset error counter on success
-		consecutiveErrors = 0
-
-		// Store event data and get the event ID
-		dbEventID, err := StoreEvent(db, event)
-		if err != nil {
-			log.Printf("Error storing event %d: %v", eventID, err)
-			continue
+		scrapeResult.RowsSkipped.Add(parseStats)
+		errorsBefore := scrapeResult.Errors
+		if !storeScrapedEvent(&scrapeResult, eventID, event, results, handle) {
+			return scrapeResult
 		}
-
-		// Store results with the correct event ID
-		if len(results) > 0 {
-			StoreResults(db, results, dbEventID)
+		// Only a stored event resets the error counter
+		if scrapeResult.Errors == errorsBefore {
+			consecutiveErrors = 0
 		}
 
-		eventID++
+		eventID += step
 		time.Sleep(waitBetweenRequests)
 	}
 
-	log.Printf("Scraping complete. Processed up to event %d", eventID-1)
+	log.Printf("Scraping complete. Processed up to event %d", eventID-step)
+	return scrapeResult
+}
+
+// logNoResults logs that an event was skipped for having no results
+func logNoResults(eventID int, event Event) {
+	date := ""
+	if !event.Date.IsZero() {
+		date = " on " + event.Date.Format("2006-01-02")
+	}
+	log.Printf("Event %d%s has no results, it may have been cancelled. Skipping", eventID, date)
+}
+
+// retryWait returns how long to wait before retrying an event after err, the
+// retry policy's growing delay for transient errors and the usual delay otherwise
+func retryWait(err error, retry int) time.Duration {
+	if !isTransient(err) {
+		return waitBetweenRequests
+	}
+	wait := retryPolicy.Delay(retry)
+	log.Printf("Transient error, retrying in %v", wait.Round(time.Millisecond))
+	return wait
+}
+
+// rateLimitWait reports whether err is the site rate limiting us, and how
+// long to wait before trying again. The server's Retry-After is preferred
+// over our own backoff.
+func rateLimitWait(err error) (time.Duration, bool) {
+	httpErr, ok := err.(*HTTPError)
+	if !ok || !rateLimitStatuses[httpErr.StatusCode] {
+		return 0, false
+	}
+	if httpErr.HasRetryAfter {
+		return httpErr.RetryAfter, true
+	}
+	return rateLimitBackoff, true
+}
+
+// storeScrapedEvent hands a fetched event to handle and counts the outcome in
+// scrapeResult. It returns false once the scrape should stop.
+func storeScrapedEvent(scrapeResult *ScrapeResult, eventID int, event Event, results []Result, handle func(Event, []Result) (int, error)) bool {
+	stored, err := handle(event, results)
+	if errors.Is(err, errPastDateRange) {
+		log.Printf("Event %d is after the date range. Scraping complete.", eventID)
+		scrapeResult.StopReason = StopPastDateRange
+		return false
+	}
+	if errors.Is(err, errEventUnchanged) {
+		log.Printf("Event %d is unchanged, skipping", eventID)
+		scrapeResult.EventsUnchanged++
+	} else if errors.Is(err, errBeforeDateRange) {
+		log.Printf("Event %d is before the date range, skipping", eventID)
+		scrapeResult.EventsSkipped++
+	} else if err != nil {
+		log.Printf("Error storing event %d: %v", eventID, err)
+		scrapeResult.Errors++
+		scrapeResult.EventsSkipped++
+	} else {
+		scrapeResult.EventsStored++
+		scrapeResult.ResultsStored += stored
+	}
+	return true
+}
+
+// printScrapeResult prints a summary of a completed scrape
+func printScrapeResult(w io.Writer, urlSlug string, result ScrapeResult) {
+	fmt.Fprintf(w, "\n%s\n", heading("Scrape Result for %s", urlSlug))
+	fmt.Fprintf(w, "Events Stored: %d\n", result.EventsStored)
+	fmt.Fprintf(w, "Results Stored: %d\n", result.ResultsStored)
+	fmt.Fprintf(w, "Events Skipped: %d\n", result.EventsSkipped)
+	fmt.Fprintf(w, "Events Unchanged: %d\n", result.EventsUnchanged)
+	if result.RowsSkipped.Skipped() > 0 {
+		fmt.Fprintf(w, "Rows: %s\n", result.RowsSkipped)
+	}
+	fmt.Fprintf(w, "Errors: %d\n", result.Errors)
+	fmt.Fprintf(w, "Stopped: %s\n", result.StopReason)
+}
+
+// PrintScrapeHistory lists a location's recorded scrapes, most recent first
+func PrintScrapeHistory(db *sql.DB, locationSlug string) error {
+	locationID, err := getLocationID(db, locationSlug)
+	if err != nil {
+		return err
+	}
+	runs, err := GetScrapeRuns(db, locationID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n", heading("Scrape History for %s", locationSlug))
+	if len(runs) == 0 {
+		fmt.Printf("No scrapes recorded\n")
+		return nil
+	}
+	for _, run := range runs {
+		fmt.Printf("%s (%s): %d events, %d results, %d skipped, %d unchanged, %d errors. Stopped: %s\n",
+			run.StartedAt.Local().Format("2006-01-02 15:04"), run.FinishedAt.Sub(run.StartedAt).Round(time.Second),
+			run.EventsStored, run.ResultsStored, run.EventsSkipped, run.EventsUnchanged, run.Errors, run.StopReason)
+	}
+	return nil
+}
+
+// ScrapeSummary holds totals gathered from a scrape that was not stored
+type ScrapeSummary struct {
+	TotalEvents    int
+	TotalFinishers int
+	FastestSeconds int
+	FastestName    string
+	FastestEvent   int
+}
+
+// scrapeWithoutStoring scrapes a location without writing it to the database,
+// adding each event to the summary as it comes in so no results are kept. It starts from event 1, or options.FromEvent,
+// and keeps to the options' dates and workers like Scrape. Clear and Backfill
+// need stored data and are ignored.
+func scrapeWithoutStoring(urlSlug string, options ScrapeOptions) ScrapeSummary {
+	var summary ScrapeSummary
+
+	startEvent := 1
+	if options.FromEvent > 0 {
+		startEvent = options.FromEvent
+	}
+
+	slug, _ := splitLocation(urlSlug)
+	scrape := options.scraper()
+	scrape(getLocationConfig(urlSlug), slug, startEvent, 1, func(event Event, eventResults []Result) (int, error) {
+		if err := options.checkDateRange(event); err != nil {
+			return 0, err
+		}
+		summary.TotalEvents++
+		for _, result := range eventResults {
+			if result.Name == "Unknown" {
+				continue
+			}
+			summary.TotalFinishers++
+			if result.TimeSeconds > 0 && (summary.FastestSeconds == 0 || result.TimeSeconds < summary.FastestSeconds) {
+				summary.FastestSeconds = result.TimeSeconds
+				summary.FastestName = result.Name
+				summary.FastestEvent = event.EventNumber
+			}
+		}
+		return len(eventResults), nil
+	})
+
+	return summary
 }
 
+// printScrapeSummary prints the totals from a scrape that was not stored
+func printScrapeSummary(w io.Writer, urlSlug string, summary ScrapeSummary) {
+	fmt.Fprintf(w, "\n%s\n", heading("Scrape Summary for %s (not stored)", urlSlug))
+	fmt.Fprintf(w, "Total Events: %d\n", summary.TotalEvents)
+	fmt.Fprintf(w, "Total Finishers: %d\n", summary.TotalFinishers)
+	if summary.FastestSeconds > 0 {
+		fmt.Fprintf(w, "Fastest Time: %s by %s (event %d)\n",
+			secondsToTime(summary.FastestSeconds), summary.FastestName, summary.FastestEvent)
+	} else {
+		fmt.Fprintf(w, "Fastest Time: N/A\n")
+	}
+}
 
 func connectDB() *sql.DB {
-	db, err := sql.Open("sqlite3", "./parkrun.db")
+	db, err := openDB(dbPath)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 	log.Printf("Successfully connected to database")
 	return db
+}
+
+// openDB opens the SQLite database at path, creating its parent directory if needed
+func openDB(path string) (*sql.DB, error) {
+	if path != ":memory:" {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %v", err)
+		}
+	}
+	return sql.Open("sqlite3", path)
 }
\ No newline at end of file
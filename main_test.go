@@ -0,0 +1,942 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScrapeWithoutStoring(t *testing.T) {
+	server := newFakeParkrunServer(t, servePages(map[int]string{
+		1: fakeResultsPage("06/01/2024",
+			fakeResultRow(1, "Runner A", "18:30"),
+			fakeResultRow(2, "Runner B", "21:05"),
+			fakeResultRow(3, "Unknown", ""),
+		),
+		2: fakeResultsPage("13/01/2024",
+			fakeResultRow(1, "Runner B", "17:59"),
+			fakeResultRow(2, "Runner C", "25:00"),
+		),
+	}))
+	defer server.Close()
+
+	// Run from an empty directory so any database file would be noticed
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	summary := scrapeWithoutStoring("test-park", ScrapeOptions{})
+
+	var out bytes.Buffer
+	printScrapeSummary(&out, "test-park", summary)
+
+	for _, want := range []string{
+		"Total Events: 2",
+		"Total Finishers: 4",
+		"Fastest Time: 17:59 by Runner B (event 2)",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected summary to contain %q, got:\n%s", want, out.String())
+		}
+	}
+
+	if _, err := os.Stat("parkrun.db"); !os.IsNotExist(err) {
+		t.Error("Expected no database file to be created")
+	}
+
+	// The same event and date bounds as a stored scrape apply
+	summary = scrapeWithoutStoring("test-park", ScrapeOptions{FromEvent: 2})
+	if summary.TotalEvents != 1 || summary.FastestEvent != 2 {
+		t.Errorf("Expected only event 2 from --from-event 2, got %+v", summary)
+	}
+	summary = scrapeWithoutStoring("test-park", ScrapeOptions{ToDate: time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC), Workers: 2})
+	if summary.TotalEvents != 1 || summary.FastestName != "Runner A" {
+		t.Errorf("Expected only event 1 up to --to 2024-01-06, got %+v", summary)
+	}
+}
+
+func TestScrape(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	server := newFakeParkrunServer(t, servePages(map[int]string{
+		1: fakeResultsPage("06/01/2024",
+			fakeResultRow(1, "Runner A", "18:30"),
+			fakeResultRow(2, "Runner B", "21:05"),
+		),
+		2: fakeResultsPage("13/01/2024",
+			fakeResultRow(1, "Runner B", "17:59"),
+			fakeResultRow(2, "Runner C", "25:00"),
+			fakeResultRow(3, "Unknown", ""),
+		),
+	}))
+	defer server.Close()
+
+	result, err := Scrape(db, "test-park", ScrapeOptions{})
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+
+	want := ScrapeResult{
+		EventsStored:  2,
+		ResultsStored: 5,
+		StopReason:    StopEndOfEvents,
+	}
+	if result != want {
+		t.Errorf("Scrape() = %+v, want %+v", result, want)
+	}
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM results").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Errorf("Expected 5 stored results, got %d", count)
+	}
+}
+
+func TestScrapeStopsAfterConsecutiveErrors(t *testing.T) {
+	// Server errors are retried by the retry policy, anything else only
+	// maxConsecutiveErrors times
+	tests := []struct {
+		status int
+		errors int
+	}{
+		{http.StatusInternalServerError, retryPolicy.Attempts + 1},
+		{http.StatusNotFound, maxConsecutiveErrors},
+	}
+	for _, tt := range tests {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+
+		server := newFakeParkrunServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		})
+		defer server.Close()
+
+		result, err := Scrape(db, "test-park", ScrapeOptions{})
+		if err != nil {
+			t.Fatalf("Scrape failed: %v", err)
+		}
+
+		want := ScrapeResult{
+			Errors:     tt.errors,
+			StopReason: StopTooManyErrors,
+		}
+		if result != want {
+			t.Errorf("HTTP %d: Scrape() = %+v, want %+v", tt.status, result, want)
+		}
+	}
+}
+
+func TestScrapeStopsAtPendingResults(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	pending, err := os.ReadFile(filepath.Join("testdata", "results_pending.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newFakeParkrunServer(t, servePages(map[int]string{
+		1: fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30")),
+		2: string(pending),
+	}))
+	defer server.Close()
+
+	result, err := Scrape(db, "test-park", ScrapeOptions{})
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+
+	want := ScrapeResult{
+		EventsStored:  1,
+		ResultsStored: 1,
+		StopReason:    StopPending,
+	}
+	if result != want {
+		t.Errorf("Scrape() = %+v, want %+v", result, want)
+	}
+
+	// The pending event isn't stored, so the next run starts from it
+	if next := GetNextEventNumber(db, 1); next != 2 {
+		t.Errorf("Expected next event number 2, got %d", next)
+	}
+}
+
+func TestScrapeBacksOffOn429(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	rateLimitStatuses[429] = true
+	defer delete(rateLimitStatuses, 429)
+
+	pages := servePages(map[int]string{
+		1: fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30")),
+	})
+	requests := 0
+	server := newFakeParkrunServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		pages(w, r)
+	})
+	defer server.Close()
+
+	start := time.Now()
+	result, err := Scrape(db, "test-park", ScrapeOptions{})
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected to wait for Retry-After, only waited %v", elapsed)
+	}
+	want := ScrapeResult{
+		EventsStored:  1,
+		ResultsStored: 1,
+		StopReason:    StopEndOfEvents,
+	}
+	if result != want {
+		t.Errorf("Scrape() = %+v, want %+v", result, want)
+	}
+}
+
+func TestScrapeUsesConfiguredBackoffWithoutRetryAfter(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	pages := servePages(map[int]string{
+		1: fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30")),
+	})
+	requests := 0
+	server := newFakeParkrunServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		pages(w, r)
+	})
+	defer server.Close()
+	rateLimitBackoff = 200 * time.Millisecond
+
+	start := time.Now()
+	result, err := Scrape(db, "test-park", ScrapeOptions{})
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < rateLimitBackoff {
+		t.Errorf("Expected to wait the configured backoff, only waited %v", elapsed)
+	}
+	if result.EventsStored != 1 || result.Errors != 0 {
+		t.Errorf("Expected 1 event stored without errors, got %+v", result)
+	}
+}
+
+func TestScrapeBackfill(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	pages := make(map[int]string)
+	for n := 1; n <= 5; n++ {
+		pages[n] = fakeResultsPage(fmt.Sprintf("%02d/01/2024", n), fakeResultRow(1, "Runner A", "18:30"))
+	}
+	server := newFakeParkrunServer(t, servePages(pages))
+	defer server.Close()
+
+	// Seed the database from event 3 onwards
+	if _, err := Scrape(db, "test-park", ScrapeOptions{FromEvent: 3}); err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	if first := GetLowestEventNumber(db, 1); first != 3 {
+		t.Fatalf("Expected the earliest stored event to be 3, got %d", first)
+	}
+
+	result, err := Scrape(db, "test-park", ScrapeOptions{Backfill: true})
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	want := ScrapeResult{
+		EventsStored:  2,
+		ResultsStored: 2,
+		StopReason:    StopEndOfEvents,
+	}
+	if result != want {
+		t.Errorf("Scrape() = %+v, want %+v", result, want)
+	}
+	if first := GetLowestEventNumber(db, 1); first != 1 {
+		t.Errorf("Expected events 1 and 2 to be filled in, earliest is %d", first)
+	}
+
+	// Nothing left to backfill
+	result, err = Scrape(db, "test-park", ScrapeOptions{Backfill: true})
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	if result != (ScrapeResult{StopReason: StopEndOfEvents}) {
+		t.Errorf("Expected nothing to backfill, got %+v", result)
+	}
+}
+
+func TestScrapeDateRange(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Weekly events from 6 January to 3 February
+	pages := make(map[int]string)
+	for n := 1; n <= 5; n++ {
+		date := parseDate(t, "2024-01-06").AddDate(0, 0, 7*(n-1))
+		pages[n] = fakeResultsPage(date.Format("02/01/2006"), fakeResultRow(1, "Runner A", "18:30"))
+	}
+	var fetched []int
+	handler := servePages(pages)
+	server := newFakeParkrunServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if eventNumber, ok := fakeEventNumber(r); ok {
+			fetched = append(fetched, eventNumber)
+		}
+		handler(w, r)
+	})
+	defer server.Close()
+
+	result, err := Scrape(db, "test-park", ScrapeOptions{
+		FromDate: parseDate(t, "2024-01-10"),
+		ToDate:   parseDate(t, "2024-01-27"),
+	})
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+
+	// Event 1 is before the window and event 5 ends the scrape
+	want := ScrapeResult{
+		EventsStored:  3,
+		ResultsStored: 3,
+		EventsSkipped: 1,
+		StopReason:    StopPastDateRange,
+	}
+	if result != want {
+		t.Errorf("Scrape() = %+v, want %+v", result, want)
+	}
+	if !reflect.DeepEqual(fetched, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("Expected events 1 to 5 to be fetched, got %v", fetched)
+	}
+	if first, next := GetLowestEventNumber(db, 1), GetNextEventNumber(db, 1); first != 2 || next != 5 {
+		t.Errorf("Expected events 2 to 4 stored, got %d to %d", first, next-1)
+	}
+
+	// A later window starts after the stored events before it
+	fetched = nil
+	if _, err := Scrape(db, "test-park", ScrapeOptions{FromDate: parseDate(t, "2024-02-01")}); err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	if !reflect.DeepEqual(fetched, []int{5, 6}) {
+		t.Errorf("Expected to start at event 5, fetched %v", fetched)
+	}
+}
+
+func TestParseFromFlag(t *testing.T) {
+	tests := []struct {
+		value     string
+		wantEvent int
+		wantDate  string
+		wantErr   bool
+	}{
+		{"", 0, "", false},
+		{"250", 250, "", false},
+		{"2023-01-01", 0, "2023-01-01", false},
+		{"01/01/2023", 0, "", true},
+	}
+	for _, tt := range tests {
+		eventNumber, date, err := parseFromFlag(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseFromFlag(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		gotDate := ""
+		if !date.IsZero() {
+			gotDate = date.Format("2006-01-02")
+		}
+		if eventNumber != tt.wantEvent || gotDate != tt.wantDate {
+			t.Errorf("parseFromFlag(%q) = %d, %q, want %d, %q", tt.value, eventNumber, gotDate, tt.wantEvent, tt.wantDate)
+		}
+	}
+}
+
+func TestScrapeSameSlugInTwoCountries(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	server := newFakeParkrunServer(t, servePages(map[int]string{
+		1: fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30")),
+	}))
+	defer server.Close()
+
+	// GBR locations are fetched from parkrun.org.uk unless configured otherwise
+	oldConfigs := locationConfigs
+	defer func() { locationConfigs = oldConfigs }()
+	locationConfigs = map[string]LocationConfig{"test-park:GBR": {BaseURL: server.URL}}
+
+	for _, location := range []string{"test-park", "test-park:GBR"} {
+		result, err := Scrape(db, location, ScrapeOptions{})
+		if err != nil {
+			t.Fatalf("Scrape(%s) failed: %v", location, err)
+		}
+		if result.EventsStored != 1 {
+			t.Errorf("Expected 1 event stored for %s, got %+v", location, result)
+		}
+	}
+
+	for _, location := range []string{"test-park:AUS", "test-park:GBR"} {
+		locationID, err := getLocationID(db, location)
+		if err != nil {
+			t.Fatalf("getLocationID(%s) failed: %v", location, err)
+		}
+		if next := GetNextEventNumber(db, locationID); next != 2 {
+			t.Errorf("Expected %s to have its own event 1, next event is %d", location, next)
+		}
+	}
+}
+
+func TestOpenDBCreatesParentDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "au", "parkrun.db")
+
+	db, err := openDB(path)
+	if err != nil {
+		t.Fatalf("openDB failed: %v", err)
+	}
+	defer db.Close()
+
+	CreateTables(db)
+
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected database file to be created: %v", err)
+	}
+}
+
+func TestEstimateScrapeMinutes(t *testing.T) {
+	tests := []struct {
+		count int
+		wait  time.Duration
+		want  int
+	}{
+		{900, 10 * time.Second, 150},
+		{10, 10 * time.Second, 2},
+		{6, 10 * time.Second, 1},
+		{1, 0, 0},
+		{0, 10 * time.Second, 0},
+	}
+
+	for _, tt := range tests {
+		if got := estimateScrapeMinutes(tt.count, tt.wait); got != tt.want {
+			t.Errorf("estimateScrapeMinutes(%d, %v) = %d, want %d", tt.count, tt.wait, got, tt.want)
+		}
+	}
+}
+
+func TestConfirmScrape(t *testing.T) {
+	server := newFakeParkrunServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/test-park/results/latestresults/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<div class="Results-header"><h3><span class="format-date">06/01/2024</span><span>#30</span></h3></div>`)
+	})
+	defer server.Close()
+	waitBetweenRequests = 10 * time.Second
+
+	var out bytes.Buffer
+	if ok, err := confirmScrape(strings.NewReader("y\n"), &out, "test-park", 11); !ok || err != nil {
+		t.Errorf("Expected the scrape to go ahead after answering y, got %v, %v", ok, err)
+	}
+	if want := "About to fetch 20 events (~4 minutes). Continue? [y/N] "; out.String() != want {
+		t.Errorf("Expected prompt %q, got %q", want, out.String())
+	}
+
+	if ok, err := confirmScrape(strings.NewReader("\n"), &out, "test-park", 11); ok || err != nil {
+		t.Errorf("Expected the scrape to be cancelled by default, got %v, %v", ok, err)
+	}
+	if ok, err := confirmScrape(strings.NewReader("y\n"), &out, "test-park", 31); ok || err != nil {
+		t.Errorf("Expected nothing to fetch once up to date, got %v, %v", ok, err)
+	}
+
+	// With no input, as under cron, the scrape fails rather than quietly stopping
+	_, err := confirmScrape(strings.NewReader(""), &out, "test-park", 11)
+	if code := exitCode(err); code != exitUsage {
+		t.Errorf("Expected exit code %d with no answer, got %d (%v)", exitUsage, code, err)
+	}
+}
+
+// newFakeParkrunServer starts a server using handler, points the scraper at
+// it and removes request delays.
+func newFakeParkrunServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	server := httptest.NewServer(handler)
+
+	oldBaseURL, oldWait, oldBackoff, oldRetry := resultsBaseURL, waitBetweenRequests, rateLimitBackoff, retryPolicy
+	resultsBaseURL = server.URL
+	waitBetweenRequests = 0
+	rateLimitBackoff = 0
+	retryPolicy = RetryPolicy{Multiplier: 1, Attempts: oldRetry.Attempts}
+	t.Cleanup(func() {
+		resultsBaseURL, waitBetweenRequests, rateLimitBackoff, retryPolicy = oldBaseURL, oldWait, oldBackoff, oldRetry
+	})
+
+	return server
+}
+
+func TestCheckLocations(t *testing.T) {
+	server := newFakeParkrunServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/valid-park/results/latestresults/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<html><body><div class="Results-header"><h3><span>06/01/2024</span><span>#42</span></h3></div></body></html>`)
+	})
+	defer server.Close()
+
+	checks := checkLocations([]string{"valid-park", "no-such-park"})
+	if len(checks) != 2 {
+		t.Fatalf("Expected 2 checks, got %+v", checks)
+	}
+	if checks[0].Err != nil || checks[0].LatestEvent != 42 {
+		t.Errorf("Expected valid-park to be found at event 42, got %+v", checks[0])
+	}
+	var httpErr *HTTPError
+	if !errors.As(checks[1].Err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 for no-such-park, got %+v", checks[1])
+	}
+
+	var out bytes.Buffer
+	printLocationChecks(&out, checks)
+	for _, want := range []string{
+		"valid-park: OK, latest event #42",
+		"no-such-park: error: HTTP error (HTTP 404)",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+
+	if err := locationChecksError(checks); err == nil || exitCode(err) != exitNotFound {
+		t.Errorf("Expected a missing location to exit with %d, got %v", exitNotFound, err)
+	}
+}
+
+// servePages serves the given result pages by event number and returns 425
+// for any other event, like parkrun does past the latest event.
+func servePages(pages map[int]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventNumber, ok := fakeEventNumber(r)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		page, ok := pages[eventNumber]
+		if !ok {
+			w.WriteHeader(425)
+			return
+		}
+		fmt.Fprint(w, page)
+	}
+}
+
+// fakeEventNumber extracts the event number from a /<slug>/results/<n>/ path
+func fakeEventNumber(r *http.Request) (int, bool) {
+	var slug string
+	var eventNumber int
+	_, err := fmt.Sscanf(strings.ReplaceAll(r.URL.Path, "/", " "), " %s results %d ", &slug, &eventNumber)
+	return eventNumber, err == nil
+}
+
+// fakeResultsPage builds a minimal results page in the same shape as parkrun's
+func fakeResultsPage(date string, rows ...string) string {
+	return fmt.Sprintf(`<html><body>
+<div class="Results-header"><h3><span class="format-date">%s</span></h3></div>
+<table class="Results-table"><tbody>
+%s
+</tbody></table>
+</body></html>`, date, strings.Join(rows, "\n"))
+}
+
+// fakeResultRow builds a single results table row
+func fakeResultRow(position int, name, time string) string {
+	return fmt.Sprintf(`<tr class="Results-table-row" data-position="%d" data-name="%s" data-agegroup="SM30-34" data-agegrade="60.00%%" data-achievement="">
+<td class="Results-table-td Results-table-td--name"><div class="detailed">10 parkruns</div></td>
+<td class="Results-table-td Results-table-td--time"><div class="compact">%s</div></td>
+</tr>`, position, name, time)
+}
+
+func TestParseAndStoreResultsReturnsCounts(t *testing.T) {
+	server := newFakeParkrunServer(t, servePages(map[int]string{
+		1: fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30"), fakeResultRow(2, "Runner B", "19:00")),
+		2: fakeResultsPage("13/01/2024", fakeResultRow(1, "Runner B", "17:59")),
+	}))
+	defer server.Close()
+
+	defer func(original string) { dbPath = original }(dbPath)
+	dbPath = filepath.Join(t.TempDir(), "parkrun.db")
+
+	var result ScrapeResult
+	var err error
+	captureStdout(t, func() {
+		result, err = parseAndStoreResults("test-park", ScrapeOptions{})
+	})
+	if err != nil {
+		t.Fatalf("parseAndStoreResults failed: %v", err)
+	}
+	want := ScrapeResult{EventsStored: 2, ResultsStored: 3, StopReason: StopEndOfEvents}
+	if result != want {
+		t.Errorf("parseAndStoreResults() = %+v, want %+v", result, want)
+	}
+
+	// Scraping the same events again adds nothing
+	captureStdout(t, func() {
+		result, err = parseAndStoreResults("test-park", ScrapeOptions{FromEvent: 1})
+	})
+	if err != nil {
+		t.Fatalf("parseAndStoreResults failed: %v", err)
+	}
+	want = ScrapeResult{EventsUnchanged: 2, StopReason: StopEndOfEvents}
+	if result != want {
+		t.Errorf("parseAndStoreResults() = %+v, want %+v", result, want)
+	}
+}
+
+func TestScrapeSkipsCancelledEvents(t *testing.T) {
+	cancelled, err := os.ReadFile(filepath.Join("testdata", "results_cancelled.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := map[int]string{
+		1: fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30")),
+		2: string(cancelled),
+		3: fakeResultsPage("20/01/2024", fakeResultRow(1, "Runner B", "17:59")),
+	}
+
+	for _, workers := range []int{1, 2} {
+		db, cleanup := setupTestDB(t)
+		server := newFakeParkrunServer(t, servePages(pages))
+
+		result, err := Scrape(db, "test-park", ScrapeOptions{Workers: workers})
+		if err != nil {
+			t.Fatalf("Scrape failed: %v", err)
+		}
+		want := ScrapeResult{
+			EventsStored:  2,
+			ResultsStored: 2,
+			EventsSkipped: 1,
+			StopReason:    StopEndOfEvents,
+		}
+		if result != want {
+			t.Errorf("With %d workers, Scrape() = %+v, want %+v", workers, result, want)
+		}
+
+		var events []int
+		rows, err := db.Query(`SELECT event_number FROM events ORDER BY event_number`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var eventNumber int
+			if err := rows.Scan(&eventNumber); err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, eventNumber)
+		}
+		rows.Close()
+		if !reflect.DeepEqual(events, []int{1, 3}) {
+			t.Errorf("With %d workers, expected events 1 and 3 stored, got %v", workers, events)
+		}
+
+		server.Close()
+		cleanup()
+	}
+}
+
+func TestScrapeSkipsUnchangedEvents(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	pages := map[int]string{
+		1: fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30")),
+		2: fakeResultsPage("13/01/2024", fakeResultRow(1, "Runner B", "17:59")),
+	}
+	server := newFakeParkrunServer(t, servePages(pages))
+	defer server.Close()
+
+	if _, err := Scrape(db, "test-park", ScrapeOptions{}); err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+
+	// Re-scraping the same pages stores nothing new
+	result, err := Scrape(db, "test-park", ScrapeOptions{FromEvent: 1})
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	want := ScrapeResult{
+		EventsUnchanged: 2,
+		StopReason:      StopEndOfEvents,
+	}
+	if result != want {
+		t.Errorf("Scrape() = %+v, want %+v", result, want)
+	}
+
+	// A corrected result page is re-stored in place of the old results
+	pages[2] = fakeResultsPage("13/01/2024",
+		fakeResultRow(1, "Runner B", "17:59"),
+		fakeResultRow(2, "Runner C", "25:00"),
+	)
+	result, err = Scrape(db, "test-park", ScrapeOptions{FromEvent: 1})
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	want = ScrapeResult{
+		EventsStored:    1,
+		ResultsStored:   2,
+		EventsUnchanged: 1,
+		StopReason:      StopEndOfEvents,
+	}
+	if result != want {
+		t.Errorf("Scrape() = %+v, want %+v", result, want)
+	}
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM results").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 stored results, got %d", count)
+	}
+}
+
+func TestScrapeRecordsRun(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	server := newFakeParkrunServer(t, servePages(map[int]string{
+		1: fakeResultsPage("06/01/2024",
+			fakeResultRow(1, "Runner A", "18:30"),
+			fakeResultRow(2, "Runner B", "21:05"),
+		),
+		2: fakeResultsPage("13/01/2024",
+			fakeResultRow(1, "Runner B", "17:59"),
+		),
+	}))
+	defer server.Close()
+
+	now := time.Date(2024, 1, 14, 9, 30, 0, 0, time.UTC)
+	defer func(original Clock) { clock = original }(clock)
+	clock = fixedClock(now)
+
+	if _, err := Scrape(db, "test-park", ScrapeOptions{}); err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	// Nothing new the second time
+	if _, err := Scrape(db, "test-park", ScrapeOptions{}); err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+
+	runs, err := GetScrapeRuns(db, 1)
+	if err != nil {
+		t.Fatalf("GetScrapeRuns failed: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("Expected 2 recorded runs, got %d: %+v", len(runs), runs)
+	}
+
+	// Most recent first
+	first := runs[1]
+	if first.EventsStored != 2 || first.ResultsStored != 3 || first.Errors != 0 ||
+		first.StopReason != StopEndOfEvents || first.LocationID != 1 {
+		t.Errorf("Unexpected first run %+v", first)
+	}
+	if !first.StartedAt.Equal(now) || !first.FinishedAt.Equal(now) {
+		t.Errorf("Expected the run to be timed by the clock at %v, got %v to %v", now, first.StartedAt, first.FinishedAt)
+	}
+	if runs[0].EventsStored != 0 || runs[0].StopReason != StopEndOfEvents {
+		t.Errorf("Unexpected second run %+v", runs[0])
+	}
+}
+
+func TestScrapeStoresCanonicalURL(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	pages := servePages(map[int]string{
+		1: fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30")),
+	})
+	var server *httptest.Server
+	server = newFakeParkrunServer(t, func(w http.ResponseWriter, r *http.Request) {
+		// The old slug redirects to the renamed location
+		if strings.HasPrefix(r.URL.Path, "/old-park/") {
+			http.Redirect(w, r, server.URL+strings.Replace(r.URL.Path, "/old-park/", "/new-park/", 1), http.StatusMovedPermanently)
+			return
+		}
+		pages(w, r)
+	})
+	defer server.Close()
+
+	if _, err := Scrape(db, "old-park", ScrapeOptions{}); err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+
+	var url string
+	if err := db.QueryRow(`SELECT url FROM events WHERE event_number = 1`).Scan(&url); err != nil {
+		t.Fatal(err)
+	}
+	if want := server.URL + "/new-park/results/1/"; url != want {
+		t.Errorf("Stored URL = %q, want %q", url, want)
+	}
+}
+
+func TestScrapeRemembersDomain(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	server := newFakeParkrunServer(t, servePages(map[int]string{
+		1: fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30")),
+		2: fakeResultsPage("13/01/2024", fakeResultRow(1, "Runner A", "18:20")),
+	}))
+	defer server.Close()
+
+	target, _ := url.Parse(server.URL)
+	recorder := &hostRecorder{target: target}
+	defer func(original *http.Client) { httpClient = original }(httpClient)
+	httpClient = &http.Client{Transport: recorder}
+
+	oldConfigs := locationConfigs
+	defer func() { locationConfigs = oldConfigs }()
+	locationConfigs = map[string]LocationConfig{}
+
+	// As with parse --domain, which also makes the location German
+	setLocationDomain("test-park", "parkrun.de")
+	if _, err := Scrape(db, "test-park", ScrapeOptions{FromEvent: 1, ToDate: parseDate(t, "2024-01-06")}); err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+
+	var country, domain string
+	err := db.QueryRow(`SELECT country, domain FROM locations WHERE slug = 'test-park'`).Scan(&country, &domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if country != "DEU" || domain != "parkrun.de" {
+		t.Errorf("Expected a German location on parkrun.de, got %s on %s", country, domain)
+	}
+
+	// Without --domain the next scrape uses the stored one, not parkrun.com.de
+	locationConfigs = map[string]LocationConfig{}
+	recorder.hosts = nil
+	if _, err := Scrape(db, "test-park:DEU", ScrapeOptions{}); err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	if len(recorder.hosts) == 0 || recorder.hosts[0] != "www.parkrun.de" {
+		t.Errorf("Expected the stored domain to be used, fetched from %v", recorder.hosts)
+	}
+}
+
+func TestParseDelayAndBackoffFlags(t *testing.T) {
+	server := newFakeParkrunServer(t, servePages(map[int]string{
+		1: fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30")),
+	}))
+	defer server.Close()
+
+	dbFile := filepath.Join(t.TempDir(), "parkrun.db")
+	defer func(original string) { dbPath = original }(dbPath)
+	defer func(original *http.Client) { httpClient = original }(httpClient)
+
+	for _, flags := range [][]string{{"--delay", "-1s"}, {"--backoff", "-1m"}} {
+		err := run(append([]string{"--db", dbFile, "parse", "test-park", "--yes"}, flags...))
+		if got := exitCode(err); got != exitUsage {
+			t.Errorf("Expected a usage error for %v, got %v", flags, err)
+		}
+	}
+
+	err := run([]string{"--db", dbFile, "parse", "test-park", "--yes", "--delay", "0s", "--backoff", "2s"})
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if waitBetweenRequests != 0 || rateLimitBackoff != 2*time.Second {
+		t.Errorf("Expected a delay of 0s and a backoff of 2s, got %v and %v", waitBetweenRequests, rateLimitBackoff)
+	}
+}
+
+func TestDomainFlagNeedsACountrySite(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "parkrun.db")
+	defer func(original string) { dbPath = original }(dbPath)
+	oldConfigs := locationConfigs
+	defer func() { locationConfigs = oldConfigs }()
+
+	// Sites without a country would fall back to Australian dates and country
+	for _, domain := range []string{"parkrun.com", "parkrun.lt", "results.parkrun.org.uk", "example.com"} {
+		err := run([]string{"--db", dbFile, "parse", "test-park", "--domain", domain, "--yes"})
+		if got := exitCode(err); got != exitUsage {
+			t.Errorf("Expected a usage error for --domain %s, got %v", domain, err)
+		}
+		err = run([]string{"--db", dbFile, "events", domain})
+		if got := exitCode(err); got != exitUsage {
+			t.Errorf("Expected a usage error for events %s, got %v", domain, err)
+		}
+	}
+}
+
+func TestParseCountryFlag(t *testing.T) {
+	server := newFakeParkrunServer(t, servePages(map[int]string{
+		1: fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30")),
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "parkrun.db")
+	configFile := filepath.Join(dir, "locations.json")
+	err := os.WriteFile(configFile, []byte(`{"test-park:GBR": {"base_url": "`+server.URL+`"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(original string) { dbPath = original }(dbPath)
+	defer func(original *http.Client) { httpClient = original }(httpClient)
+	oldConfigs := locationConfigs
+	defer func() { locationConfigs = oldConfigs }()
+
+	for _, code := range []string{"gbr", "GB", "G8R"} {
+		err := run([]string{"--db", dbFile, "parse", "test-park", "--country", code, "--yes"})
+		if got := exitCode(err); got != exitUsage {
+			t.Errorf("Expected a usage error for --country %s, got %v", code, err)
+		}
+	}
+
+	err = run([]string{"--db", dbFile, "parse", "--locations", configFile, "--country", "GBR", "--yes", "test-park"})
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	db, err := openDB(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var country string
+	if err := db.QueryRow(`SELECT country FROM locations WHERE slug = 'test-park'`).Scan(&country); err != nil {
+		t.Fatal(err)
+	}
+	if country != "GBR" {
+		t.Errorf("Expected the location to be stored as GBR, got %s", country)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ScrapeMetrics totals a location's recorded scrapes for monitoring
+type ScrapeMetrics struct {
+	Location      string
+	Scrapes       int
+	EventsStored  int
+	ResultsStored int
+	Errors        int
+	LastScrape    time.Time
+}
+
+// GetScrapeMetrics totals the scrape_runs history of every location that has
+// been scraped, sorted by location. Slugs used in more than one country are
+// qualified, e.g. bushy:GBR.
+func GetScrapeMetrics(db *sql.DB) ([]ScrapeMetrics, error) {
+	rows, err := db.Query(`
+		SELECT
+			l.slug,
+			l.country,
+			(SELECT COUNT(*) FROM locations other WHERE other.slug = l.slug),
+			s.finished_at,
+			s.events_stored,
+			s.results_stored,
+			s.errors
+		FROM scrape_runs s
+		JOIN locations l ON s.location_id = l.id`)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	byLocation := make(map[string]*ScrapeMetrics)
+	for rows.Next() {
+		var slug, country string
+		var sharedBy, eventsStored, resultsStored, errorCount int
+		var finishedAt time.Time
+		if err := rows.Scan(&slug, &country, &sharedBy, &finishedAt, &eventsStored, &resultsStored, &errorCount); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		if sharedBy > 1 {
+			slug += ":" + country
+		}
+		m, ok := byLocation[slug]
+		if !ok {
+			m = &ScrapeMetrics{Location: slug}
+			byLocation[slug] = m
+		}
+		m.Scrapes++
+		m.EventsStored += eventsStored
+		m.ResultsStored += resultsStored
+		m.Errors += errorCount
+		if finishedAt.After(m.LastScrape) {
+			m.LastScrape = finishedAt
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+
+	var metrics []ScrapeMetrics
+	for _, m := range byLocation {
+		metrics = append(metrics, *m)
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Location < metrics[j].Location
+	})
+	return metrics, nil
+}
+
+// writeMetrics writes scrape metrics in the Prometheus text format
+func writeMetrics(w io.Writer, metrics []ScrapeMetrics) {
+	families := []struct {
+		name, kind, help string
+		value            func(ScrapeMetrics) string
+	}{
+		{"parkrun_scrapes_total", "counter", "Scrapes recorded for the location.",
+			func(m ScrapeMetrics) string { return fmt.Sprint(m.Scrapes) }},
+		{"parkrun_last_scrape_timestamp_seconds", "gauge", "Unix time the location's latest scrape finished.",
+			func(m ScrapeMetrics) string { return fmt.Sprint(m.LastScrape.Unix()) }},
+		{"parkrun_events_stored_total", "counter", "Events stored by the location's scrapes.",
+			func(m ScrapeMetrics) string { return fmt.Sprint(m.EventsStored) }},
+		{"parkrun_results_stored_total", "counter", "Results stored by the location's scrapes.",
+			func(m ScrapeMetrics) string { return fmt.Sprint(m.ResultsStored) }},
+		{"parkrun_scrape_errors_total", "counter", "Errors hit by the location's scrapes.",
+			func(m ScrapeMetrics) string { return fmt.Sprint(m.Errors) }},
+	}
+
+	// Label values escape backslashes, quotes and newlines
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for _, family := range families {
+		fmt.Fprintf(w, "# HELP %s %s\n", family.name, family.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", family.name, family.kind)
+		for _, m := range metrics {
+			fmt.Fprintf(w, "%s{location=\"%s\"} %s\n", family.name, escape.Replace(m.Location), family.value(m))
+		}
+	}
+}
+
+// MetricsHandler serves the scrape metrics at /metrics, read from the
+// database on each request so scrapes run by other processes show up
+func MetricsHandler(db *sql.DB) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		metrics, err := GetScrapeMetrics(db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, metrics)
+	})
+	return mux
+}
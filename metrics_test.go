@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	started := time.Date(2024, 1, 6, 9, 0, 0, 0, time.UTC)
+	for _, run := range []ScrapeResult{
+		{LocationID: 1, StartedAt: started, FinishedAt: started.Add(time.Minute), EventsStored: 2, ResultsStored: 40, StopReason: StopEndOfEvents},
+		{LocationID: 1, StartedAt: started.Add(time.Hour), FinishedAt: started.Add(time.Hour + time.Minute), EventsStored: 1, ResultsStored: 25, Errors: 3, StopReason: StopTooManyErrors},
+		{LocationID: 2, StartedAt: started, FinishedAt: started.Add(2 * time.Minute), EventsStored: 1, ResultsStored: 10, StopReason: StopEndOfEvents},
+	} {
+		if err := RecordScrapeRun(db, &run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	MetricsHandler(db).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("Expected a text/plain response, got %s", contentType)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE parkrun_scrapes_total counter",
+		`parkrun_scrapes_total{location="test-park-1"} 2`,
+		`parkrun_scrapes_total{location="test-park-2"} 1`,
+		"# TYPE parkrun_last_scrape_timestamp_seconds gauge",
+		`parkrun_last_scrape_timestamp_seconds{location="test-park-1"} 1704535260`,
+		`parkrun_events_stored_total{location="test-park-1"} 3`,
+		`parkrun_results_stored_total{location="test-park-1"} 65`,
+		`parkrun_scrape_errors_total{location="test-park-1"} 3`,
+		`parkrun_scrape_errors_total{location="test-park-2"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
@@ -1,8 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -10,6 +19,7 @@ import (
 	"net/http"
 
 	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/proxy"
 )
 
 type Result struct {
@@ -20,8 +30,23 @@ type Result struct {
 	AgeGrade    string
 	AgeCategory string
 	Note        string
-	TotalRuns   int
-	EventID     int64
+	// NoteMissing is set when the page has no achievement data for the row,
+	// so the note is stored as NULL rather than as no achievement
+	NoteMissing bool
+	// TotalRuns is parkrun's count of the runner's runs at every location, as
+	// scraped from the results page
+	TotalRuns int
+	// LocationRuns counts the runner's runs at this location up to and
+	// including this one, worked out by ComputeLocationRuns
+	LocationRuns int
+	EventID      int64
+	// parkrun's athlete ID, 0 for unknown runners
+	AthleteID int
+	Gender    string
+	// Position among runners of the same gender, 0 if the page doesn't show it
+	GenderPosition int
+	// Running club, empty for unaffiliated runners
+	Club string
 }
 
 type Event struct {
@@ -29,6 +54,25 @@ type Event struct {
 	LocationID  int
 	Date        time.Time
 	URL         string
+	// Hash of the event's results and volunteers, used to spot changes on re-scrape
+	ResultsHash string
+	// Inaugural is set for a location's first event, whose page can be laid
+	// out differently
+	Inaugural bool
+	// Volunteers thanked on the results page. They travel with the event
+	// rather than as another return value, as scrapeEvent already returns
+	// ParseStats and every scrape handler, stored or not, takes an event and
+	// its results.
+	Volunteers []Volunteer
+}
+
+// Volunteer is someone who volunteered at an event
+type Volunteer struct {
+	Name string
+	// Role is empty when the page only names the volunteers, as results pages usually do
+	Role string
+	// EventID is the stored event's ID, set by StoreVolunteers
+	EventID int64
 }
 
 type Location struct {
@@ -36,30 +80,365 @@ type Location struct {
 	Slug string
 	Name string
 	// ISO 3166-1 alpha-3 country code
-	Country string
+	Country    string
+	DistanceKm float64
+	// Domain is the parkrun site the location's results come from, e.g. parkrun.org.uk
+	Domain string
 }
 
 type HTTPError struct {
 	StatusCode int
 	Message    string
+	// How long the server asked us to wait, if it sent a Retry-After header
+	RetryAfter    time.Duration
+	HasRetryAfter bool
 }
 
 func (e *HTTPError) Error() string {
 	return fmt.Sprintf("%s (HTTP %d)", e.Message, e.StatusCode)
 }
 
-func ParseResults(urlSlug string, eventNumber int) (Event, []Result, error) {
-	baseURL := "https://www.parkrun.com.au/%s/results/%d/"
-	url := fmt.Sprintf(baseURL, urlSlug, eventNumber)
+// ParseStats counts the result rows skipped while parsing, by reason
+type ParseStats struct {
+	BadTime     int
+	MissingName int
+}
+
+// Skipped returns the total number of rows skipped
+func (s ParseStats) Skipped() int {
+	return s.BadTime + s.MissingName
+}
+
+// Add adds another page's counts to these
+func (s *ParseStats) Add(other ParseStats) {
+	s.BadTime += other.BadTime
+	s.MissingName += other.MissingName
+}
+
+// String summarises the counts, e.g. "skipped 12 rows: 8 bad time, 4 missing name"
+func (s ParseStats) String() string {
+	var reasons []string
+	if s.BadTime > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d bad time", s.BadTime))
+	}
+	if s.MissingName > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d missing name", s.MissingName))
+	}
+	if len(reasons) == 0 {
+		return "skipped 0 rows"
+	}
+	return fmt.Sprintf("skipped %d rows: %s", s.Skipped(), strings.Join(reasons, ", "))
+}
+
+// ErrResultsPending means an event's results page exists but hasn't been filled in yet
+var ErrResultsPending = errors.New("results not published yet")
+
+// pendingResultsPhrases are shown on a results page before the results are processed
+var pendingResultsPhrases = []string{
+	"results coming soon",
+	"results will be available",
+	"not yet available",
+	"being processed",
+}
+
+// ErrNoResults means an event's results page was served but lists no
+// finishers, as happens when an event is cancelled. The event is still
+// returned so its date can be logged.
+var ErrNoResults = errors.New("event has no results")
+
+// isResultsPending reports whether a page without results says they are on the way
+func isResultsPending(doc *goquery.Document) bool {
+	text := strings.ToLower(doc.Text())
+	for _, phrase := range pendingResultsPhrases {
+		if strings.Contains(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// ScrapeConfig controls how the scraper connects to the results site.
+// The zero value uses the system's trusted certificates.
+type ScrapeConfig struct {
+	// TLSConfig is used as-is when set, ignoring the other TLS options
+	TLSConfig *tls.Config
+	// CACertPath is a PEM file of extra CAs to trust, e.g. for a caching mirror
+	CACertPath string
+	// Insecure skips certificate verification entirely. Only for testing.
+	Insecure bool
+	// SOCKS5 is the host:port of a SOCKS5 proxy to connect through, e.g. Tor
+	// at 127.0.0.1:9050. HTTP proxy settings from the environment are ignored
+	// when it's set.
+	SOCKS5 string
+}
+
+// NewHTTPClient builds an HTTP client using the config's TLS and proxy settings
+func (c ScrapeConfig) NewHTTPClient() (*http.Client, error) {
+	tlsConfig := c.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: c.Insecure}
+		if c.CACertPath != "" {
+			pem, err := os.ReadFile(c.CACertPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA cert: %w", err)
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", c.CACertPath)
+			}
+			tlsConfig.RootCAs = pool
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if c.SOCKS5 != "" {
+		dialer, err := proxy.SOCKS5("tcp", c.SOCKS5, nil, proxy.Direct)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up SOCKS5 proxy: %w", err)
+		}
+		contextDialer, ok := dialer.(proxy.ContextDialer)
+		if !ok {
+			return nil, fmt.Errorf("SOCKS5 dialer does not support contexts")
+		}
+		transport.Proxy = nil
+		transport.DialContext = contextDialer.DialContext
+	}
+	return &http.Client{Transport: transport, CheckRedirect: checkParkrunRedirect}, nil
+}
+
+// httpClient is used for all requests to the results site
+var httpClient = &http.Client{CheckRedirect: checkParkrunRedirect}
+
+// ErrOffDomainRedirect means the results site redirected somewhere that isn't parkrun
+var ErrOffDomainRedirect = errors.New("refusing to follow redirect off parkrun's domains")
+
+// parkrunDomains are the sites results may be redirected to, along with their
+// subdomains: every country's site in countryDomains and otherDomains
+var parkrunDomains []string
+
+func init() {
+	for _, domain := range countryDomains {
+		parkrunDomains = append(parkrunDomains, domain)
+	}
+	for domain := range otherDomains {
+		parkrunDomains = append(parkrunDomains, domain)
+	}
+}
+
+// isParkrunHost reports whether host is one of parkrunDomains or a subdomain of one
+func isParkrunHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range parkrunDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkParkrunRedirect only follows redirects to parkrun's own sites, or
+// within the host first requested (e.g. a mirror), so we never store results
+// from somewhere unexpected. It logs when a location's slug is redirected.
+func checkParkrunRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	original := via[0].URL
+	if req.URL.Host != original.Host && !isParkrunHost(req.URL.Hostname()) {
+		return fmt.Errorf("%w: %s", ErrOffDomainRedirect, req.URL)
+	}
+
+	oldSlug, newSlug := urlSlug(original.Path), urlSlug(req.URL.Path)
+	if oldSlug != newSlug {
+		log.Printf("Location %s redirected to %s, which may be its new slug", oldSlug, newSlug)
+	}
+	return nil
+}
+
+// urlSlug returns the location slug from a results path like /<slug>/results/1/
+func urlSlug(path string) string {
+	return strings.SplitN(strings.Trim(path, "/"), "/", 2)[0]
+}
+
+// resultsBaseURL is the site results are fetched from for the default domain.
+// Tests point it at a fake server.
+var resultsBaseURL = "https://www.parkrun.com.au"
+
+// defaultDomain is the parkrun site used for countries without their own
+const defaultDomain = "parkrun.com.au"
+
+// countryDomains holds each country's parkrun site, keyed by ISO 3166-1 alpha-3 code
+var countryDomains = map[string]string{
+	"AUS": "parkrun.com.au",
+	"AUT": "parkrun.co.at",
+	"CAN": "parkrun.ca",
+	"DEU": "parkrun.com.de",
+	"DNK": "parkrun.dk",
+	"FIN": "parkrun.fi",
+	"GBR": "parkrun.org.uk",
+	"IRL": "parkrun.ie",
+	"ITA": "parkrun.it",
+	"JPN": "parkrun.jp",
+	"MYS": "parkrun.my",
+	"NLD": "parkrun.co.nl",
+	"NOR": "parkrun.no",
+	"NZL": "parkrun.co.nz",
+	"POL": "parkrun.pl",
+	"SGP": "parkrun.sg",
+	"SWE": "parkrun.se",
+	"USA": "parkrun.us",
+	"ZAF": "parkrun.co.za",
+}
+
+// domainForCountry returns a country's parkrun site, falling back to parkrun.com.au
+func domainForCountry(country string) string {
+	if domain, ok := countryDomains[country]; ok {
+		return domain
+	}
+	return defaultDomain
+}
+
+// otherDomains are shorter domains that redirect to a country's parkrun site
+var otherDomains = map[string]string{
+	"parkrun.de": "DEU",
+	"parkrun.nl": "NLD",
+}
+
+// countryForDomain returns the country a parkrun site belongs to, or "" if
+// it isn't a known one
+func countryForDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "www."))
+	if country, ok := otherDomains[domain]; ok {
+		return country
+	}
+	for country, d := range countryDomains {
+		if d == domain {
+			return country
+		}
+	}
+	return ""
+}
+
+// baseURLForDomain returns the site URL for a parkrun domain like parkrun.org.uk
+func baseURLForDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "www."))
+	if domain == "" || domain == defaultDomain {
+		return resultsBaseURL
+	}
+	return "https://www." + domain
+}
+
+// ParseOptions chooses where ParseResultsWithOptions fetches results from
+type ParseOptions struct {
+	// Domain is the parkrun site, e.g. parkrun.org.uk. Empty means parkrun.com.au.
+	Domain string
+}
+
+// ParseResults fetches and parses an event's results from parkrun.com.au
+func ParseResults(urlSlug string, eventNumber int) (Event, []Result, ParseStats, error) {
+	return ParseResultsWithOptions(urlSlug, eventNumber, ParseOptions{})
+}
+
+// ParseResultsWithOptions fetches and parses an event's results from the
+// parkrun site in options, reading the page in that country's locale
+func ParseResultsWithOptions(urlSlug string, eventNumber int, options ParseOptions) (Event, []Result, ParseStats, error) {
+	domain := options.Domain
+	if domain == "" {
+		domain = defaultDomain
+	}
+	locale := localeFor(countryForDomain(domain))
+	return parseResultsFrom(baseURLForDomain(domain), locale, urlSlug, eventNumber)
+}
+
+// ParseResultsForDomain fetches and parses an event's results from a parkrun
+// site like parkrun.org.uk
+func ParseResultsForDomain(domain, urlSlug string, eventNumber int) (Event, []Result, ParseStats, error) {
+	return ParseResultsWithOptions(urlSlug, eventNumber, ParseOptions{Domain: domain})
+}
+
+// parseResultsFrom fetches and parses an event's results from the given site,
+// reading the page in the site's locale
+func parseResultsFrom(baseURL string, locale Locale, urlSlug string, eventNumber int) (Event, []Result, ParseStats, error) {
+	url := fmt.Sprintf("%s/%s/results/%d/", baseURL, urlSlug, eventNumber)
+
+	return scrapeEvent(url, eventNumber, locale)
+}
+
+// quiet turns off the audit line logged for each event fetched, set with --quiet
+var quiet bool
+
+// FetchAudit records what was fetched for an event, so odd scrapes can be traced
+type FetchAudit struct {
+	URL      string
+	FinalURL string // After redirects
+	Status   int
+	Bytes    int
+	Rows     int
+}
+
+func (a FetchAudit) String() string {
+	return fmt.Sprintf("fetch url=%s final_url=%s status=%d bytes=%d rows=%d",
+		a.URL, a.FinalURL, a.Status, a.Bytes, a.Rows)
+}
+
+// logAudit logs a fetch's audit line unless --quiet is set
+func logAudit(audit FetchAudit) {
+	if !quiet {
+		log.Printf("%s", audit)
+	}
+}
+
+// scrapeEvent fetches an event's results. The event's URL is the one parkrun
+// ended up serving after any redirects, so stored URLs are canonical.
+func scrapeEvent(url string, eventNumber int, locale Locale) (Event, []Result, ParseStats, error) {
+	event, results, stats, audit, err := fetchEvent(url, eventNumber, locale)
+	if audit.Status != 0 {
+		logAudit(audit)
+	}
+	if err != nil {
+		return event, results, stats, err
+	}
+	event.URL = audit.FinalURL
+	return event, results, stats, nil
+}
+
+// fetchEvent fetches and parses an event's results page, recording what was
+// fetched. The audit's Status is 0 if no response was received.
+func fetchEvent(url string, eventNumber int, locale Locale) (Event, []Result, ParseStats, FetchAudit, error) {
+	audit := FetchAudit{URL: url, FinalURL: url}
+	resp, err := fetchPage(url)
+	if err != nil {
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) {
+			audit.Status = httpErr.StatusCode
+		}
+		return Event{}, nil, ParseStats{}, audit, err
+	}
+	defer resp.Body.Close()
+
+	audit.FinalURL = resp.Request.URL.String()
+	audit.Status = resp.StatusCode
+	page, err := io.ReadAll(resp.Body)
+	audit.Bytes = len(page)
+	if err != nil {
+		return Event{}, nil, ParseStats{}, audit, fmt.Errorf("failed to read response: %w", err)
+	}
 
-	return scrapeEvent(url, eventNumber)
+	event, results, stats, err := parseLocalisedEventHTML(bytes.NewReader(page), url, eventNumber, locale)
+	audit.Rows = len(results)
+	return event, results, stats, audit, err
 }
 
-func scrapeEvent(url string, eventNumber int) (Event, []Result, error) {
-	client := &http.Client{}
+// fetchPage requests a page from the results site, returning an *HTTPError
+// for error statuses. The caller must close the response body.
+func fetchPage(url string) (*http.Response, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return Event{}, nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
@@ -67,29 +446,153 @@ func scrapeEvent(url string, eventNumber int) (Event, []Result, error) {
 	req.Header.Set("Accept-Language", "en-US,en;q=0.5")
 	req.Header.Set("Connection", "keep-alive")
 
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return Event{}, nil, fmt.Errorf("failed to make HTTP request: %w", err)
+		return nil, fmt.Errorf("failed to make HTTP request: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		return Event{}, nil, &HTTPError{
-			StatusCode: resp.StatusCode,
-			Message:    "HTTP error",
+		resp.Body.Close()
+		retryAfter, hasRetryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+		return nil, &HTTPError{
+			StatusCode:    resp.StatusCode,
+			Message:       "HTTP error",
+			RetryAfter:    retryAfter,
+			HasRetryAfter: hasRetryAfter,
 		}
 	}
 
+	return resp, nil
+}
+
+// CheckLocation returns the number of a location's latest event
+func CheckLocation(urlSlug string) (int, error) {
+	return checkLocationAt(resultsBaseURL, urlSlug)
+}
+
+// checkLocationAt reads the latest event number from a location's latest results page on the given site
+func checkLocationAt(baseURL, urlSlug string) (int, error) {
+	url := fmt.Sprintf("%s/%s/results/latestresults/", baseURL, urlSlug)
+	resp, err := fetchPage(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
-		return Event{}, nil, fmt.Errorf("failed to parse HTML: %w", err)
+		return 0, fmt.Errorf("failed to parse HTML: %w", err)
 	}
 
-	// Extract event date from the page
-	dateText := doc.Find(".Results-header .format-date").Text()
-	log.Printf("Found date text: %s", dateText)
+	// The header shows the event number like "#123"
+	match := latestEventPattern.FindStringSubmatch(doc.Find(".Results-header h3").Text())
+	if match == nil {
+		return 0, fmt.Errorf("no event number found for %s", urlSlug)
+	}
+	return strconv.Atoi(match[1])
+}
+
+// eventsFeedURL is parkrun's feed of every event worldwide, which the event
+// maps on its country sites are drawn from
+var eventsFeedURL = "https://images.parkrun.com/events.json"
+
+// ListEventsForCountry returns the slug of every 5k event on a country's site,
+// e.g. parkrun.org.uk, in alphabetical order, from parkrun's events feed. The
+// slugs can then be scraped one by one with parse.
+func ListEventsForCountry(domain string) ([]string, error) {
+	resp, err := fetchPage(eventsFeedURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return parseEventsFeed(resp.Body, normaliseDomain(domain))
+}
+
+// normaliseDomain turns a site given as parkrun.org.uk, www.parkrun.org.uk or
+// https://www.parkrun.org.uk/ into parkrun.org.uk
+func normaliseDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	for _, scheme := range []string{"https://", "http://"} {
+		domain = strings.TrimPrefix(domain, scheme)
+	}
+	if i := strings.Index(domain, "/"); i >= 0 {
+		domain = domain[:i]
+	}
+	return strings.TrimPrefix(domain, "www.")
+}
+
+// eventsFeed is the part of parkrun's events feed needed to list a country's
+// events. Events belong to a country by code, and series 1 is the 5k events
+// rather than juniors.
+type eventsFeed struct {
+	Countries map[string]struct {
+		URL string `json:"url"`
+	} `json:"countries"`
+	Events struct {
+		Features []struct {
+			Properties struct {
+				EventName   string `json:"eventname"`
+				CountryCode int    `json:"countrycode"`
+				SeriesID    int    `json:"seriesid"`
+			} `json:"properties"`
+		} `json:"features"`
+	} `json:"events"`
+}
+
+// parseEventsFeed reads the slugs of the 5k events on the site for domain, as
+// normalised by normaliseDomain, from parkrun's events feed
+func parseEventsFeed(r io.Reader, domain string) ([]string, error) {
+	var feed eventsFeed
+	if err := json.NewDecoder(r).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("failed to parse events feed: %w", err)
+	}
+
+	countryCode := -1
+	for code, country := range feed.Countries {
+		if normaliseDomain(country.URL) == domain {
+			countryCode, _ = strconv.Atoi(code)
+			break
+		}
+	}
+	if countryCode < 0 {
+		return nil, fmt.Errorf("no country for %s in the events feed", domain)
+	}
+
+	var slugs []string
+	for _, feature := range feed.Events.Features {
+		event := feature.Properties
+		if event.CountryCode == countryCode && event.SeriesID == 1 && event.EventName != "" {
+			slugs = append(slugs, event.EventName)
+		}
+	}
+	if len(slugs) == 0 {
+		return nil, fmt.Errorf("no events found for %s", domain)
+	}
+
+	sort.Strings(slugs)
+	return slugs, nil
+}
+
+// latestEventPattern matches the event number in a results page header
+var latestEventPattern = regexp.MustCompile(`#(\d+)`)
+
+// parseEventHTML parses an English results page, counting any rows it skips.
+// It returns ErrResultsPending if the event has been held but its results
+// haven't been published yet.
+func parseEventHTML(r io.Reader, url string, eventNumber int) (Event, []Result, ParseStats, error) {
+	return parseLocalisedEventHTML(r, url, eventNumber, englishLocale)
+}
+
+// parseLocalisedEventHTML parses a results page like parseEventHTML, reading
+// run counts and dates in the given locale
+func parseLocalisedEventHTML(r io.Reader, url string, eventNumber int, locale Locale) (Event, []Result, ParseStats, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return Event{}, nil, ParseStats{}, fmt.Errorf("failed to parse HTML: %w", err)
+	}
 
-	eventDate, err := parseEventDate(dateText)
+	eventDate, err := parseHeaderDate(doc, locale)
 	if err != nil {
 		log.Printf("Warning: Could not parse date for event %d: %v", eventNumber, err)
 	}
@@ -98,63 +601,228 @@ func scrapeEvent(url string, eventNumber int) (Event, []Result, error) {
 		EventNumber: eventNumber,
 		Date:        eventDate,
 		URL:         url,
+		Inaugural:   isInauguralEvent(doc, eventNumber),
+		Volunteers:  ParseVolunteers(doc),
 	}
 
 	var results []Result
+	var stats ParseStats
 	processedRows := 0
-	skippedRows := 0
 
 	// Find all result rows using the correct class
 	resultRows := doc.Find(".Results-table-row")
 
+	if resultRows.Length() == 0 {
+		if isResultsPending(doc) {
+			return Event{}, nil, ParseStats{}, ErrResultsPending
+		}
+		// A cancelled event still has the results header and an empty table,
+		// so a page without either isn't one we can read
+		if doc.Find(".Results-header, .Results-table").Length() == 0 {
+			return Event{}, nil, ParseStats{}, fmt.Errorf("no results table found for event %d", eventNumber)
+		}
+		return event, nil, ParseStats{}, ErrNoResults
+	}
+
 	resultRows.Each(func(i int, s *goquery.Selection) {
 		// Get data attributes
 		position, _ := strconv.Atoi(s.AttrOr("data-position", "0"))
 		name := s.AttrOr("data-name", "")
 		ageGroup := s.AttrOr("data-agegroup", "")
+		if strings.TrimSpace(name) == "" {
+			log.Printf("Warning: No name for position %d", position)
+			stats.MissingName++
+			return
+		}
 
 		// Find the time cell
 		timeCell := s.Find(".Results-table-td--time .compact").Text()
 
 		// Get total runs from the detailed div
-		runsText := s.Find(".detailed").First().Text()
-		totalRuns := 0
-		if strings.Contains(runsText, "parkrun") {
-			runsStr := strings.Split(runsText, " ")[0]
-			totalRuns, _ = strconv.Atoi(runsStr)
+		totalRuns := locale.parseTotalRuns(s.Find(".detailed").First().Text())
+
+		// Get gender and position within gender, falling back to the age category
+		gender := s.AttrOr("data-gender", "")
+		if gender == "" {
+			gender = genderFromCategory(ageGroup)
 		}
+		genderPosition, _ := strconv.Atoi(strings.TrimSpace(s.Find(".Results-table-td--gender .detailed").Text()))
+
+		// Get the athlete ID from the link to their profile
+		athleteID := parseAthleteID(s.Find("a[href*='/parkrunner/']").First().AttrOr("href", ""))
+
+		club := strings.TrimSpace(s.AttrOr("data-club", ""))
 
 		// Get age grade and achievement
 		ageGrade := s.AttrOr("data-agegrade", "")
-		achievement := s.AttrOr("data-achievement", "")
+		achievement, hasAchievement := s.Attr("data-achievement")
 
-		time := strings.TrimSpace(timeCell)
+		time := extractTime(timeCell)
 		timeSeconds := 0
 		if name != "Unknown" {
 			timeSeconds, err = timeToSeconds(time)
 			if err != nil {
 				log.Printf("Warning: Could not parse time for position %d: %v", position, err)
-				skippedRows++
+				stats.BadTime++
 				return
 			}
 		}
 		result := Result{
-			Position:    position,
-			Name:        name,
-			Time:        time,
-			TimeSeconds: timeSeconds,
-			AgeGrade:    ageGrade,
-			AgeCategory: ageGroup,
-			Note:        achievement,
-			TotalRuns:   totalRuns,
+			Position:       position,
+			Name:           name,
+			Time:           time,
+			TimeSeconds:    timeSeconds,
+			AgeGrade:       ageGrade,
+			AgeCategory:    ageGroup,
+			Note:           achievement,
+			NoteMissing:    !hasAchievement,
+			TotalRuns:      totalRuns,
+			AthleteID:      athleteID,
+			Gender:         gender,
+			GenderPosition: genderPosition,
+			Club:           club,
 		}
 		results = append(results, result)
 		processedRows++
 
 	})
 
-	log.Printf("Processed %d rows, skipped %d invalid rows", processedRows, skippedRows)
-	return event, results, nil
+	log.Printf("Processed %d rows, skipped %d invalid rows", processedRows, stats.Skipped())
+	if event.Inaugural {
+		log.Printf("Event %d is the inaugural event, dated %s with %d results",
+			eventNumber, eventDate.Format("2006-01-02"), len(results))
+	}
+	return event, results, stats, nil
+}
+
+// ParseVolunteers reads the volunteers thanked on a results page, from the
+// links in the paragraph after the "Thanks to the volunteers" heading. A
+// link's data-role or title gives the volunteer's role, if there is one.
+func ParseVolunteers(doc *goquery.Document) []Volunteer {
+	var volunteers []Volunteer
+	seen := make(map[Volunteer]bool)
+	doc.Find("h2, h3").Each(func(i int, heading *goquery.Selection) {
+		if !strings.Contains(strings.ToLower(heading.Text()), "volunteer") {
+			return
+		}
+		heading.NextAllFiltered("p").First().Find("a").Each(func(i int, link *goquery.Selection) {
+			volunteer := Volunteer{
+				Name: strings.TrimSpace(link.Text()),
+				Role: strings.TrimSpace(link.AttrOr("data-role", link.AttrOr("title", ""))),
+			}
+			if volunteer.Name == "" || seen[volunteer] {
+				return
+			}
+			seen[volunteer] = true
+			volunteers = append(volunteers, volunteer)
+		})
+	})
+	return volunteers
+}
+
+// isInauguralEvent reports whether a results page is for a location's first event
+func isInauguralEvent(doc *goquery.Document, eventNumber int) bool {
+	return eventNumber == 1 || strings.Contains(strings.ToLower(doc.Find(".Results-header").Text()), "inaugural")
+}
+
+// parseTotalRuns gets a runner's total run count from English detail text like
+// "250 parkruns", "1st parkrun" or "100th parkrun!", returning 0 if there isn't one
+func parseTotalRuns(text string) int {
+	return englishLocale.parseTotalRuns(text)
+}
+
+// genderFromCategory works out gender from an age category like VW35-39
+func genderFromCategory(category string) string {
+	if len(category) < 2 {
+		return ""
+	}
+	switch category[1] {
+	case 'M':
+		return "Male"
+	case 'W':
+		return "Female"
+	}
+	return ""
+}
+
+// parseAthleteID gets the athlete ID from a profile link like /parkrunner/1234567
+func parseAthleteID(href string) int {
+	idx := strings.Index(href, "/parkrunner/")
+	if idx == -1 {
+		return 0
+	}
+	idStr := strings.Trim(href[idx+len("/parkrunner/"):], "/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP
+// date. It returns false if the header is missing or invalid.
+func parseRetryAfter(header string) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		// A date that has already passed means retry straight away
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// parseHeaderDate reads the event date from the results header. The header can
+// hold more than one date, so only the first is used, falling back to a
+// data-date attribute if its text can't be parsed. The inaugural event's page
+// can show its date in a banner outside the header, so with no date in the
+// header the first one on the page is used. Dates are read in the page's locale.
+func parseHeaderDate(doc *goquery.Document, locale Locale) (time.Time, error) {
+	header := doc.Find(".Results-header")
+	if header.Find(".format-date, [data-date]").Length() == 0 {
+		header = doc.Selection
+	}
+	dateText := header.Find(".format-date").First().Text()
+	log.Printf("Found date text: %s", dateText)
+
+	date, err := locale.parseDate(dateText)
+	if err == nil {
+		return date, nil
+	}
+
+	if dataDate, ok := header.Find("[data-date]").First().Attr("data-date"); ok {
+		dataDate = strings.TrimSpace(dataDate)
+		if date, dataErr := time.Parse("2006-01-02", dataDate); dataErr == nil {
+			return date, nil
+		}
+		if date, dataErr := locale.parseDate(dataDate); dataErr == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// parkrunFounded is the date of the first parkrun. No event can be earlier.
+var parkrunFounded = time.Date(2004, 10, 2, 0, 0, 0, 0, time.UTC)
+
+// maxEventDateAhead allows for time zones and events dated slightly ahead
+const maxEventDateAhead = 7 * 24 * time.Hour
+
+// isPlausibleEventDate reports whether an event date falls between parkrun's
+// founding and a week from now, catching dates that were parsed wrongly
+func isPlausibleEventDate(t time.Time) bool {
+	return !t.Before(parkrunFounded) && !t.After(clock.Now().Add(maxEventDateAhead))
 }
 
 func parseEventDate(dateText string) (time.Time, error) {
@@ -181,6 +849,16 @@ func parseEventDate(dateText string) (time.Time, error) {
 	return time.Time{}, lastErr
 }
 
+// extractTime returns the leading time in a time cell, dropping annotations
+// some layouts put alongside it, e.g. "23:45 PB" gives "23:45"
+func extractTime(cellText string) string {
+	fields := strings.Fields(cellText)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
 // timeToSeconds converts a time string (MM:SS or HH:MM:SS) to total seconds
 func timeToSeconds(timeStr string) (int, error) {
 	if timeStr == "" || timeStr == "Unknown" {
@@ -190,26 +868,26 @@ func timeToSeconds(timeStr string) (int, error) {
 	parts := strings.Split(timeStr, ":")
 	if len(parts) == 2 {
 		// MM:SS format
-		minutes, err := strconv.Atoi(parts[0])
+		minutes, err := parseTimePart(parts[0], -1)
 		if err != nil {
 			return 0, fmt.Errorf("invalid minutes: %v", err)
 		}
-		seconds, err := strconv.Atoi(parts[1])
+		seconds, err := parseTimePart(parts[1], 59)
 		if err != nil {
 			return 0, fmt.Errorf("invalid seconds: %v", err)
 		}
 		return minutes*60 + seconds, nil
 	} else if len(parts) == 3 {
 		// HH:MM:SS format
-		hours, err := strconv.Atoi(parts[0])
+		hours, err := parseTimePart(parts[0], -1)
 		if err != nil {
 			return 0, fmt.Errorf("invalid hours: %v", err)
 		}
-		minutes, err := strconv.Atoi(parts[1])
+		minutes, err := parseTimePart(parts[1], 59)
 		if err != nil {
 			return 0, fmt.Errorf("invalid minutes: %v", err)
 		}
-		seconds, err := strconv.Atoi(parts[2])
+		seconds, err := parseTimePart(parts[2], 59)
 		if err != nil {
 			return 0, fmt.Errorf("invalid seconds: %v", err)
 		}
@@ -217,3 +895,17 @@ func timeToSeconds(timeStr string) (int, error) {
 	}
 	return 0, fmt.Errorf("invalid time format")
 }
+
+// parseTimePart parses one component of a time, rejecting negative values and,
+// when limit is not -1, values above limit. Values outside the range would not
+// survive a round trip through secondsToTime.
+func parseTimePart(part string, limit int) (int, error) {
+	value, err := strconv.Atoi(part)
+	if err != nil {
+		return 0, err
+	}
+	if value < 0 || (limit != -1 && value > limit) {
+		return 0, fmt.Errorf("%d out of range", value)
+	}
+	return value, nil
+}
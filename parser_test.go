@@ -1,6 +1,20 @@
 package main
 
 import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -48,6 +62,24 @@ func TestTimeToSeconds(t *testing.T) {
 			want:    0,
 			wantErr: true,
 		},
+		{
+			name:    "Seconds out of range",
+			timeStr: "20:75",
+			want:    0,
+			wantErr: true,
+		},
+		{
+			name:    "Minutes out of range with hours",
+			timeStr: "1:60:00",
+			want:    0,
+			wantErr: true,
+		},
+		{
+			name:    "Negative seconds",
+			timeStr: "20:-5",
+			want:    0,
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -64,6 +96,37 @@ func TestTimeToSeconds(t *testing.T) {
 	}
 }
 
+func TestExtractTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		cellText string
+		want     string
+	}{
+		{"Plain time", "23:45", "23:45"},
+		{"PB badge", "23:45 PB", "23:45"},
+		{"Note and padding", " 1:02:03 New PB! ", "1:02:03"},
+		{"Line break in cell", "\n\t18:30\n\tPB\n", "18:30"},
+		{"Empty cell", "  ", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractTime(tt.cellText); got != tt.want {
+				t.Errorf("extractTime(%q) = %q, want %q", tt.cellText, got, tt.want)
+			}
+		})
+	}
+	// A runner with a badge in their time cell isn't skipped
+	page := fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "23:45 PB"))
+	_, results, stats, err := parseEventHTML(strings.NewReader(page), "http://example.com/1", 1)
+	if err != nil {
+		t.Fatalf("parseEventHTML failed: %v", err)
+	}
+	if len(results) != 1 || stats.BadTime != 0 || results[0].Time != "23:45" || results[0].TimeSeconds != 1425 {
+		t.Errorf("Unexpected results %+v with %s", results, stats)
+	}
+}
+
 func TestParseEventDate(t *testing.T) {
 	// Helper function to create time.Time values for comparison
 	date := func(year, month, day int) time.Time {
@@ -121,3 +184,835 @@ func TestParseEventDate(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+		wantOK bool
+	}{
+		{
+			name:   "Seconds",
+			header: "120",
+			want:   120 * time.Second,
+			wantOK: true,
+		},
+		{
+			name:   "Zero seconds",
+			header: "0",
+			want:   0,
+			wantOK: true,
+		},
+		{
+			name:   "Date in the past",
+			header: "Wed, 21 Oct 2015 07:28:00 GMT",
+			want:   0,
+			wantOK: true,
+		},
+		{
+			name:   "Empty",
+			header: "",
+			want:   0,
+			wantOK: false,
+		},
+		{
+			name:   "Negative seconds",
+			header: "-5",
+			want:   0,
+			wantOK: false,
+		},
+		{
+			name:   "Garbage",
+			header: "soon",
+			want:   0,
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.header)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseRetryAfter() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// A date in the future waits until then
+	future := time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)
+	got, ok := parseRetryAfter(future)
+	if !ok || got <= 85*time.Second || got > 90*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %v, %v, want about 90s", future, got, ok)
+	}
+}
+
+func TestTimeRoundTrip(t *testing.T) {
+	tests := []struct {
+		timeStr string
+		want    string
+	}{
+		{"59:59", "59:59"},
+		{"1:00:00", "1:00:00"},
+		{"1:02:03", "1:02:03"},
+		{"01:02:03", "1:02:03"},
+		{"05:07", "5:07"},
+		{"60:00", "1:00:00"},
+		{"0:00:01", "0:01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.timeStr, func(t *testing.T) {
+			seconds, err := timeToSeconds(tt.timeStr)
+			if err != nil {
+				t.Fatalf("timeToSeconds(%q) error = %v", tt.timeStr, err)
+			}
+			if got := secondsToTime(seconds); got != tt.want {
+				t.Errorf("secondsToTime(timeToSeconds(%q)) = %q, want %q", tt.timeStr, got, tt.want)
+			}
+		})
+	}
+
+	// Every second up to three hours, in each way parkrun might write it
+	for seconds := 1; seconds <= 3*3600; seconds++ {
+		hours, minutes, secs := seconds/3600, (seconds%3600)/60, seconds%60
+		want := fmt.Sprintf("%d:%02d", minutes, secs)
+		if hours > 0 {
+			want = fmt.Sprintf("%d:%02d:%02d", hours, minutes, secs)
+		}
+
+		for _, timeStr := range []string{
+			want,
+			fmt.Sprintf("%02d:%02d:%02d", hours, minutes, secs),
+			fmt.Sprintf("%d:%02d", hours*60+minutes, secs),
+		} {
+			got, err := timeToSeconds(timeStr)
+			if err != nil {
+				t.Fatalf("timeToSeconds(%q) error = %v", timeStr, err)
+			}
+			if got != seconds {
+				t.Fatalf("timeToSeconds(%q) = %d, want %d", timeStr, got, seconds)
+			}
+			if display := secondsToTime(got); display != want {
+				t.Fatalf("secondsToTime(%d) = %q, want %q", got, display, want)
+			}
+		}
+	}
+}
+
+func TestScrapeConfigTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	// Write the server's self-signed certificate out like a mirror's CA
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caPath, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  ScrapeConfig
+		wantErr bool
+	}{
+		{
+			name:    "System trust rejects self-signed",
+			config:  ScrapeConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "Custom CA",
+			config:  ScrapeConfig{CACertPath: caPath},
+			wantErr: false,
+		},
+		{
+			name:    "Insecure",
+			config:  ScrapeConfig{Insecure: true},
+			wantErr: false,
+		},
+		{
+			name:    "Custom TLS config",
+			config:  ScrapeConfig{TLSConfig: server.Client().Transport.(*http.Transport).TLSClientConfig},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := tt.config.NewHTTPClient()
+			if err != nil {
+				t.Fatalf("NewHTTPClient() error = %v", err)
+			}
+			resp, err := client.Get(server.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := (ScrapeConfig{CACertPath: filepath.Join(t.TempDir(), "missing.pem")}).NewHTTPClient(); err == nil {
+		t.Error("Expected an error for a missing CA file")
+	}
+}
+
+func TestParseEventHTMLCancelled(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "results_cancelled.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	event, results, _, err := parseEventHTML(f, "http://example.com/2", 2)
+	if !errors.Is(err, ErrNoResults) {
+		t.Errorf("Expected ErrNoResults, got %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Expected no results, got %d", len(results))
+	}
+	if want := time.Date(2024, 1, 13, 0, 0, 0, 0, time.UTC); !event.Date.Equal(want) {
+		t.Errorf("Expected the cancelled event's date %v, got %v", want, event.Date)
+	}
+
+	// A page that isn't a results page at all is a parse failure
+	_, _, _, err = parseEventHTML(strings.NewReader("<html><body><p>Something went wrong</p></body></html>"), "http://example.com/2", 2)
+	if err == nil || errors.Is(err, ErrNoResults) || errors.Is(err, ErrResultsPending) {
+		t.Errorf("Expected a parse error for a page without results, got %v", err)
+	}
+}
+
+func TestParseEventHTMLPending(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "results_pending.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	_, results, _, err := parseEventHTML(f, "http://example.com/2", 2)
+	if !errors.Is(err, ErrResultsPending) {
+		t.Errorf("Expected ErrResultsPending, got %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Expected no results, got %d", len(results))
+	}
+
+	// An ordinary page with results is not pending
+	page := fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30"))
+	_, results, _, err = parseEventHTML(strings.NewReader(page), "http://example.com/1", 1)
+	if err != nil {
+		t.Fatalf("parseEventHTML failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("Expected 1 result, got %d", len(results))
+	}
+}
+
+func TestParseAthleteID(t *testing.T) {
+	tests := []struct {
+		href string
+		want int
+	}{
+		{"https://www.parkrun.com.au/parkrunner/1234567", 1234567},
+		{"/parkrunner/89/", 89},
+		{"", 0},
+		{"https://www.parkrun.com.au/bushy/results/", 0},
+		{"/parkrunner/abc", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.href, func(t *testing.T) {
+			if got := parseAthleteID(tt.href); got != tt.want {
+				t.Errorf("parseAthleteID(%q) = %d, want %d", tt.href, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEventHTMLGenderPosition(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "results_gender.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	_, results, _, err := parseEventHTML(f, "http://example.com/1", 1)
+	if err != nil {
+		t.Fatalf("parseEventHTML failed: %v", err)
+	}
+
+	want := []struct {
+		name           string
+		gender         string
+		genderPosition int
+		athleteID      int
+		club           string
+	}{
+		{"Runner A", "Male", 1, 1001, ""},
+		{"Runner B", "Female", 1, 1002, "Test Harriers"},
+		{"Runner C", "Male", 2, 1003, ""},
+		{"Unknown", "", 0, 0, ""},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Expected %d results, got %d", len(want), len(results))
+	}
+	for i, w := range want {
+		got := results[i]
+		if got.Name != w.name || got.Gender != w.gender || got.GenderPosition != w.genderPosition || got.AthleteID != w.athleteID {
+			t.Errorf("Result %d: got %s %q position %d athlete %d, want %s %q position %d athlete %d",
+				i, got.Name, got.Gender, got.GenderPosition, got.AthleteID, w.name, w.gender, w.genderPosition, w.athleteID)
+		}
+		if got.Club != w.club {
+			t.Errorf("Result %d: got club %q, want %q", i, got.Club, w.club)
+		}
+	}
+
+	// Pages without a gender column fall back to the age category
+	page := fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30"))
+	_, results, _, err = parseEventHTML(strings.NewReader(page), "http://example.com/1", 1)
+	if err != nil {
+		t.Fatalf("parseEventHTML failed: %v", err)
+	}
+	if results[0].Gender != "Male" || results[0].GenderPosition != 0 {
+		t.Errorf("Expected Male with no gender position, got %q position %d", results[0].Gender, results[0].GenderPosition)
+	}
+}
+
+func TestParseEventHTMLMissingAchievement(t *testing.T) {
+	withNote := fakeResultRow(1, "Runner A", "18:30")
+	withoutNote := strings.Replace(fakeResultRow(2, "Runner B", "19:00"), ` data-achievement=""`, "", 1)
+	page := fakeResultsPage("06/01/2024", withNote, withoutNote)
+
+	_, results, _, err := parseEventHTML(strings.NewReader(page), "http://example.com/1", 1)
+	if err != nil {
+		t.Fatalf("parseEventHTML failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].NoteMissing {
+		t.Errorf("Expected an empty achievement to be read as no achievement")
+	}
+	if !results[1].NoteMissing {
+		t.Errorf("Expected a missing achievement to be marked as missing")
+	}
+}
+
+func TestParseTotalRuns(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"250 parkruns", 250},
+		{"1 parkrun", 1},
+		{"1st parkrun", 1},
+		{"100th parkrun!", 100},
+		{"Milestone: 22nd parkrun", 22},
+		{"53rd parkrun", 53},
+		{"  10 parkruns\n", 10},
+		{"", 0},
+		{"Unknown", 0},
+		{"3 volunteer credits", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := parseTotalRuns(tt.text); got != tt.want {
+				t.Errorf("parseTotalRuns(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckParkrunRedirect(t *testing.T) {
+	offDomain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "somewhere else")
+	}))
+	defer offDomain.Close()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old-slug/results/1/":
+			http.Redirect(w, r, server.URL+"/new-slug/results/1/", http.StatusMovedPermanently)
+		case "/moved/results/1/":
+			http.Redirect(w, r, offDomain.URL+"/moved/results/1/", http.StatusMovedPermanently)
+		default:
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	defer server.Close()
+
+	client, err := ScrapeConfig{}.NewHTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Redirects within the same site are followed
+	resp, err := client.Get(server.URL + "/old-slug/results/1/")
+	if err != nil {
+		t.Fatalf("Expected same-host redirect to be followed, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.Request.URL.Path != "/new-slug/results/1/" {
+		t.Errorf("Expected to end up at the new slug, got %s", resp.Request.URL.Path)
+	}
+
+	// Redirects to another host are refused
+	resp, err = client.Get(server.URL + "/moved/results/1/")
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrOffDomainRedirect) {
+		t.Errorf("Expected ErrOffDomainRedirect, got %v", err)
+	}
+}
+
+func TestIsParkrunHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"www.parkrun.com.au", true},
+		{"parkrun.org.uk", true},
+		{"WWW.PARKRUN.CO.NZ", true},
+		{"example.com", false},
+		{"parkrun.com.au.example.com", false},
+		{"notparkrun.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := isParkrunHost(tt.host); got != tt.want {
+				t.Errorf("isParkrunHost(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEventHTMLSkippedRows(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "results_skipped.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	_, results, stats, err := parseEventHTML(f, "http://example.com/1", 1)
+	if err != nil {
+		t.Fatalf("parseEventHTML failed: %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Errorf("Expected 2 results, got %d", len(results))
+	}
+	want := ParseStats{BadTime: 2, MissingName: 1}
+	if stats != want {
+		t.Errorf("parseEventHTML() stats = %+v, want %+v", stats, want)
+	}
+	if got := stats.String(); got != "skipped 3 rows: 2 bad time, 1 missing name" {
+		t.Errorf("Unexpected summary %q", got)
+	}
+
+	// Counts add up across pages
+	stats.Add(ParseStats{BadTime: 6, MissingName: 3})
+	if got := stats.String(); got != "skipped 12 rows: 8 bad time, 4 missing name" {
+		t.Errorf("Unexpected summary %q", got)
+	}
+}
+
+func TestFetchEventAudit(t *testing.T) {
+	page := fakeResultsPage("06/01/2024",
+		fakeResultRow(1, "Runner A", "20:00"),
+		fakeResultRow(2, "Runner B", "21:00"))
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old-slug/results/1/":
+			http.Redirect(w, r, server.URL+"/new-slug/results/1/", http.StatusMovedPermanently)
+		case "/new-slug/results/1/":
+			fmt.Fprint(w, page)
+		default:
+			http.Error(w, "too early", http.StatusTooEarly)
+		}
+	}))
+	defer server.Close()
+
+	url := server.URL + "/old-slug/results/1/"
+	_, _, _, audit, err := fetchEvent(url, 1, englishLocale)
+	if err != nil {
+		t.Fatalf("fetchEvent failed: %v", err)
+	}
+	want := FetchAudit{
+		URL:      url,
+		FinalURL: server.URL + "/new-slug/results/1/",
+		Status:   http.StatusOK,
+		Bytes:    len(page),
+		Rows:     2,
+	}
+	if audit != want {
+		t.Errorf("fetchEvent() audit = %+v, want %+v", audit, want)
+	}
+
+	// Error statuses are still recorded
+	_, _, _, audit, err = fetchEvent(server.URL+"/old-slug/results/2/", 2, englishLocale)
+	if err == nil {
+		t.Fatal("Expected an error for a missing event")
+	}
+	if audit.Status != http.StatusTooEarly || audit.Rows != 0 {
+		t.Errorf("Unexpected audit for missing event %+v", audit)
+	}
+
+	// The audit line is logged unless --quiet is set
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	defer func() { quiet = false }()
+
+	logAudit(want)
+	line := logged.String()
+	for _, field := range []string{"url=" + url, "final_url=" + want.FinalURL, "status=200", fmt.Sprintf("bytes=%d", len(page)), "rows=2"} {
+		if !strings.Contains(line, field) {
+			t.Errorf("Expected audit line to contain %q, got %q", field, line)
+		}
+	}
+
+	logged.Reset()
+	quiet = true
+	logAudit(want)
+	if logged.Len() != 0 {
+		t.Errorf("Expected nothing logged when quiet, got %q", logged.String())
+	}
+}
+
+func TestParseEventHTMLTwoDates(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "results_two_dates.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	event, results, _, err := parseEventHTML(f, "http://example.com/2", 2)
+	if err != nil {
+		t.Fatalf("parseEventHTML failed: %v", err)
+	}
+	if want := time.Date(2024, 1, 13, 0, 0, 0, 0, time.UTC); !event.Date.Equal(want) {
+		t.Errorf("Expected the event date %v, not the compiled date, got %v", want, event.Date)
+	}
+	if len(results) != 1 {
+		t.Errorf("Expected 1 result, got %d", len(results))
+	}
+
+	// Falls back to data-date when the text can't be parsed
+	page := `<div class="Results-header"><h3><span class="format-date" data-date="2024-01-20">Saturday</span></h3></div>` +
+		`<table class="Results-table"><tbody>` + fakeResultRow(1, "Runner A", "20:00") + `</tbody></table>`
+	event, _, _, err = parseEventHTML(strings.NewReader(page), "http://example.com/3", 3)
+	if err != nil {
+		t.Fatalf("parseEventHTML failed: %v", err)
+	}
+	if want := time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC); !event.Date.Equal(want) {
+		t.Errorf("Expected the data-date %v, got %v", want, event.Date)
+	}
+}
+
+// serveSOCKS5 runs a minimal SOCKS5 proxy without authentication on listener,
+// sending the address of each connection it makes to targets
+func serveSOCKS5(listener net.Listener, targets chan<- string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+
+			// Greeting: version, method count, methods. Reply with no auth.
+			header := make([]byte, 2)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return
+			}
+			if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+				return
+			}
+			conn.Write([]byte{5, 0})
+
+			// Request: version, CONNECT, reserved, address type, address, port
+			request := make([]byte, 4)
+			if _, err := io.ReadFull(conn, request); err != nil {
+				return
+			}
+			var host string
+			switch request[3] {
+			case 1:
+				ip := make([]byte, 4)
+				io.ReadFull(conn, ip)
+				host = net.IP(ip).String()
+			case 3:
+				length := make([]byte, 1)
+				io.ReadFull(conn, length)
+				name := make([]byte, length[0])
+				io.ReadFull(conn, name)
+				host = string(name)
+			default:
+				return
+			}
+			port := make([]byte, 2)
+			io.ReadFull(conn, port)
+			target := net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1])))
+			targets <- target
+
+			upstream, err := net.Dial("tcp", target)
+			if err != nil {
+				conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+				return
+			}
+			defer upstream.Close()
+			conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+			go io.Copy(upstream, conn)
+			io.Copy(conn, upstream)
+		}()
+	}
+}
+
+func TestScrapeConfigSOCKS5(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	targets := make(chan string, 10)
+	go serveSOCKS5(listener, targets)
+
+	client, err := ScrapeConfig{SOCKS5: listener.Addr().String()}.NewHTTPClient()
+	if err != nil {
+		t.Fatalf("NewHTTPClient() error = %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() through SOCKS5 failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("Expected the server's response, got %q", body)
+	}
+
+	select {
+	case target := <-targets:
+		if target != server.Listener.Addr().String() {
+			t.Errorf("Expected the proxy to connect to %s, got %s", server.Listener.Addr(), target)
+		}
+	default:
+		t.Error("Expected the request to go through the SOCKS5 proxy")
+	}
+}
+
+func TestParseEventHTMLInaugural(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "results_inaugural.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	event, results, stats, err := parseEventHTML(f, "http://example.com/1", 1)
+	if err != nil {
+		t.Fatalf("parseEventHTML failed: %v", err)
+	}
+
+	// The date is in the welcome banner rather than the header
+	if want := time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC); !event.Date.Equal(want) {
+		t.Errorf("Expected date %v, got %v", want, event.Date)
+	}
+	if !event.Inaugural {
+		t.Error("Expected event 1 to be marked inaugural")
+	}
+	if len(results) != 3 || stats.Skipped() != 0 {
+		t.Fatalf("Expected 3 results and none skipped, got %d and %s", len(results), stats)
+	}
+	if results[0].TotalRuns != 1 || results[1].TotalRuns != 120 || results[2].TotalRuns != 1 {
+		t.Errorf("Unexpected total runs %d, %d, %d", results[0].TotalRuns, results[1].TotalRuns, results[2].TotalRuns)
+	}
+
+	// Later events aren't inaugural
+	event, _, _, err = parseEventHTML(strings.NewReader(fakeResultsPage("13/01/2024", fakeResultRow(1, "Runner A", "18:00"))), "http://example.com/2", 2)
+	if err != nil {
+		t.Fatalf("parseEventHTML failed: %v", err)
+	}
+	if event.Inaugural {
+		t.Error("Expected event 2 not to be marked inaugural")
+	}
+}
+
+func TestParseLocalisedEventHTML(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "results_pl.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	event, results, stats, err := parseLocalisedEventHTML(f, "http://example.com/42", 42, localeFor("POL"))
+	if err != nil {
+		t.Fatalf("parseLocalisedEventHTML failed: %v", err)
+	}
+
+	if want := time.Date(2024, 1, 13, 0, 0, 0, 0, time.UTC); !event.Date.Equal(want) {
+		t.Errorf("Expected date %v, got %v", want, event.Date)
+	}
+	if len(results) != 3 || stats.Skipped() != 0 {
+		t.Fatalf("Expected 3 results and none skipped, got %d and %s", len(results), stats)
+	}
+	if results[0].TotalRuns != 57 || results[1].TotalRuns != 3 || results[2].TotalRuns != 1 {
+		t.Errorf("Unexpected total runs %d, %d, %d", results[0].TotalRuns, results[1].TotalRuns, results[2].TotalRuns)
+	}
+}
+
+func TestIsPlausibleEventDate(t *testing.T) {
+	tests := []struct {
+		name string
+		date time.Time
+		want bool
+	}{
+		{"first parkrun", parkrunFounded, true},
+		{"recent event", time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC), true},
+		{"today", time.Now(), true},
+		{"before parkrun began", time.Date(1923, 6, 5, 0, 0, 0, 0, time.UTC), false},
+		{"unparsed date", time.Time{}, false},
+		{"far future", time.Date(2099, 6, 5, 0, 0, 0, 0, time.UTC), false},
+		{"next month", time.Now().AddDate(0, 1, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPlausibleEventDate(tt.date); got != tt.want {
+				t.Errorf("isPlausibleEventDate(%v) = %v, want %v", tt.date, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEventsFeed(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "events.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	slugs, err := parseEventsFeed(f, "parkrun.com.au")
+	if err != nil {
+		t.Fatalf("parseEventsFeed failed: %v", err)
+	}
+
+	// Junior events and other countries' events are left out
+	want := []string{"albert-melbourne", "kawana", "southbank"}
+	if !reflect.DeepEqual(slugs, want) {
+		t.Errorf("parseEventsFeed() = %v, want %v", slugs, want)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseEventsFeed(f, "parkrun.co.nz"); err == nil {
+		t.Error("Expected an error for a country not in the feed")
+	}
+}
+
+func TestNormaliseDomain(t *testing.T) {
+	for _, domain := range []string{"parkrun.org.uk", "www.parkrun.org.uk", "https://www.parkrun.org.uk/", "HTTP://WWW.PARKRUN.ORG.UK/events/"} {
+		if got := normaliseDomain(domain); got != "parkrun.org.uk" {
+			t.Errorf("normaliseDomain(%q) = %q, want parkrun.org.uk", domain, got)
+		}
+	}
+}
+
+// hostRecorder sends every request to a test server, recording the host it was for
+type hostRecorder struct {
+	target *url.URL
+	hosts  []string
+}
+
+func (h *hostRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	h.hosts = append(h.hosts, req.URL.Host)
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = h.target.Scheme, h.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestParseResultsWithOptions(t *testing.T) {
+	server := newFakeParkrunServer(t, servePages(map[int]string{
+		1: fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30")),
+	}))
+	defer server.Close()
+
+	target, _ := url.Parse(server.URL)
+	recorder := &hostRecorder{target: target}
+	defer func(original *http.Client) { httpClient = original }(httpClient)
+	httpClient = &http.Client{Transport: recorder}
+
+	for _, domain := range []string{"parkrun.org.uk", "parkrun.us"} {
+		_, results, _, err := ParseResultsWithOptions("test-park", 1, ParseOptions{Domain: domain})
+		if err != nil {
+			t.Fatalf("ParseResultsWithOptions(%s) failed: %v", domain, err)
+		}
+		if len(results) != 1 {
+			t.Errorf("Expected 1 result from %s, got %d", domain, len(results))
+		}
+	}
+	want := []string{"www.parkrun.org.uk", "www.parkrun.us"}
+	if !reflect.DeepEqual(recorder.hosts, want) {
+		t.Errorf("Fetched from %v, want %v", recorder.hosts, want)
+	}
+
+	recorder.hosts = nil
+	domains := []string{"parkrun.org.uk", "parkrun.co.za", "parkrun.us", "parkrun.ca", "parkrun.de", "parkrun.pl"}
+	for _, domain := range domains {
+		if _, _, _, err := ParseResultsForDomain(domain, "test-park", 1); err != nil {
+			t.Fatalf("ParseResultsForDomain(%s) failed: %v", domain, err)
+		}
+	}
+	for i, domain := range domains {
+		if i >= len(recorder.hosts) || recorder.hosts[i] != "www."+domain {
+			t.Errorf("Expected a fetch from www.%s, fetched from %v", domain, recorder.hosts)
+		}
+	}
+
+	// The two-argument form still uses parkrun.com.au
+	recorder.hosts = nil
+	if _, _, _, err := ParseResults("test-park", 1); err != nil {
+		t.Fatalf("ParseResults failed: %v", err)
+	}
+	if len(recorder.hosts) != 1 || recorder.hosts[0] != target.Host {
+		t.Errorf("Expected ParseResults to use the default site, fetched from %v", recorder.hosts)
+	}
+}
+
+func TestParseVolunteers(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "results_volunteers.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	event, results, _, err := parseEventHTML(f, "http://example.com/2", 2)
+	if err != nil {
+		t.Fatalf("parseEventHTML failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("Expected volunteers not to be read as results, got %d results", len(results))
+	}
+
+	// Listed twice, and the volunteering link isn't a volunteer
+	want := []Volunteer{{Name: "Volunteer X"}, {Name: "Volunteer Y", Role: "Timekeeper"}}
+	if !reflect.DeepEqual(event.Volunteers, want) {
+		t.Errorf("Volunteers = %+v, want %+v", event.Volunteers, want)
+	}
+}
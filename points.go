@@ -0,0 +1,150 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunnerPoints is a runner's standing in a club points competition
+type RunnerPoints struct {
+	Name   string
+	Points int
+	Events int
+}
+
+// clubPointsScheme is the points awarded at each event by age-graded rank,
+// starting with first place. Runners ranked below the end of the scheme score
+// nothing. Set with points --scheme.
+var clubPointsScheme = []int{10, 9, 8, 7, 6, 5, 4, 3, 2, 1}
+
+// parsePointsScheme parses a comma-separated points scheme like "10,8,6"
+func parsePointsScheme(scheme string) ([]int, error) {
+	var points []int
+	for _, part := range strings.Split(scheme, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid points scheme %q", scheme)
+		}
+		points = append(points, value)
+	}
+	return points, nil
+}
+
+// GetClubPoints ranks runners by age grade at each event between fromDate and
+// toDate and totals the points clubPointsScheme gives them. Zero dates leave
+// that end of the window open. Results without a numeric age grade or below
+// minAgeGrade percent are ignored, and runners with equal age grades share a
+// rank.
+// Runners with an athlete ID are totalled under their current name.
+func GetClubPoints(db *sql.DB, locationID int, fromDate, toDate time.Time, minAgeGrade float64) ([]RunnerPoints, error) {
+	query := `
+		SELECT e.event_number, e.date, COALESCE(ru.name, r.name), r.age_grade
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		LEFT JOIN runners ru ON ru.id = r.runner_id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.name != 'Unknown'
+		ORDER BY e.event_number`
+
+	rows, err := db.Query(query, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	type gradedRun struct {
+		name     string
+		ageGrade float64
+	}
+	var eventNumbers []int
+	events := make(map[int][]gradedRun)
+	for rows.Next() {
+		var eventNumber int
+		var date time.Time
+		var name, ageGradeText string
+		if err := rows.Scan(&eventNumber, &date, &name, &ageGradeText); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		if (!fromDate.IsZero() && date.Before(fromDate)) || (!toDate.IsZero() && date.After(toDate)) {
+			continue
+		}
+		ageGrade, ok := parseAgeGrade(ageGradeText)
+		if !ok || ageGrade < minAgeGrade {
+			continue
+		}
+		if _, seen := events[eventNumber]; !seen {
+			eventNumbers = append(eventNumbers, eventNumber)
+		}
+		events[eventNumber] = append(events[eventNumber], gradedRun{name, ageGrade})
+	}
+
+	standings := make(map[string]*RunnerPoints)
+	for _, eventNumber := range eventNumbers {
+		runs := events[eventNumber]
+		sort.SliceStable(runs, func(i, j int) bool {
+			return runs[i].ageGrade > runs[j].ageGrade
+		})
+
+		rank := 0
+		for i, run := range runs {
+			if i == 0 || run.ageGrade != runs[i-1].ageGrade {
+				rank = i
+			}
+			standing, ok := standings[run.name]
+			if !ok {
+				standing = &RunnerPoints{Name: run.name}
+				standings[run.name] = standing
+			}
+			standing.Events++
+			if rank < len(clubPointsScheme) {
+				standing.Points += clubPointsScheme[rank]
+			}
+		}
+	}
+
+	var points []RunnerPoints
+	for _, standing := range standings {
+		points = append(points, *standing)
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].Points != points[j].Points {
+			return points[i].Points > points[j].Points
+		}
+		return points[i].Name < points[j].Name
+	})
+
+	return points, nil
+}
+
+// PrintClubPoints prints the club points standings for a location
+func PrintClubPoints(db *sql.DB, locationSlug string, fromDate, toDate time.Time, minAgeGrade float64) error {
+	locationID, err := getLocationID(db, locationSlug)
+	if err != nil {
+		return err
+	}
+	points, err := GetClubPoints(db, locationID, fromDate, toDate, minAgeGrade)
+	if err != nil {
+		return err
+	}
+
+	meta, err := reportMeta(db, locationID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n", heading("Club Points for %s", locationSlug))
+	printReportMeta(locationSlug, meta)
+	if len(points) == 0 {
+		fmt.Printf("No age-graded results found\n")
+		return nil
+	}
+	for i, p := range points {
+		fmt.Printf("%d. %s: %d points (%d events)\n", i+1, p.Name, p.Points, p.Events)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetClubPoints(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	oldScheme := clubPointsScheme
+	clubPointsScheme = []int{5, 3, 1}
+	defer func() { clubPointsScheme = oldScheme }()
+
+	// A third runner at event 2 who scores nothing, and an ungraded run that's ignored
+	_, err := db.Exec(`
+		INSERT INTO results (position, name, time_seconds, age_grade, age_category, total_runs, event_id) VALUES
+		(5, 'Runner E', 1600, '50.0%', 'SM25-29', 1, 2),
+		(6, 'Runner F', 1700, '', 'SM25-29', 1, 2),
+		(7, 'Unknown', 0, '', '', 0, 2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points, err := GetClubPoints(db, 1, time.Time{}, time.Time{}, 0)
+	if err != nil {
+		t.Fatalf("GetClubPoints failed: %v", err)
+	}
+
+	// Event 1: A 65.5 > B 60.2. Event 2: A 66.0 > D 65.8 > E 50.0
+	want := []RunnerPoints{
+		{Name: "Runner A", Points: 10, Events: 2},
+		{Name: "Runner B", Points: 3, Events: 1},
+		{Name: "Runner D", Points: 3, Events: 1},
+		{Name: "Runner E", Points: 1, Events: 1},
+	}
+	if !reflect.DeepEqual(points, want) {
+		t.Errorf("GetClubPoints() = %+v, want %+v", points, want)
+	}
+
+	// Only the second event falls in the window
+	points, err = GetClubPoints(db, 1, parseDate(t, "2023-01-05"), parseDate(t, "2023-01-31"), 0)
+	if err != nil {
+		t.Fatalf("GetClubPoints failed: %v", err)
+	}
+	want = []RunnerPoints{
+		{Name: "Runner A", Points: 5, Events: 1},
+		{Name: "Runner D", Points: 3, Events: 1},
+		{Name: "Runner E", Points: 1, Events: 1},
+	}
+	if !reflect.DeepEqual(points, want) {
+		t.Errorf("GetClubPoints() in window = %+v, want %+v", points, want)
+	}
+
+	// Runs below the minimum age grade don't score, so D moves up at event 2
+	points, err = GetClubPoints(db, 1, parseDate(t, "2023-01-05"), parseDate(t, "2023-01-31"), 60)
+	if err != nil {
+		t.Fatalf("GetClubPoints failed: %v", err)
+	}
+	want = []RunnerPoints{
+		{Name: "Runner A", Points: 5, Events: 1},
+		{Name: "Runner D", Points: 3, Events: 1},
+	}
+	if !reflect.DeepEqual(points, want) {
+		t.Errorf("GetClubPoints() with a minimum age grade = %+v, want %+v", points, want)
+	}
+}
+
+func TestParsePointsScheme(t *testing.T) {
+	points, err := parsePointsScheme("10, 8,6")
+	if err != nil {
+		t.Fatalf("parsePointsScheme failed: %v", err)
+	}
+	if !reflect.DeepEqual(points, []int{10, 8, 6}) {
+		t.Errorf("parsePointsScheme() = %v, want [10 8 6]", points)
+	}
+
+	for _, scheme := range []string{"", "10,x", "10,-1"} {
+		if _, err := parsePointsScheme(scheme); err == nil {
+			t.Errorf("Expected an error for scheme %q", scheme)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CourseRecord is a time that was the fastest at a location when it was run
+type CourseRecord struct {
+	Name        string
+	TimeSeconds int
+	EventNumber int
+	Date        time.Time
+}
+
+// courseRecordCategories are the age category prefixes records are kept for in
+// the report. An empty prefix covers every runner.
+var courseRecordCategories = []struct {
+	label, prefix string
+}{
+	{"Overall", ""},
+	{"Senior men", "SM"},
+	{"Senior women", "SW"},
+	{"Veteran men", "VM"},
+	{"Veteran women", "VW"},
+	{"Junior boys", "JM"},
+	{"Junior girls", "JW"},
+}
+
+// GetCourseRecord returns the fastest result at a location among runners
+// whose age category starts with genderPrefix, e.g. SM or SW, and the event it
+// was run at. If the time has been equalled, the first to run it holds the
+// record. It returns ErrNotFound if there are no such results.
+func GetCourseRecord(db *sql.DB, locationID int, genderPrefix string) (Result, Event, error) {
+	var result Result
+	var event Event
+	err := db.QueryRow(`
+		SELECT r.position, r.name, r.time_seconds, COALESCE(r.age_category, ''),
+			e.id, e.event_number, e.date
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.name != 'Unknown'
+		AND r.time_seconds > 0
+		AND r.age_category LIKE ? || '%'
+		ORDER BY r.time_seconds, e.date, r.position
+		LIMIT 1`, locationID, genderPrefix).Scan(&result.Position, &result.Name, &result.TimeSeconds,
+		&result.AgeCategory, &result.EventID, &event.EventNumber, &event.Date)
+	if err == sql.ErrNoRows {
+		return Result{}, Event{}, fmt.Errorf("course record for '%s' %w", genderPrefix, ErrNotFound)
+	}
+	if err != nil {
+		return Result{}, Event{}, fmt.Errorf("query error: %v", err)
+	}
+	result.Time = secondsToTime(result.TimeSeconds)
+	event.LocationID = locationID
+	return result, event, nil
+}
+
+// GetCourseRecordHistory returns each time that broke a location's record
+// among runners whose age category starts with genderPrefix, oldest first, so
+// the last is the current record
+func GetCourseRecordHistory(db *sql.DB, locationID int, genderPrefix string) ([]CourseRecord, error) {
+	rows, err := db.Query(`
+		SELECT r.name, r.time_seconds, e.event_number, e.date
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.name != 'Unknown'
+		AND r.time_seconds > 0
+		AND r.age_category LIKE ? || '%'
+		ORDER BY e.date, r.position`, locationID, genderPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var history []CourseRecord
+	for rows.Next() {
+		var record CourseRecord
+		if err := rows.Scan(&record.Name, &record.TimeSeconds, &record.EventNumber, &record.Date); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		// Equalling the record doesn't take it
+		if len(history) == 0 || record.TimeSeconds < history[len(history)-1].TimeSeconds {
+			history = append(history, record)
+		}
+	}
+	return history, rows.Err()
+}
+
+// printCourseRecordsSection prints the current record for each category and
+// how the overall record has come down
+func printCourseRecordsSection(db *sql.DB, locationID int, _ string) error {
+	fmt.Printf("\n%s\n", heading("Course Records"))
+	for _, category := range courseRecordCategories {
+		result, event, err := GetCourseRecord(db, locationID, category.prefix)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s %s at event #%d (%s)\n", category.label, result.Name, result.Time,
+			event.EventNumber, event.Date.Format("2 January 2006"))
+	}
+
+	history, err := GetCourseRecordHistory(db, locationID, "")
+	if err != nil {
+		return err
+	}
+	if len(history) > 1 {
+		fmt.Printf("\nOverall record progression:\n")
+		for _, record := range history {
+			fmt.Printf("%s %s at event #%d (%s)\n", secondsToTime(record.TimeSeconds), record.Name,
+				record.EventNumber, record.Date.Format("2 January 2006"))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetCourseRecord(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	result, event, err := GetCourseRecord(db, 1, "")
+	if err != nil {
+		t.Fatalf("GetCourseRecord failed: %v", err)
+	}
+	if result.Name != "Runner A" || result.TimeSeconds != 1180 || result.Time != "19:40" {
+		t.Errorf("Expected Runner A in 19:40, got %s in %s", result.Name, result.Time)
+	}
+	if event.EventNumber != 2 || !event.Date.Equal(parseDate(t, "2023-01-08")) {
+		t.Errorf("Expected event #2 on 2023-01-08, got #%d on %v", event.EventNumber, event.Date)
+	}
+
+	result, _, err = GetCourseRecord(db, 2, "VW")
+	if err != nil {
+		t.Fatalf("GetCourseRecord failed: %v", err)
+	}
+	if result.Name != "Runner C" || result.TimeSeconds != 1300 {
+		t.Errorf("Expected Runner C in 1300s, got %s in %ds", result.Name, result.TimeSeconds)
+	}
+
+	if _, _, err := GetCourseRecord(db, 1, "SW"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound with no senior women, got %v", err)
+	}
+}
+
+func TestGetCourseRecordHistory(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Runner E equals the record at a third event, which doesn't take it
+	if _, err := db.Exec(`INSERT INTO events (id, location_id, event_number, date, url) VALUES (4, 1, 3, '2023-01-15', 'url3')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO results (event_id, position, name, time_seconds, age_category) VALUES (4, 1, 'Runner E', 1180, 'VM40-44')`); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := GetCourseRecordHistory(db, 1, "VM")
+	if err != nil {
+		t.Fatalf("GetCourseRecordHistory failed: %v", err)
+	}
+	expected := []CourseRecord{
+		{Name: "Runner A", TimeSeconds: 1200, EventNumber: 1, Date: parseDate(t, "2023-01-01")},
+		{Name: "Runner A", TimeSeconds: 1180, EventNumber: 2, Date: parseDate(t, "2023-01-08")},
+	}
+	if len(history) != len(expected) {
+		t.Fatalf("Expected %d records, got %d: %+v", len(expected), len(history), history)
+	}
+	for i, want := range expected {
+		got := history[i]
+		if got.Name != want.Name || got.TimeSeconds != want.TimeSeconds || got.EventNumber != want.EventNumber || !got.Date.Equal(want.Date) {
+			t.Errorf("Record %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+
+	history, err = GetCourseRecordHistory(db, 1, "SW")
+	if err != nil {
+		t.Fatalf("GetCourseRecordHistory failed: %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("Expected no records for senior women, got %+v", history)
+	}
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"math"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,22 +22,170 @@ type RunnerStat struct {
 
 // TimeStats represents time statistics for a group
 type TimeStats struct {
-	Category string
-	Median   string
-	Count    int
+	Category      string
+	Median        string
+	MedianSeconds int
+	Count         int
 }
 
-// GetTopParticipants returns the runners with the most parkruns at a location
+// Achievement notes parkrun attaches to a result
+const (
+	firstTimerNote = "First Timer!"
+	newPBNote      = "New PB!"
+)
+
+// modalBandSeconds is the width of the finishing-time bands in the most common times report
+const modalBandSeconds = 30
+
+// ReportMeta records when a report was generated and the data it was generated from
+type ReportMeta struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	// Latest stored event at the location, 0 if there are none
+	LatestEvent     int       `json:"latest_event"`
+	LatestEventDate time.Time `json:"latest_event_date"`
+}
+
+// plateauMinRuns is how many timed runs make a runner a regular in the plateaued runners report
+const plateauMinRuns = 10
+
+// reportMilestones are the run counts listed in the milestones report section
+var reportMilestones = []int{50, 100}
+
+// improvementMinRuns is how many timed runs a runner needs to be in the improvement report
+const improvementMinRuns = 5
+
+// ImprovementStat compares a runner's first and latest times at a location.
+// ImprovementSeconds is negative if they've got slower.
+type ImprovementStat struct {
+	Name               string
+	FirstTime          int
+	LatestTime         int
+	ImprovementSeconds int
+	ImprovementPercent float64
+	RunCount           int
+}
+
+// CategoryDepth represents how many runners compete in an age category
+type CategoryDepth struct {
+	Category        string
+	DistinctRunners int
+	Finishes        int
+}
+
+// WeekdayStat represents events held on a particular day of the week
+type WeekdayStat struct {
+	Events          int
+	AvgParticipants float64
+	MedianTime      string
+}
+
+// LocationStats holds the headline stats for one location in the matrix
+type LocationStats struct {
+	Slug            string
+	TotalEvents     int
+	AvgParticipants float64
+	MedianSeconds   int
+	MedianAgeGrade  float64
+}
+
+// LastFinisher represents the last timed finisher at an event
+type LastFinisher struct {
+	EventNumber int
+	Date        time.Time
+	Position    int
+	// Name is empty when the last finisher was unknown
+	Name        string
+	TimeSeconds int
+	// Note is the event's note, if it has one
+	Note string
+}
+
+// FirstTimerPoint represents the number of first-timers at a single event
+type FirstTimerPoint struct {
+	EventNumber int
+	Date        time.Time
+	FirstTimers int
+	// Known is false when none of the event's results has a note, as for
+	// pages without achievement data, so first-timers couldn't be counted
+	Known bool
+}
+
+// EventSpread describes how spread out the finishing times were at a single event
+type EventSpread struct {
+	EventNumber    int
+	Date           time.Time
+	Finishers      int
+	FastestSeconds int
+	MedianSeconds  int
+	SlowestSeconds int
+	MeanSeconds    float64
+	// IQRSeconds is the gap between the first and third quartile times
+	IQRSeconds int
+}
+
+// EventPaceStat is the spread of paces at a single event, in seconds per km
+type EventPaceStat struct {
+	EventNumber int
+	Date        time.Time
+	Finishers   int
+	AveragePace float64
+	MedianPace  float64
+	FastestPace float64
+	SlowestPace float64
+}
+
+// TrendPoint is an event's median time smoothed over the events before it
+type TrendPoint struct {
+	EventNumber   int
+	Date          time.Time
+	MedianSeconds int
+	// AverageSeconds is the mean of the median times over the window ending at this event
+	AverageSeconds float64
+	// Window is how many events were averaged, fewer than asked for at the start
+	Window int
+}
+
+// EventAttendance is the number of participants at a single event
+type EventAttendance struct {
+	EventNumber  int
+	Date         time.Time
+	Participants int
+}
+
+// AttendanceGrowth compares average attendance at a location's first and last events
+type AttendanceGrowth struct {
+	// Window is how many events were averaged at each end. It is smaller than
+	// requested when the location has too few events.
+	Window      int
+	TotalEvents int
+	FirstAvg    float64
+	LastAvg     float64
+	// Rate is the change from FirstAvg to LastAvg as a fraction, e.g. 0.5 for 50% growth
+	Rate float64
+}
+
+// growthWindow is how many events are averaged at each end when comparing attendance growth
+const growthWindow = 12
+
+// GetTopParticipants returns the runners with the most parkruns at a location,
+// with their best time and best age grade there. A name's aliases are counted
+// under the canonical name, and runners with an athlete ID under their current
+// name in the runners table, so a runner who changes their name isn't split.
 func GetTopParticipants(db *sql.DB, locationID int, limit int) ([]RunnerStat, error) {
 	query := `
 		SELECT 
-			r.name,
-			COUNT(*) as run_count
+			COALESCE(a.canonical, ru.name, r.name) as runner_name,
+			COUNT(*) as run_count,
+			MIN(CASE WHEN r.time_seconds > 0 THEN r.time_seconds END),
+			MAX(CAST(REPLACE(r.age_grade, '%', '') AS REAL))
 		FROM results r
 		JOIN events e ON r.event_id = e.id
+		LEFT JOIN aliases a ON a.location_id = e.location_id AND a.alias = r.name
+		LEFT JOIN runners ru ON ru.id = r.runner_id
 		WHERE e.location_id = ?
+		AND e.excluded = 0
 		AND r.name != 'Unknown'
-		GROUP BY r.name
+		GROUP BY runner_name
 		ORDER BY run_count DESC
 		LIMIT ?`
 
@@ -47,26 +198,283 @@ func GetTopParticipants(db *sql.DB, locationID int, limit int) ([]RunnerStat, er
 	var stats []RunnerStat
 	for rows.Next() {
 		var stat RunnerStat
+		var bestSeconds sql.NullInt64
+		var ageGrade sql.NullFloat64
 		err := rows.Scan(
 			&stat.Name,
 			&stat.TotalRuns,
+			&bestSeconds,
+			&ageGrade,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("scan error: %v", err)
 		}
+		if bestSeconds.Valid {
+			stat.BestTime = secondsToTime(int(bestSeconds.Int64))
+		}
+		stat.AgeGrade = ageGrade.Float64
+		stats = append(stats, stat)
+	}
+
+	return stats, nil
+}
+
+// GetMilestoneRunners returns the runners who reached a milestone number of
+// parkruns at a location, in the order they did it. A runner counts if their
+// first result there with a total_runs of at least milestone is within 1 of it,
+// so runners who passed it elsewhere are left out. TotalRuns is their total
+// then and FirstEvent the date they reached it.
+func GetMilestoneRunners(db *sql.DB, locationID int, milestone int) ([]RunnerStat, error) {
+	rows, err := db.Query(`
+		WITH reached AS (
+			SELECT
+				r.name,
+				r.total_runs,
+				e.date,
+				ROW_NUMBER() OVER (
+					PARTITION BY CASE WHEN r.athlete_id > 0 THEN 'id:' || r.athlete_id ELSE 'name:' || r.name END
+					ORDER BY e.date, e.event_number
+				) AS n
+			FROM results r
+			JOIN events e ON r.event_id = e.id
+			WHERE e.location_id = ?
+			AND e.excluded = 0
+			AND r.name != 'Unknown'
+			AND r.total_runs >= ?
+		)
+		SELECT name, total_runs, date
+		FROM reached
+		WHERE n = 1
+		AND total_runs <= ? + 1
+		ORDER BY date, name`, locationID, milestone, milestone)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var runners []RunnerStat
+	for rows.Next() {
+		var runner RunnerStat
+		if err := rows.Scan(&runner.Name, &runner.TotalRuns, &runner.FirstEvent); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		runners = append(runners, runner)
+	}
+	return runners, rows.Err()
+}
+
+// printMilestoneRunners prints who reached each of the report milestones at a
+// location and when
+func printMilestoneRunners(db *sql.DB, locationID int, _ string) error {
+	fmt.Printf("\n%s\n", heading("Milestones"))
+	for _, milestone := range reportMilestones {
+		runners, err := GetMilestoneRunners(db, locationID, milestone)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\n--- %d parkruns ---\n", milestone)
+		if len(runners) == 0 {
+			fmt.Printf("None\n")
+			continue
+		}
+		for _, runner := range runners {
+			fmt.Printf("%s: %s\n", runner.Name, runner.FirstEvent.Format("2 January 2006"))
+		}
+	}
+	return nil
+}
+
+// GetTopAgeGraders returns the runners with the best age grades at a
+// location, best first, with AgeGrade their best there and TotalRuns all their
+// runs there. Age grades that aren't a percentage are skipped. Runners are
+// grouped like GetTopParticipants.
+func GetTopAgeGraders(db *sql.DB, locationID, limit int) ([]RunnerStat, error) {
+	rows, err := db.Query(`
+		SELECT COALESCE(a.canonical, ru.name, r.name) as runner_name, COALESCE(r.age_grade, '')
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		LEFT JOIN aliases a ON a.location_id = e.location_id AND a.alias = r.name
+		LEFT JOIN runners ru ON ru.id = r.runner_id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.name != 'Unknown'`, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	runners := make(map[string]*RunnerStat)
+	for rows.Next() {
+		var name, ageGradeText string
+		if err := rows.Scan(&name, &ageGradeText); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		runner, ok := runners[name]
+		if !ok {
+			runner = &RunnerStat{Name: name}
+			runners[name] = runner
+		}
+		runner.TotalRuns++
+		if ageGrade, ok := parseAgeGrade(ageGradeText); ok && ageGrade > runner.AgeGrade {
+			runner.AgeGrade = ageGrade
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+
+	var stats []RunnerStat
+	for _, runner := range runners {
+		if runner.AgeGrade > 0 {
+			stats = append(stats, *runner)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].AgeGrade != stats[j].AgeGrade {
+			return stats[i].AgeGrade > stats[j].AgeGrade
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats, nil
+}
+
+// GetRunnerPersonalBest returns a runner's fastest time at a location in
+// seconds and the date they first ran it. The name is matched as resolved by
+// GetPersonalBestReport, so a name from the report takes in the runner's
+// aliased runs. It returns ErrNotFound if they have no timed runs there.
+func GetRunnerPersonalBest(db *sql.DB, locationID int, name string) (int, time.Time, error) {
+	var bestSeconds int
+	var date time.Time
+	err := db.QueryRow(`
+		SELECT r.time_seconds, e.date
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		LEFT JOIN aliases a ON a.location_id = e.location_id AND a.alias = r.name
+		LEFT JOIN runners ru ON ru.id = r.runner_id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND COALESCE(a.canonical, ru.name, r.name) = ?
+		AND r.time_seconds > 0
+		ORDER BY r.time_seconds, e.date
+		LIMIT 1`, locationID, name).Scan(&bestSeconds, &date)
+	if err == sql.ErrNoRows {
+		return 0, time.Time{}, fmt.Errorf("personal best for '%s' %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("query error: %v", err)
+	}
+	return bestSeconds, date, nil
+}
+
+// GetPersonalBestReport returns the runners with the fastest personal bests
+// at a location, fastest first, with their run count, best age grade and
+// first and last runs. Runners are grouped like GetTopParticipants.
+func GetPersonalBestReport(db *sql.DB, locationID, limit int) ([]RunnerStat, error) {
+	rows, err := db.Query(`
+		SELECT
+			COALESCE(a.canonical, ru.name, r.name) as runner_name,
+			COUNT(*),
+			MIN(CASE WHEN r.time_seconds > 0 THEN r.time_seconds END) as best,
+			MAX(CAST(REPLACE(r.age_grade, '%', '') AS REAL)),
+			MIN(e.date),
+			MAX(e.date)
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		LEFT JOIN aliases a ON a.location_id = e.location_id AND a.alias = r.name
+		LEFT JOIN runners ru ON ru.id = r.runner_id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.name != 'Unknown'
+		GROUP BY runner_name
+		HAVING best IS NOT NULL
+		ORDER BY best, runner_name
+		LIMIT ?`, locationID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var stats []RunnerStat
+	for rows.Next() {
+		var stat RunnerStat
+		var bestSeconds int
+		var ageGrade sql.NullFloat64
+		var firstEvent, lastEvent string
+		if err := rows.Scan(&stat.Name, &stat.TotalRuns, &bestSeconds, &ageGrade, &firstEvent, &lastEvent); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		stat.BestTime = secondsToTime(bestSeconds)
+		stat.AgeGrade = ageGrade.Float64
+		if stat.FirstEvent, err = parseDateTime(firstEvent); err != nil {
+			return nil, err
+		}
+		if stat.LastEvent, err = parseDateTime(lastEvent); err != nil {
+			return nil, err
+		}
 		stats = append(stats, stat)
 	}
+	return stats, rows.Err()
+}
+
+// VolunteerStat is how often someone has volunteered at a location
+type VolunteerStat struct {
+	Name   string
+	Events int
+}
+
+// GetVolunteerStats returns the people who have volunteered at the most of a
+// location's events
+func GetVolunteerStats(db *sql.DB, locationID int, limit int) ([]VolunteerStat, error) {
+	rows, err := db.Query(`
+		SELECT
+			v.name,
+			COUNT(DISTINCT v.event_id) as volunteer_count
+		FROM volunteers v
+		JOIN events e ON v.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		GROUP BY v.name
+		ORDER BY volunteer_count DESC, v.name
+		LIMIT ?`, locationID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
 
+	var stats []VolunteerStat
+	for rows.Next() {
+		var stat VolunteerStat
+		if err := rows.Scan(&stat.Name, &stat.Events); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		stats = append(stats, stat)
+	}
 	return stats, nil
 }
 
+// printVolunteerStats prints a location's top volunteers
+func printVolunteerStats(stats []VolunteerStat) {
+	fmt.Printf("\n%s\n", heading("Top Volunteers"))
+	if len(stats) == 0 {
+		fmt.Printf("No volunteers recorded\n")
+		return
+	}
+	for i, stat := range stats {
+		fmt.Printf("%d. %s (%d events)\n", i+1, stat.Name, stat.Events)
+	}
+}
+
 // GetMedianTimesByAgeCategory calculates median finishing times by age category
 func GetMedianTimesByAgeCategory(db *sql.DB, locationID int) ([]TimeStats, error) {
 	query := `
 		SELECT age_category, time_seconds
 		FROM results r
 		JOIN events e ON r.event_id = e.id
-		WHERE e.location_id = ? 
+		WHERE e.location_id = ?
+		AND e.excluded = 0
 		AND time_seconds > 0
 		AND age_category != ''
 		ORDER BY age_category`
@@ -91,19 +499,12 @@ func GetMedianTimesByAgeCategory(db *sql.DB, locationID int) ([]TimeStats, error
 	// Calculate median for each category
 	var stats []TimeStats
 	for category, times := range categoryTimes {
-		sort.Ints(times)
-		var median int
-		n := len(times)
-		if n%2 == 0 && n > 0 {
-			// For even number of samples, average the two middle values
-			median = (times[n/2-1] + times[n/2]) / 2
-		} else if n > 0 {
-			median = times[n/2]
-		}
+		median := medianSeconds(times)
 		stats = append(stats, TimeStats{
-			Category: category,
-			Median:   secondsToTime(median),
-			Count:    len(times),
+			Category:      category,
+			Median:        secondsToTime(median),
+			MedianSeconds: median,
+			Count:         len(times),
 		})
 	}
 
@@ -115,117 +516,1392 @@ func GetMedianTimesByAgeCategory(db *sql.DB, locationID int) ([]TimeStats, error
 	return stats, nil
 }
 
-// GetLocationStats returns overall statistics for a location
-func GetLocationStats(db *sql.DB, locationID int) (map[string]interface{}, error) {
-	stats := make(map[string]interface{})
+// GetMedianTimesByGender returns the median time for men and women at a
+// location, keyed Male and Female, telling them apart by the age category's
+// prefix: JM, SM and VM for men and JW, SW and VW for women. Results whose
+// category is missing or doesn't start with one of those go under Unknown.
+func GetMedianTimesByGender(db *sql.DB, locationID int) (map[string]TimeStats, error) {
+	query := `
+		SELECT COALESCE(r.age_category, ''), r.time_seconds
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.time_seconds > 0`
 
-	// Get first and last event dates
-	var firstEventStr, lastEventStr string
-	err := db.QueryRow(`
+	rows, err := db.Query(query, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	genderTimes := make(map[string][]int)
+	for rows.Next() {
+		var category string
+		var timeSeconds int
+		if err := rows.Scan(&category, &timeSeconds); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		gender := genderFromCategory(category)
+		if gender == "" {
+			gender = "Unknown"
+		}
+		genderTimes[gender] = append(genderTimes[gender], timeSeconds)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+
+	stats := make(map[string]TimeStats)
+	for gender, times := range genderTimes {
+		median := medianSeconds(times)
+		stats[gender] = TimeStats{
+			Category:      gender,
+			Median:        secondsToTime(median),
+			MedianSeconds: median,
+			Count:         len(times),
+		}
+	}
+	return stats, nil
+}
+
+// GetModalTimeBand returns the busiest finishing-time band of bandSeconds for
+// each age category, e.g. "20:00-20:29" for 30-second bands. Ties go to the
+// faster band.
+func GetModalTimeBand(db *sql.DB, locationID int, bandSeconds int) (map[string]string, error) {
+	if bandSeconds <= 0 {
+		return nil, fmt.Errorf("band must be a positive number of seconds, got %d", bandSeconds)
+	}
+
+	query := `
 		SELECT 
-			MIN(date) as first_event,
-			MAX(date) as last_event
-		FROM events 
-		WHERE location_id = ?`, locationID).Scan(&firstEventStr, &lastEventStr)
+			age_category,
+			time_seconds / ? AS band,
+			COUNT(*) AS finishes
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND time_seconds > 0
+		AND age_category != ''
+		GROUP BY age_category, band
+		ORDER BY age_category, finishes DESC, band`
+
+	rows, err := db.Query(query, bandSeconds, locationID)
 	if err != nil {
-		return nil, fmt.Errorf("event dates error: %v", err)
+		return nil, fmt.Errorf("query error: %v", err)
 	}
+	defer rows.Close()
 
-	// Parse the date strings
-	firstEvent, err := parseDateTime(firstEventStr)
+	bands := make(map[string]string)
+	for rows.Next() {
+		var category string
+		var band, finishes int
+		if err := rows.Scan(&category, &band, &finishes); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		// Rows come busiest first within each category
+		if _, ok := bands[category]; ok {
+			continue
+		}
+		start := band * bandSeconds
+		bands[category] = fmt.Sprintf("%s-%s", secondsToTime(start), secondsToTime(start+bandSeconds-1))
+	}
+
+	return bands, nil
+}
+
+// printModalTimeBands prints the busiest finishing-time band in each age category
+func printModalTimeBands(bands map[string]string) {
+	categories := make([]string, 0, len(bands))
+	for category := range bands {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	fmt.Printf("\n%s\n", heading("Most Common Finishing Times by Age Category"))
+	for _, category := range categories {
+		fmt.Printf("%s: %s\n", category, bands[category])
+	}
+}
+
+// GetRunnerImprovementRate compares the first and latest times, by event
+// date, of each runner with at least minRuns timed runs at a location. The
+// most improved, as a percentage of their first time, come first. Runners
+// are grouped like GetTopParticipants.
+func GetRunnerImprovementRate(db *sql.DB, locationID, minRuns int) ([]ImprovementStat, error) {
+	rows, err := db.Query(`
+		SELECT COALESCE(a.canonical, ru.name, r.name) as runner_name, r.time_seconds
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		LEFT JOIN aliases a ON a.location_id = e.location_id AND a.alias = r.name
+		LEFT JOIN runners ru ON ru.id = r.runner_id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.name != 'Unknown'
+		AND r.time_seconds > 0
+		ORDER BY e.date, e.event_number`, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	runners := make(map[string]*ImprovementStat)
+	for rows.Next() {
+		var name string
+		var seconds int
+		if err := rows.Scan(&name, &seconds); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		stat, ok := runners[name]
+		if !ok {
+			stat = &ImprovementStat{Name: name, FirstTime: seconds}
+			runners[name] = stat
+			names = append(names, name)
+		}
+		stat.LatestTime = seconds
+		stat.RunCount++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+
+	var stats []ImprovementStat
+	for _, name := range names {
+		stat := runners[name]
+		if stat.RunCount < minRuns {
+			continue
+		}
+		stat.ImprovementSeconds = stat.FirstTime - stat.LatestTime
+		stat.ImprovementPercent = float64(stat.ImprovementSeconds) / float64(stat.FirstTime) * 100
+		stats = append(stats, *stat)
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].ImprovementPercent != stats[j].ImprovementPercent {
+			return stats[i].ImprovementPercent > stats[j].ImprovementPercent
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats, nil
+}
+
+// printImprovementRates prints how much each regular's time has come down
+// since their first run
+func printImprovementRates(stats []ImprovementStat) {
+	fmt.Printf("\n%s\n", heading("Most Improved Runners (at least %d timed runs)", improvementMinRuns))
+	if len(stats) == 0 {
+		fmt.Printf("None\n")
+		return
+	}
+	for _, stat := range stats {
+		change := fmt.Sprintf("%s faster", secondsToTime(stat.ImprovementSeconds))
+		if stat.ImprovementSeconds < 0 {
+			change = fmt.Sprintf("%s slower", secondsToTime(-stat.ImprovementSeconds))
+		}
+		fmt.Printf("%s: %s to %s, %s (%.1f%%) over %d runs\n", stat.Name,
+			secondsToTime(stat.FirstTime), secondsToTime(stat.LatestTime), change, stat.ImprovementPercent, stat.RunCount)
+	}
+}
+
+// GenderGap compares men's and women's median times in an age band
+type GenderGap struct {
+	AgeBand      string
+	MaleMedian   int
+	FemaleMedian int
+	MaleCount    int
+	FemaleCount  int
+	GapSeconds   int     // Female median minus male median
+	GapPercent   float64 // Gap as a percentage of the male median
+}
+
+// GetGenderGapByAge pairs men's and women's median times in each age band, like
+// 35-39 from VM35-39 and VW35-39. Bands without results for both are left out.
+func GetGenderGapByAge(db *sql.DB, locationID int) ([]GenderGap, error) {
+	query := `
+		SELECT r.age_category, COALESCE(r.gender, ''), r.time_seconds
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.time_seconds > 0
+		AND r.age_category != ''`
+
+	rows, err := db.Query(query, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	maleTimes := make(map[string][]int)
+	femaleTimes := make(map[string][]int)
+	for rows.Next() {
+		var category, gender string
+		var seconds int
+		if err := rows.Scan(&category, &gender, &seconds); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		if gender == "" {
+			gender = genderFromCategory(category)
+		}
+		band := ageBand(category)
+		if band == "" {
+			continue
+		}
+		switch gender {
+		case "Male":
+			maleTimes[band] = append(maleTimes[band], seconds)
+		case "Female":
+			femaleTimes[band] = append(femaleTimes[band], seconds)
+		}
+	}
+
+	var gaps []GenderGap
+	for band, male := range maleTimes {
+		female, ok := femaleTimes[band]
+		if !ok {
+			continue
+		}
+		gap := GenderGap{
+			AgeBand:      band,
+			MaleCount:    len(male),
+			FemaleCount:  len(female),
+			MaleMedian:   medianSeconds(male),
+			FemaleMedian: medianSeconds(female),
+		}
+		gap.GapSeconds = gap.FemaleMedian - gap.MaleMedian
+		gap.GapPercent = float64(gap.GapSeconds) / float64(gap.MaleMedian) * 100
+		gaps = append(gaps, gap)
+	}
+	sort.Slice(gaps, func(i, j int) bool {
+		return ageBandStart(gaps[i].AgeBand) < ageBandStart(gaps[j].AgeBand)
+	})
+
+	return gaps, nil
+}
+
+// ageBand returns the age range part of a category, like 35-39 from VM35-39
+func ageBand(category string) string {
+	if len(category) <= 2 {
+		return ""
+	}
+	return category[2:]
+}
+
+// ageBandStart returns the youngest age in a band, for sorting
+func ageBandStart(band string) int {
+	start, _ := strconv.Atoi(strings.SplitN(band, "-", 2)[0])
+	return start
+}
+
+// printGenderGaps prints the gap between men's and women's median times by age band
+func printGenderGaps(gaps []GenderGap) {
+	fmt.Printf("\n%s\n", heading("Gender Gap in Median Times by Age"))
+	if len(gaps) == 0 {
+		fmt.Printf("No age bands with both men's and women's results\n")
+		return
+	}
+	fmt.Printf("%-8s %10s %10s %8s %7s\n", "Age", "Men", "Women", "Gap", "Gap %")
+	for _, gap := range gaps {
+		fmt.Printf("%-8s %10s %10s %+7ds %+6.1f%%\n",
+			gap.AgeBand, secondsToTime(gap.MaleMedian), secondsToTime(gap.FemaleMedian),
+			gap.GapSeconds, gap.GapPercent)
+	}
+}
+
+// GetLocationStats returns overall statistics for a location
+func GetLocationStats(db *sql.DB, locationID int) (map[string]interface{}, error) {
+	stats := make(map[string]interface{})
+
+	// Get first and last event dates
+	var firstEventStr, lastEventStr string
+	err := db.QueryRow(`
+		SELECT 
+			MIN(date) as first_event,
+			MAX(date) as last_event
+		FROM events 
+		WHERE location_id = ?
+		AND excluded = 0`, locationID).Scan(&firstEventStr, &lastEventStr)
+	if err != nil {
+		return nil, fmt.Errorf("event dates error: %v", err)
+	}
+
+	// Parse the date strings
+	firstEvent, err := parseDateTime(firstEventStr)
+	if err != nil {
+		return nil, err
+	}
+	stats["first_event"] = firstEvent
+
+	lastEvent, err := parseDateTime(lastEventStr)
+	if err != nil {
+		return nil, err
+	}
+	stats["last_event"] = lastEvent
+
+	// Get biggest and smallest events
+	query := `
+		SELECT 
+			e.date,
+			COUNT(*) as participant_count
+		FROM events e
+		JOIN results r ON e.id = r.event_id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		GROUP BY e.id
+		ORDER BY participant_count DESC
+		LIMIT 1`
+
+	var biggestDate time.Time
+	var biggestCount int
+	err = db.QueryRow(query, locationID).Scan(&biggestDate, &biggestCount)
+	if err != nil {
+		return nil, fmt.Errorf("biggest event error: %v", err)
+	}
+	stats["biggest_event_date"] = biggestDate
+	stats["biggest_event_count"] = biggestCount
+
+	// Get smallest event
+	query = `
+		SELECT 
+			e.date,
+			COUNT(*) as participant_count
+		FROM events e
+		JOIN results r ON e.id = r.event_id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		GROUP BY e.id
+		ORDER BY participant_count ASC
+		LIMIT 1`
+
+	var smallestDate time.Time
+	var smallestCount int
+	err = db.QueryRow(query, locationID).Scan(&smallestDate, &smallestCount)
+	if err != nil {
+		return nil, fmt.Errorf("smallest event error: %v", err)
+	}
+	stats["smallest_event_date"] = smallestDate
+	stats["smallest_event_count"] = smallestCount
+
+	// Total number of events
+	var eventCount int
+	err = db.QueryRow(`
+		SELECT COUNT(*) 
+		FROM events 
+		WHERE location_id = ?
+		AND excluded = 0`, locationID).Scan(&eventCount)
+	if err != nil {
+		return nil, fmt.Errorf("event count error: %v", err)
+	}
+	stats["total_events"] = eventCount
+
+	// Total number of runners
+	var runnerCount int
+	err = db.QueryRow(`
+		SELECT COUNT(DISTINCT name) 
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0`, locationID).Scan(&runnerCount)
+	if err != nil {
+		return nil, fmt.Errorf("runner count error: %v", err)
+	}
+	stats["total_runners"] = runnerCount
+
+	// Average participants per event
+	var avgParticipants float64
+	err = db.QueryRow(`
+		SELECT AVG(participant_count)
+		FROM (
+			SELECT COUNT(*) as participant_count
+			FROM results r
+			JOIN events e ON r.event_id = e.id
+			WHERE e.location_id = ?
+			AND e.excluded = 0
+			GROUP BY e.id
+		) subquery`, locationID).Scan(&avgParticipants)
+	if err != nil {
+		return nil, fmt.Errorf("avg participants error: %v", err)
+	}
+	stats["avg_participants"] = avgParticipants
+
+	return stats, nil
+}
+
+// GetLocationAge returns how long a location has been running, from its first
+// event to now. A location with no events has an age of 0.
+func GetLocationAge(db *sql.DB, locationID int) (time.Duration, error) {
+	var firstEventStr sql.NullString
+	err := db.QueryRow(`
+		SELECT MIN(date)
+		FROM events
+		WHERE location_id = ?
+		AND excluded = 0`, locationID).Scan(&firstEventStr)
+	if err != nil {
+		return 0, fmt.Errorf("first event error: %v", err)
+	}
+	if !firstEventStr.Valid {
+		return 0, nil
+	}
+	firstEvent, err := parseDateTime(firstEventStr.String)
+	if err != nil {
+		return 0, err
+	}
+	return clock.Now().Sub(firstEvent), nil
+}
+
+// formatRunningFor describes the time from a location's first event to now in
+// whole years and months, e.g. "2 years, 3 months"
+func formatRunningFor(firstEvent, now time.Time) string {
+	months := (now.Year()-firstEvent.Year())*12 + int(now.Month()-firstEvent.Month())
+	if now.Day() < firstEvent.Day() {
+		months--
+	}
+	months = max(months, 0)
+	return fmt.Sprintf("%d years, %d months", months/12, months%12)
+}
+
+// GetCategoryDepth returns each age category's distinct runner and finish
+// counts, deepest categories first
+func GetCategoryDepth(db *sql.DB, locationID int) ([]CategoryDepth, error) {
+	query := `
+		SELECT 
+			r.age_category,
+			COUNT(DISTINCT r.name) as distinct_runners,
+			COUNT(*) as finishes
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.age_category != ''
+		AND r.name != 'Unknown'
+		GROUP BY r.age_category
+		ORDER BY distinct_runners DESC, finishes DESC, r.age_category`
+
+	rows, err := db.Query(query, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var depths []CategoryDepth
+	for rows.Next() {
+		var depth CategoryDepth
+		if err := rows.Scan(&depth.Category, &depth.DistinctRunners, &depth.Finishes); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		depths = append(depths, depth)
+	}
+
+	return depths, nil
+}
+
+// printCategoryDepth prints age categories ranked by field depth
+func printCategoryDepth(depths []CategoryDepth) {
+	fmt.Printf("\n%s\n", heading("Age Category Depth"))
+	for i, depth := range depths {
+		fmt.Printf("%d. %s: %d runners (%d finishes)\n",
+			i+1, depth.Category, depth.DistinctRunners, depth.Finishes)
+	}
+}
+
+// GetWeekdayStats groups a location's events by the day of the week they were
+// held, to compare special events like Christmas Day with the usual Saturdays
+func GetWeekdayStats(db *sql.DB, locationID int) (map[time.Weekday]WeekdayStat, error) {
+	query := `
+		SELECT e.id, e.date, COALESCE(r.time_seconds, 0)
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0`
+
+	rows, err := db.Query(query, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	events := make(map[time.Weekday]map[int]bool)
+	participants := make(map[time.Weekday]int)
+	times := make(map[time.Weekday][]int)
+	for rows.Next() {
+		var eventID, timeSeconds int
+		var date time.Time
+		if err := rows.Scan(&eventID, &date, &timeSeconds); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		weekday := date.Weekday()
+		if events[weekday] == nil {
+			events[weekday] = make(map[int]bool)
+		}
+		events[weekday][eventID] = true
+		participants[weekday]++
+		if timeSeconds > 0 {
+			times[weekday] = append(times[weekday], timeSeconds)
+		}
+	}
+
+	stats := make(map[time.Weekday]WeekdayStat)
+	for weekday, eventIDs := range events {
+		stats[weekday] = WeekdayStat{
+			Events:          len(eventIDs),
+			AvgParticipants: float64(participants[weekday]) / float64(len(eventIDs)),
+			MedianTime:      secondsToTime(medianSeconds(times[weekday])),
+		}
+	}
+
+	return stats, nil
+}
+
+// printWeekdayStats prints event stats for each day of the week events were held
+func printWeekdayStats(stats map[time.Weekday]WeekdayStat) {
+	fmt.Printf("\n%s\n", heading("Events by Day of Week"))
+	if len(stats) == 1 {
+		for weekday, stat := range stats {
+			fmt.Printf("All %d events were held on a %s\n", stat.Events, weekday)
+		}
+		return
+	}
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		stat, ok := stats[weekday]
+		if !ok {
+			continue
+		}
+		fmt.Printf("%-9s: %d events, %.1f avg participants, median time %s\n",
+			weekday, stat.Events, stat.AvgParticipants, stat.MedianTime)
+	}
+}
+
+// GetAllLocationStats returns headline stats for every location that has events
+func GetAllLocationStats(db *sql.DB) ([]LocationStats, error) {
+	slugs, err := GetAvailableLocations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var allStats []LocationStats
+	for _, slug := range slugs {
+		locationID, err := getLocationID(db, slug)
+		if err != nil {
+			return nil, err
+		}
+
+		// Locations added but never scraped have nothing to compare
+		var eventCount int
+		err = db.QueryRow(`
+			SELECT COUNT(*) FROM events 
+			WHERE location_id = ?
+			AND excluded = 0`, locationID).Scan(&eventCount)
+		if err != nil {
+			return nil, fmt.Errorf("event count error: %v", err)
+		}
+		if eventCount == 0 {
+			continue
+		}
+
+		stats, err := GetLocationStats(db, locationID)
+		if err != nil {
+			return nil, err
+		}
+		locationStats := LocationStats{
+			Slug:            slug,
+			TotalEvents:     stats["total_events"].(int),
+			AvgParticipants: stats["avg_participants"].(float64),
+		}
+
+		rows, err := db.Query(`
+			SELECT COALESCE(r.time_seconds, 0), COALESCE(r.age_grade, '')
+			FROM results r
+			JOIN events e ON r.event_id = e.id
+			WHERE e.location_id = ?
+			AND e.excluded = 0`, locationID)
+		if err != nil {
+			return nil, fmt.Errorf("query error: %v", err)
+		}
+		var times []int
+		var ageGrades []float64
+		for rows.Next() {
+			var timeSeconds int
+			var ageGradeStr string
+			if err := rows.Scan(&timeSeconds, &ageGradeStr); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("scan error: %v", err)
+			}
+			if timeSeconds > 0 {
+				times = append(times, timeSeconds)
+			}
+			if ageGrade, ok := parseAgeGrade(ageGradeStr); ok {
+				ageGrades = append(ageGrades, ageGrade)
+			}
+		}
+		rows.Close()
+
+		locationStats.MedianSeconds = medianSeconds(times)
+		if n := len(ageGrades); n > 0 {
+			sort.Float64s(ageGrades)
+			if n%2 == 0 {
+				locationStats.MedianAgeGrade = (ageGrades[n/2-1] + ageGrades[n/2]) / 2
+			} else {
+				locationStats.MedianAgeGrade = ageGrades[n/2]
+			}
+		}
+		allStats = append(allStats, locationStats)
+	}
+
+	return allStats, nil
+}
+
+// sortLocationStats sorts the matrix by a column: name, events, participants, median or agegrade
+func sortLocationStats(stats []LocationStats, column string) error {
+	var less func(a, b LocationStats) bool
+	switch column {
+	case "name":
+		less = func(a, b LocationStats) bool { return a.Slug < b.Slug }
+	case "events":
+		less = func(a, b LocationStats) bool { return a.TotalEvents > b.TotalEvents }
+	case "participants":
+		less = func(a, b LocationStats) bool { return a.AvgParticipants > b.AvgParticipants }
+	case "median":
+		less = func(a, b LocationStats) bool { return a.MedianSeconds < b.MedianSeconds }
+	case "agegrade":
+		less = func(a, b LocationStats) bool { return a.MedianAgeGrade > b.MedianAgeGrade }
+	default:
+		return fmt.Errorf("unknown sort column '%s' (use name, events, participants, median or agegrade)", column)
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return less(stats[i], stats[j]) })
+	return nil
+}
+
+// PrintLocationMatrix prints headline stats for every location in one table
+func PrintLocationMatrix(db *sql.DB, sortColumn string) error {
+	stats, err := GetAllLocationStats(db)
+	if err != nil {
+		return err
+	}
+	if err := sortLocationStats(stats, sortColumn); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n\n", heading("Location Matrix"))
+	fmt.Printf("%-30s %8s %14s %8s %10s\n", "Location", "Events", "Avg Runners", "Median", "Age Grade")
+	for _, s := range stats {
+		fmt.Printf("%-30s %8d %14.1f %8s %9.2f%%\n",
+			s.Slug, s.TotalEvents, s.AvgParticipants, secondsToTime(s.MedianSeconds), s.MedianAgeGrade)
+	}
+	return nil
+}
+
+// LocationStatus is how up to date a location's stored data is
+type LocationStatus struct {
+	Slug            string
+	LatestEvent     int
+	LatestEventDate time.Time
+	DaysSince       int
+	TotalResults    int
+}
+
+// GetLocationStatus returns the latest stored event and total results for
+// every location, sorted by slug. Locations with no events have a zero
+// LatestEvent.
+func GetLocationStatus(db *sql.DB) ([]LocationStatus, error) {
+	// Slugs used in more than one country are qualified, e.g. bushy:GBR
+	rows, err := db.Query(`
+		SELECT 
+			l.slug,
+			l.country,
+			(SELECT COUNT(*) FROM locations other WHERE other.slug = l.slug),
+			COALESCE(MAX(e.event_number), 0),
+			MAX(e.date),
+			(SELECT COUNT(*) FROM results r JOIN events re ON r.event_id = re.id WHERE re.location_id = l.id)
+		FROM locations l
+		LEFT JOIN events e ON e.location_id = l.id
+		GROUP BY l.id
+		ORDER BY l.slug, l.country`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying location status: %v", err)
+	}
+	defer rows.Close()
+
+	now := clock.Now()
+	var statuses []LocationStatus
+	for rows.Next() {
+		var status LocationStatus
+		var country string
+		var sharedBy int
+		var latestDateStr sql.NullString
+		if err := rows.Scan(&status.Slug, &country, &sharedBy, &status.LatestEvent, &latestDateStr, &status.TotalResults); err != nil {
+			return nil, fmt.Errorf("error scanning location status: %v", err)
+		}
+		if sharedBy > 1 {
+			status.Slug += ":" + country
+		}
+		if latestDateStr.Valid {
+			status.LatestEventDate, err = parseDateTime(latestDateStr.String)
+			if err != nil {
+				return nil, err
+			}
+			status.DaysSince = int(now.Sub(status.LatestEventDate).Hours() / 24)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// sortLocationStatus sorts locations by name, or by stale with the longest
+// since an event first. Locations with no events count as the most stale.
+func sortLocationStatus(statuses []LocationStatus, column string) error {
+	var less func(a, b LocationStatus) bool
+	switch column {
+	case "name":
+		less = func(a, b LocationStatus) bool { return a.Slug < b.Slug }
+	case "stale":
+		less = func(a, b LocationStatus) bool {
+			if (a.LatestEvent == 0) != (b.LatestEvent == 0) {
+				return a.LatestEvent == 0
+			}
+			return a.DaysSince > b.DaysSince
+		}
+	default:
+		return fmt.Errorf("unknown sort column '%s' (use name or stale)", column)
+	}
+	sort.SliceStable(statuses, func(i, j int) bool { return less(statuses[i], statuses[j]) })
+	return nil
+}
+
+// PrintLocationStatus prints one line per location showing how up to date it is
+func PrintLocationStatus(db *sql.DB, sortColumn string) error {
+	statuses, err := GetLocationStatus(db)
+	if err != nil {
+		return err
+	}
+	if err := sortLocationStatus(statuses, sortColumn); err != nil {
+		return err
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println("No locations found. Try parsing some data first.")
+		return nil
+	}
+	for _, s := range statuses {
+		if s.LatestEvent == 0 {
+			fmt.Printf("%-30s no events stored\n", s.Slug)
+			continue
+		}
+		discontinued := ""
+		if isOlderThanWeeks(s.LatestEventDate, discontinuedWeeks) {
+			discontinued = "  likely discontinued"
+		}
+		fmt.Printf("%-30s #%-5d %s %5dd ago %8d results%s\n",
+			s.Slug, s.LatestEvent, s.LatestEventDate.Format("2006-01-02"), s.DaysSince, s.TotalResults, discontinued)
+	}
+	return nil
+}
+
+// parseAgeGrade parses an age grade like "65.52%" into a number
+func parseAgeGrade(ageGrade string) (float64, bool) {
+	ageGrade = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(ageGrade), "%"))
+	value, err := strconv.ParseFloat(ageGrade, 64)
+	if err != nil || value <= 0 {
+		return 0, false
+	}
+	return value, true
+}
+
+// GetLastFinisherTrend returns the last timed finisher at each event for a
+// location. Events without any times have a zero TimeSeconds.
+func GetLastFinisherTrend(db *sql.DB, locationID int) ([]LastFinisher, error) {
+	query := `
+		SELECT 
+			e.event_number,
+			e.date,
+			COALESCE(r.position, 0),
+			COALESCE(r.name, ''),
+			COALESCE(r.time_seconds, 0),
+			COALESCE(e.event_note, '')
+		FROM events e
+		LEFT JOIN results r ON r.id = (
+			SELECT last.id 
+			FROM results last
+			WHERE last.event_id = e.id
+			AND last.time_seconds > 0
+			ORDER BY last.position DESC
+			LIMIT 1
+		)
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		ORDER BY e.event_number`
+
+	rows, err := db.Query(query, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var finishers []LastFinisher
+	for rows.Next() {
+		var finisher LastFinisher
+		err := rows.Scan(
+			&finisher.EventNumber,
+			&finisher.Date,
+			&finisher.Position,
+			&finisher.Name,
+			&finisher.TimeSeconds,
+			&finisher.Note,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		if finisher.Name == "Unknown" {
+			finisher.Name = ""
+		}
+		finishers = append(finishers, finisher)
+	}
+
+	return finishers, nil
+}
+
+// printLastFinisherTrend prints the last finisher's time at each event
+func printLastFinisherTrend(finishers []LastFinisher) {
+	fmt.Printf("\n%s\n", heading("Last Finisher by Event"))
+	for _, f := range finishers {
+		note := ""
+		if f.Note != "" {
+			note = fmt.Sprintf(" [%s]", f.Note)
+		}
+		if f.TimeSeconds == 0 {
+			fmt.Printf("#%d (%s): no times recorded%s\n", f.EventNumber, f.Date.Format("2 January 2006"), note)
+			continue
+		}
+		name := f.Name
+		if name == "" {
+			name = "Unknown"
+		}
+		fmt.Printf("#%d (%s): %s by %s (position %d)%s\n",
+			f.EventNumber, f.Date.Format("2 January 2006"), secondsToTime(f.TimeSeconds), name, f.Position, note)
+	}
+}
+
+// GetFirstTimerTrend returns the number of first-timers at each event for a
+// location. Results stored without achievement data have a NULL note, and an
+// event where every note is NULL is reported as unknown.
+func GetFirstTimerTrend(db *sql.DB, locationID int) ([]FirstTimerPoint, error) {
+	query := `
+		SELECT 
+			e.event_number,
+			e.date,
+			SUM(CASE WHEN r.note = ? THEN 1 ELSE 0 END) as first_timers,
+			COUNT(r.note) as noted
+		FROM events e
+		JOIN results r ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		GROUP BY e.id
+		ORDER BY e.event_number`
+
+	rows, err := db.Query(query, firstTimerNote, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var points []FirstTimerPoint
+	for rows.Next() {
+		var point FirstTimerPoint
+		var noted int
+		if err := rows.Scan(&point.EventNumber, &point.Date, &point.FirstTimers, &noted); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		point.Known = noted > 0
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// printFirstTimerTrend prints first-timer totals for each month
+func printFirstTimerTrend(points []FirstTimerPoint) {
+	fmt.Printf("\n%s\n", heading("First Timers by Month"))
+	if len(points) == 0 {
+		fmt.Printf("No events found\n")
+		return
+	}
+
+	var month string
+	var firstTimers, events int
+	known := true
+	flush := func() {
+		if !known {
+			fmt.Printf("%s: unknown (%d events)\n", month, events)
+			return
+		}
+		fmt.Printf("%s: %d first timers (%.1f per event)\n",
+			month, firstTimers, float64(firstTimers)/float64(events))
+	}
+
+	for _, point := range points {
+		pointMonth := point.Date.Format("January 2006")
+		if pointMonth != month && events > 0 {
+			flush()
+			firstTimers, events, known = 0, 0, true
+		}
+		month = pointMonth
+		events++
+		firstTimers += point.FirstTimers
+		known = known && point.Known
+	}
+	flush()
+}
+
+// GetFirstTimers returns the runners at one of a location's events, in finish
+// order, who hadn't run there before. Unlike parkrun's "First Timer!" note,
+// runners who have run at other locations are included. Runners are matched
+// by athlete ID, or by name for results without one, and excluded events
+// don't count as earlier runs. It returns ErrNotFound if there's no such event.
+func GetFirstTimers(db *sql.DB, locationID, eventNumber int) ([]string, error) {
+	var eventID int
+	err := db.QueryRow(`
+		SELECT id FROM events
+		WHERE location_id = ? AND event_number = ?`, locationID, eventNumber).Scan(&eventID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("event %d %w", eventNumber, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT r.name
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.id = ?
+		AND r.name != 'Unknown'
+		AND NOT EXISTS (
+			SELECT 1
+			FROM results earlier
+			JOIN events ee ON earlier.event_id = ee.id
+			WHERE ee.location_id = e.location_id
+			AND ee.excluded = 0
+			AND (ee.date < e.date OR (ee.date = e.date AND ee.event_number < e.event_number))
+			AND CASE WHEN r.athlete_id > 0 THEN earlier.athlete_id = r.athlete_id ELSE earlier.name = r.name END
+		)
+		ORDER BY r.position`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// GetFirstTimersByMonth counts the runners who first ran at a location in
+// each month, keyed like 2024-01. Runners are matched as in GetFirstTimers.
+func GetFirstTimersByMonth(db *sql.DB, locationID int) (map[string]int, error) {
+	rows, err := db.Query(`
+		SELECT date
+		FROM (
+			SELECT
+				e.date,
+				ROW_NUMBER() OVER (
+					PARTITION BY CASE WHEN r.athlete_id > 0 THEN 'id:' || r.athlete_id ELSE 'name:' || r.name END
+					ORDER BY e.date, e.event_number
+				) AS n
+			FROM results r
+			JOIN events e ON r.event_id = e.id
+			WHERE e.location_id = ?
+			AND e.excluded = 0
+			AND r.name != 'Unknown'
+		)
+		WHERE n = 1`, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	months := make(map[string]int)
+	for rows.Next() {
+		var date time.Time
+		if err := rows.Scan(&date); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		months[date.Format("2006-01")]++
+	}
+	return months, rows.Err()
+}
+
+// printFirstTimersByMonth prints how many runners first ran at a location in
+// each month, oldest first
+func printFirstTimersByMonth(months map[string]int) {
+	fmt.Printf("\n%s\n", heading("First Runs at This Location by Month"))
+	if len(months) == 0 {
+		fmt.Printf("No results\n")
+		return
+	}
+	keys := make([]string, 0, len(months))
+	for month := range months {
+		keys = append(keys, month)
+	}
+	sort.Strings(keys)
+	for _, month := range keys {
+		fmt.Printf("%s: %d\n", month, months[month])
+	}
+}
+
+// PrintEventFirstTimers lists the runners at one of a location's events who
+// hadn't run there before
+func PrintEventFirstTimers(db *sql.DB, locationSlug string, eventNumber int) error {
+	locationID, err := getLocationID(db, locationSlug)
+	if err != nil {
+		return err
+	}
+	names, err := GetFirstTimers(db, locationID, eventNumber)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n", heading("First Runs at %s #%d", locationSlug, eventNumber))
+	if len(names) == 0 {
+		fmt.Printf("Everyone had run here before\n")
+		return nil
+	}
+	for _, name := range names {
+		fmt.Printf("%s\n", name)
+	}
+	fmt.Printf("%d runners\n", len(names))
+	return nil
+}
+
+// GetEventSpread returns the fastest, median and slowest times at each of a
+// location's events, plus the interquartile range of its times. Events without
+// any times are left out.
+func GetEventSpread(db *sql.DB, locationID int) ([]EventSpread, error) {
+	query := `
+		SELECT e.event_number, e.date, r.time_seconds
+		FROM events e
+		JOIN results r ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.time_seconds > 0
+		ORDER BY e.event_number`
+
+	rows, err := db.Query(query, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var spreads []EventSpread
+	var times []int
+	flush := func() {
+		if len(spreads) == 0 {
+			return
+		}
+		spread := &spreads[len(spreads)-1]
+		sort.Ints(times)
+		spread.Finishers = len(times)
+		spread.FastestSeconds = times[0]
+		spread.MedianSeconds = medianSeconds(times)
+		spread.SlowestSeconds = times[len(times)-1]
+		total := 0
+		for _, t := range times {
+			total += t
+		}
+		spread.MeanSeconds = float64(total) / float64(len(times))
+		// The quartiles are the medians of the times either side of the median
+		half := len(times) / 2
+		lower := append([]int(nil), times[:half]...)
+		upper := append([]int(nil), times[len(times)-half:]...)
+		spread.IQRSeconds = medianSeconds(upper) - medianSeconds(lower)
+	}
+
+	for rows.Next() {
+		var eventNumber, timeSeconds int
+		var date time.Time
+		if err := rows.Scan(&eventNumber, &date, &timeSeconds); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		if len(spreads) == 0 || spreads[len(spreads)-1].EventNumber != eventNumber {
+			flush()
+			spreads = append(spreads, EventSpread{EventNumber: eventNumber, Date: date})
+			times = times[:0]
+		}
+		times = append(times, timeSeconds)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+	flush()
+
+	return spreads, nil
+}
+
+// printEventSpread prints the spread of finishing times at each event
+func printEventSpread(spreads []EventSpread) {
+	fmt.Printf("\n%s\n", heading("Finishing Time Spread by Event"))
+	if len(spreads) == 0 {
+		fmt.Printf("No timed events found\n")
+		return
+	}
+	for _, s := range spreads {
+		fmt.Printf("#%d (%s): fastest %s, median %s, slowest %s, IQR %s (%d finishers)\n",
+			s.EventNumber, s.Date.Format("2 January 2006"), secondsToTime(s.FastestSeconds),
+			secondsToTime(s.MedianSeconds), secondsToTime(s.SlowestSeconds), secondsToTime(s.IQRSeconds), s.Finishers)
+	}
+}
+
+// GetEventPaceStats returns the average, median, fastest and slowest pace at
+// each of a location's events, worked out from its configured distance so
+// 2km junior events are paced correctly. Events without any times are left out.
+func GetEventPaceStats(db *sql.DB, locationID int) ([]EventPaceStat, error) {
+	var distanceKm float64
+	err := db.QueryRow(`SELECT distance_km FROM locations WHERE id = ?`, locationID).Scan(&distanceKm)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("location %d %w", locationID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("distance error: %v", err)
+	}
+
+	spreads, err := GetEventSpread(db, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []EventPaceStat
+	for _, spread := range spreads {
+		stats = append(stats, EventPaceStat{
+			EventNumber: spread.EventNumber,
+			Date:        spread.Date,
+			Finishers:   spread.Finishers,
+			AveragePace: spread.MeanSeconds / distanceKm,
+			MedianPace:  float64(spread.MedianSeconds) / distanceKm,
+			FastestPace: float64(spread.FastestSeconds) / distanceKm,
+			SlowestPace: float64(spread.SlowestSeconds) / distanceKm,
+		})
+	}
+	return stats, nil
+}
+
+// formatPace formats a pace in seconds per km like "4:05/km"
+func formatPace(secondsPerKm float64) string {
+	seconds := int(math.Round(secondsPerKm))
+	return fmt.Sprintf("%d:%02d/km", seconds/60, seconds%60)
+}
+
+// printEventPaceStats prints the spread of paces at each event
+func printEventPaceStats(stats []EventPaceStat) {
+	fmt.Printf("\n%s\n", heading("Pace by Event"))
+	if len(stats) == 0 {
+		fmt.Printf("No timed events found\n")
+		return
+	}
+	for _, s := range stats {
+		fmt.Printf("#%d (%s): average %s, median %s, fastest %s, slowest %s\n",
+			s.EventNumber, s.Date.Format("2 January 2006"), formatPace(s.AveragePace),
+			formatPace(s.MedianPace), formatPace(s.FastestPace), formatPace(s.SlowestPace))
+	}
+}
+
+// medianTrendWindow is how many events the median time trend averages over
+const medianTrendWindow = 6
+
+// GetMedianTimeTrend returns each event's median finishing time at a location
+// in date order, with a moving average over the last windowEvents events.
+// Early events are averaged over the events so far.
+func GetMedianTimeTrend(db *sql.DB, locationID int, windowEvents int) ([]TrendPoint, error) {
+	if windowEvents < 1 {
+		return nil, fmt.Errorf("invalid window of %d events", windowEvents)
+	}
+	spreads, err := GetEventSpread(db, locationID)
 	if err != nil {
 		return nil, err
 	}
-	stats["first_event"] = firstEvent
+	sort.SliceStable(spreads, func(i, j int) bool {
+		return spreads[i].Date.Before(spreads[j].Date)
+	})
 
-	lastEvent, err := parseDateTime(lastEventStr)
+	var points []TrendPoint
+	total := 0
+	for i, spread := range spreads {
+		total += spread.MedianSeconds
+		if i >= windowEvents {
+			total -= spreads[i-windowEvents].MedianSeconds
+		}
+		window := min(i+1, windowEvents)
+		points = append(points, TrendPoint{
+			EventNumber:    spread.EventNumber,
+			Date:           spread.Date,
+			MedianSeconds:  spread.MedianSeconds,
+			AverageSeconds: float64(total) / float64(window),
+			Window:         window,
+		})
+	}
+	return points, nil
+}
+
+// printMedianTimeTrend prints each event's median time alongside its moving average
+func printMedianTimeTrend(points []TrendPoint) {
+	fmt.Printf("\n%s\n", heading("Median Time Trend (%d-event average)", medianTrendWindow))
+	if len(points) == 0 {
+		fmt.Printf("No timed events found\n")
+		return
+	}
+	for _, p := range points {
+		fmt.Printf("#%d (%s): median %s, average %s\n",
+			p.EventNumber, p.Date.Format("2 January 2006"), secondsToTime(p.MedianSeconds),
+			secondsToTime(int(math.Round(p.AverageSeconds))))
+	}
+}
+
+// GetEventGenderPodium returns the first three finishers of each gender at an
+// event, keyed by gender. Where the page had no gender positions they are
+// worked out from overall position.
+func GetEventGenderPodium(db *sql.DB, locationSlug string, eventNumber int) (map[string][]Result, error) {
+	locationID, err := getLocationID(db, locationSlug)
 	if err != nil {
 		return nil, err
 	}
-	stats["last_event"] = lastEvent
 
-	// Get biggest and smallest events
 	query := `
 		SELECT 
-			e.date,
-			COUNT(*) as participant_count
-		FROM events e
-		JOIN results r ON e.id = r.event_id
+			r.position,
+			r.name,
+			COALESCE(r.time_seconds, 0),
+			COALESCE(r.age_category, ''),
+			COALESCE(r.gender, ''),
+			COALESCE(r.gender_position, 0),
+			COALESCE(r.note, '')
+		FROM results r
+		JOIN events e ON r.event_id = e.id
 		WHERE e.location_id = ?
-		GROUP BY e.id
-		ORDER BY participant_count DESC
-		LIMIT 1`
+		AND e.event_number = ?
+		AND r.name != 'Unknown'
+		ORDER BY r.position`
 
-	var biggestDate time.Time
-	var biggestCount int
-	err = db.QueryRow(query, locationID).Scan(&biggestDate, &biggestCount)
+	rows, err := db.Query(query, locationID, eventNumber)
 	if err != nil {
-		return nil, fmt.Errorf("biggest event error: %v", err)
+		return nil, fmt.Errorf("query error: %v", err)
 	}
-	stats["biggest_event_date"] = biggestDate
-	stats["biggest_event_count"] = biggestCount
+	defer rows.Close()
 
-	// Get smallest event
-	query = `
-		SELECT 
-			e.date,
-			COUNT(*) as participant_count
-		FROM events e
-		JOIN results r ON e.id = r.event_id
-		WHERE e.location_id = ?
-		GROUP BY e.id
-		ORDER BY participant_count ASC
-		LIMIT 1`
+	podium := make(map[string][]Result)
+	for rows.Next() {
+		var result Result
+		err := rows.Scan(
+			&result.Position,
+			&result.Name,
+			&result.TimeSeconds,
+			&result.AgeCategory,
+			&result.Gender,
+			&result.GenderPosition,
+			&result.Note,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		if result.Gender == "" {
+			result.Gender = genderFromCategory(result.AgeCategory)
+		}
+		if result.Gender == "" || len(podium[result.Gender]) >= 3 {
+			continue
+		}
+		if result.GenderPosition == 0 {
+			result.GenderPosition = len(podium[result.Gender]) + 1
+		}
+		result.Time = secondsToTime(result.TimeSeconds)
+		podium[result.Gender] = append(podium[result.Gender], result)
+	}
 
-	var smallestDate time.Time
-	var smallestCount int
-	err = db.QueryRow(query, locationID).Scan(&smallestDate, &smallestCount)
+	return podium, nil
+}
+
+// PrintEventGenderPodium prints the top three of each gender at an event
+func PrintEventGenderPodium(db *sql.DB, locationSlug string, eventNumber int) error {
+	podium, err := GetEventGenderPodium(db, locationSlug, eventNumber)
 	if err != nil {
-		return nil, fmt.Errorf("smallest event error: %v", err)
+		return err
 	}
-	stats["smallest_event_date"] = smallestDate
-	stats["smallest_event_count"] = smallestCount
 
-	// Total number of events
-	var eventCount int
-	err = db.QueryRow(`
-		SELECT COUNT(*) 
-		FROM events 
-		WHERE location_id = ?`, locationID).Scan(&eventCount)
-	if err != nil {
-		return nil, fmt.Errorf("event count error: %v", err)
+	fmt.Printf("\n%s\n", heading("Podium for %s event %d", locationSlug, eventNumber))
+	if len(podium) == 0 {
+		fmt.Printf("No results found\n")
+		return nil
 	}
-	stats["total_events"] = eventCount
 
-	// Total number of runners
-	var runnerCount int
-	err = db.QueryRow(`
-		SELECT COUNT(DISTINCT name) 
-		FROM results r
-		JOIN events e ON r.event_id = e.id
-		WHERE e.location_id = ?`, locationID).Scan(&runnerCount)
+	note, err := GetEventNote(db, locationSlug, eventNumber)
 	if err != nil {
-		return nil, fmt.Errorf("runner count error: %v", err)
+		return err
+	}
+	if note != "" {
+		fmt.Printf("Note: %s\n", note)
 	}
-	stats["total_runners"] = runnerCount
 
-	// Average participants per event
-	var avgParticipants float64
-	err = db.QueryRow(`
-		SELECT AVG(participant_count)
-		FROM (
-			SELECT COUNT(*) as participant_count
-			FROM results r
-			JOIN events e ON r.event_id = e.id
-			WHERE e.location_id = ?
-			GROUP BY e.id
-		) subquery`, locationID).Scan(&avgParticipants)
-	if err != nil {
-		return nil, fmt.Errorf("avg participants error: %v", err)
+	genders := make([]string, 0, len(podium))
+	for gender := range podium {
+		genders = append(genders, gender)
 	}
-	stats["avg_participants"] = avgParticipants
+	sort.Strings(genders)
+
+	for _, gender := range genders {
+		fmt.Printf("\n--- %s ---\n", gender)
+		for _, result := range podium[gender] {
+			pb := ""
+			if result.Note == newPBNote {
+				pb = " " + highlight(newPBNote)
+			}
+			fmt.Printf("%d. %s %s (overall %d)%s\n",
+				result.GenderPosition, result.Name, result.Time, result.Position, pb)
+		}
+	}
+	return nil
+}
 
-	return stats, nil
+// reportMeta returns the metadata for a report on a location generated now
+func reportMeta(db *sql.DB, locationID int) (ReportMeta, error) {
+	meta := ReportMeta{GeneratedAt: clock.Now()}
+	err := db.QueryRow(`
+		SELECT event_number, date 
+		FROM events 
+		WHERE location_id = ? 
+		ORDER BY event_number DESC 
+		LIMIT 1`, locationID).Scan(&meta.LatestEvent, &meta.LatestEventDate)
+	if err != nil && err != sql.ErrNoRows {
+		return ReportMeta{}, fmt.Errorf("report meta error: %v", err)
+	}
+	return meta, nil
+}
+
+// printReportMeta prints a header line saying when a report was generated and how fresh its data is
+func printReportMeta(locationSlug string, meta ReportMeta) {
+	generated := meta.GeneratedAt.Format("2 January 2006 15:04")
+	if meta.LatestEvent == 0 {
+		fmt.Printf("Generated %s, no events stored for %s\n", generated, locationSlug)
+		return
+	}
+	fmt.Printf("Generated %s from %s data up to event #%d (%s)\n",
+		generated, locationSlug, meta.LatestEvent, meta.LatestEventDate.Format("2 January 2006"))
+}
+
+// medianSeconds returns the median of a list of times in seconds, sorting it in place
+func medianSeconds(times []int) int {
+	sort.Ints(times)
+	n := len(times)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 0 {
+		// For even number of samples, average the two middle values
+		return (times[n/2-1] + times[n/2]) / 2
+	}
+	return times[n/2]
 }
 
 // calculateMedianTime calculates the median time from a slice of time strings
@@ -239,10 +1915,14 @@ func calculateMedianTime(times []string) string {
 
 // GetAvailableLocations returns a list of all locations in the database
 func GetAvailableLocations(db *sql.DB) ([]string, error) {
+	// Slugs used in more than one country are qualified, e.g. bushy:GBR
 	rows, err := db.Query(`
-		SELECT slug 
-		FROM locations 
-		ORDER BY slug`)
+		SELECT 
+			slug,
+			country,
+			(SELECT COUNT(*) FROM locations other WHERE other.slug = l.slug) 
+		FROM locations l
+		ORDER BY slug, country`)
 	if err != nil {
 		return nil, fmt.Errorf("error querying locations: %v", err)
 	}
@@ -250,29 +1930,35 @@ func GetAvailableLocations(db *sql.DB) ([]string, error) {
 
 	var locations []string
 	for rows.Next() {
-		var slug string
-		if err := rows.Scan(&slug); err != nil {
+		var slug, country string
+		var sharedBy int
+		if err := rows.Scan(&slug, &country, &sharedBy); err != nil {
 			return nil, fmt.Errorf("error scanning location: %v", err)
 		}
+		if sharedBy > 1 {
+			slug += ":" + country
+		}
 		locations = append(locations, slug)
 	}
 	return locations, nil
 }
 
-// PrintReports prints various reports for a location
-func PrintReports(db *sql.DB, locationSlug string) error {
+// PrintReports prints the given report sections for a location
+func PrintReports(db *sql.DB, locationSlug string, sections []ReportSection) error {
 	// Get location ID
-	var locationID int
-	err := db.QueryRow(`SELECT id FROM locations WHERE slug = ?`, locationSlug).Scan(&locationID)
-	if err == sql.ErrNoRows {
+	locationID, found, err := findLocationID(db, locationSlug)
+	if err != nil {
+		return err
+	}
+	if !found {
 		// Get available locations
 		locations, err := GetAvailableLocations(db)
 		if err != nil {
-			return fmt.Errorf("location '%s' not found and error getting available locations: %v", locationSlug, err)
+			return fmt.Errorf("location '%s' %w and error getting available locations: %v", locationSlug, ErrNotFound, err)
 		}
 
 		// Build error message
-		msg := fmt.Sprintf("Location '%s' not found in database.\n\nAvailable locations:", locationSlug)
+		msg := "Available locations:"
 		if len(locations) == 0 {
 			msg += "\n  No locations found. Try parsing some data first."
 		} else {
@@ -280,20 +1966,223 @@ func PrintReports(db *sql.DB, locationSlug string) error {
 				msg += fmt.Sprintf("\n  %s", loc)
 			}
 		}
-		return fmt.Errorf(msg)
+		return fmt.Errorf("location '%s' %w in database.\n\n%s", locationSlug, ErrNotFound, msg)
 	}
+
+	meta, err := reportMeta(db, locationID)
 	if err != nil {
-		return fmt.Errorf("database error: %v", err)
+		return err
+	}
+	printReportMeta(locationSlug, meta)
+
+	for _, section := range sections {
+		if err := section.Print(db, locationID, locationSlug); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReportSection is a named part of a location's report
+type ReportSection struct {
+	Name string
+	// Optional sections are the heavier analyses, only printed when asked for
+	Optional bool
+	Print    func(db *sql.DB, locationID int, locationSlug string) error
+}
+
+// reportSections lists every report section in the order they're printed
+var reportSections = []ReportSection{
+	{Name: "overview", Print: printOverviewSection},
+	{Name: "participants", Print: printParticipantsSection},
+	{Name: "records", Print: printCourseRecordsSection},
+	{Name: "personal-bests", Print: func(db *sql.DB, locationID int, _ string) error {
+		runners, err := GetPersonalBestReport(db, locationID, 10)
+		if err != nil {
+			return err
+		}
+		printPersonalBests(runners)
+		return nil
+	}},
+	{Name: "age-graders", Print: func(db *sql.DB, locationID int, _ string) error {
+		runners, err := GetTopAgeGraders(db, locationID, 10)
+		if err != nil {
+			return err
+		}
+		printTopAgeGraders(runners)
+		return nil
+	}},
+	{Name: "depth", Print: func(db *sql.DB, locationID int, _ string) error {
+		depths, err := GetCategoryDepth(db, locationID)
+		if err != nil {
+			return err
+		}
+		printCategoryDepth(depths)
+		return nil
+	}},
+	{Name: "weekdays", Print: func(db *sql.DB, locationID int, _ string) error {
+		weekdays, err := GetWeekdayStats(db, locationID)
+		if err != nil {
+			return err
+		}
+		printWeekdayStats(weekdays)
+		return nil
+	}},
+	{Name: "last-finishers", Optional: true, Print: func(db *sql.DB, locationID int, _ string) error {
+		lastFinishers, err := GetLastFinisherTrend(db, locationID)
+		if err != nil {
+			return err
+		}
+		printLastFinisherTrend(lastFinishers)
+		return nil
+	}},
+	{Name: "first-timers", Optional: true, Print: func(db *sql.DB, locationID int, _ string) error {
+		firstTimers, err := GetFirstTimerTrend(db, locationID)
+		if err != nil {
+			return err
+		}
+		printFirstTimerTrend(firstTimers)
+		return nil
+	}},
+	{Name: "location-first-timers", Optional: true, Print: func(db *sql.DB, locationID int, _ string) error {
+		months, err := GetFirstTimersByMonth(db, locationID)
+		if err != nil {
+			return err
+		}
+		printFirstTimersByMonth(months)
+		return nil
+	}},
+	{Name: "spread", Optional: true, Print: func(db *sql.DB, locationID int, _ string) error {
+		spreads, err := GetEventSpread(db, locationID)
+		if err != nil {
+			return err
+		}
+		printEventSpread(spreads)
+		return nil
+	}},
+	{Name: "pace", Optional: true, Print: func(db *sql.DB, locationID int, _ string) error {
+		stats, err := GetEventPaceStats(db, locationID)
+		if err != nil {
+			return err
+		}
+		printEventPaceStats(stats)
+		return nil
+	}},
+	{Name: "median-trend", Optional: true, Print: func(db *sql.DB, locationID int, _ string) error {
+		points, err := GetMedianTimeTrend(db, locationID, medianTrendWindow)
+		if err != nil {
+			return err
+		}
+		printMedianTimeTrend(points)
+		return nil
+	}},
+	{Name: "plateaued", Optional: true, Print: func(db *sql.DB, locationID int, _ string) error {
+		plateaued, err := GetPlateauedRunners(db, locationID, plateauMinRuns)
+		if err != nil {
+			return err
+		}
+		printPlateauedRunners(plateaued)
+		return nil
+	}},
+	{Name: "compare-improvement", Optional: true, Print: func(db *sql.DB, locationID int, _ string) error {
+		stats, err := GetRunnerImprovementRate(db, locationID, improvementMinRuns)
+		if err != nil {
+			return err
+		}
+		printImprovementRates(stats)
+		return nil
+	}},
+	{Name: "milestones", Optional: true, Print: printMilestoneRunners},
+	{Name: "time-bands", Optional: true, Print: func(db *sql.DB, locationID int, _ string) error {
+		bands, err := GetModalTimeBand(db, locationID, modalBandSeconds)
+		if err != nil {
+			return err
+		}
+		printModalTimeBands(bands)
+		return nil
+	}},
+	{Name: "median-times", Print: printMedianTimesSection},
+	{Name: "gender-medians", Print: func(db *sql.DB, locationID int, _ string) error {
+		stats, err := GetMedianTimesByGender(db, locationID)
+		if err != nil {
+			return err
+		}
+		printMedianTimesByGender(stats)
+		return nil
+	}},
+	{Name: "gender-gap", Optional: true, Print: func(db *sql.DB, locationID int, _ string) error {
+		gaps, err := GetGenderGapByAge(db, locationID)
+		if err != nil {
+			return err
+		}
+		printGenderGaps(gaps)
+		return nil
+	}},
+	{Name: "volunteers", Optional: true, Print: func(db *sql.DB, locationID int, _ string) error {
+		stats, err := GetVolunteerStats(db, locationID, 10)
+		if err != nil {
+			return err
+		}
+		printVolunteerStats(stats)
+		return nil
+	}},
+}
+
+// selectReportSections returns the default report sections plus any named
+// ones, or every section if all is set
+func selectReportSections(names []string, all bool) ([]ReportSection, error) {
+	requested := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, section := range reportSections {
+			if section.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown report section '%s' (use %s)", name, strings.Join(reportSectionNames(), ", "))
+		}
+		requested[name] = true
 	}
 
-	// Print location stats
+	var sections []ReportSection
+	for _, section := range reportSections {
+		if all || !section.Optional || requested[section.Name] {
+			sections = append(sections, section)
+		}
+	}
+	return sections, nil
+}
+
+// reportSectionNames returns the name of every report section
+func reportSectionNames() []string {
+	var names []string
+	for _, section := range reportSections {
+		names = append(names, section.Name)
+	}
+	return names
+}
+
+// printOverviewSection prints a location's overall statistics
+func printOverviewSection(db *sql.DB, locationID int, locationSlug string) error {
 	stats, err := GetLocationStats(db, locationID)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("\n=== Overall Statistics for %s ===\n", locationSlug)
+	age, err := GetLocationAge(db, locationID)
+	if err != nil {
+		return err
+	}
+	now := clock.Now()
+	fmt.Printf("\n%s\n", heading("Overall Statistics for %s", locationSlug))
 	fmt.Printf("First Event: %s\n", stats["first_event"].(time.Time).Format("2 January 2006"))
 	fmt.Printf("Last Event: %s\n", stats["last_event"].(time.Time).Format("2 January 2006"))
+	fmt.Printf("Running for %s\n", formatRunningFor(now.Add(-age), now))
 	fmt.Printf("Total Events: %d\n", stats["total_events"])
 	fmt.Printf("Total Unique Runners: %d\n", stats["total_runners"])
 	fmt.Printf("Average Participants per Event: %.1f\n", stats["avg_participants"])
@@ -303,19 +2192,72 @@ func PrintReports(db *sql.DB, locationSlug string) error {
 	fmt.Printf("Smallest Event: %d runners (%s)\n",
 		stats["smallest_event_count"],
 		stats["smallest_event_date"].(time.Time).Format("2 January 2006"))
+	return nil
+}
 
-	// Print top participants
+// printParticipantsSection prints the runners with the most runs at a location
+func printParticipantsSection(db *sql.DB, locationID int, _ string) error {
 	runners, err := GetTopParticipants(db, locationID, 10)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("\n=== Top 10 Participants ===\n")
+	fmt.Printf("\n%s\n", heading("Top 10 Participants"))
 	for i, runner := range runners {
 		fmt.Printf("%d. %s (%d runs)\n",
 			i+1, runner.Name, runner.TotalRuns)
 	}
+	return nil
+}
+
+// categoryGroup returns the group an age category's median time is shown
+// under: Juniors, Men, Women, or Other for categories too short to have a
+// two-letter prefix or with one that isn't parkrun's
+func categoryGroup(category string) string {
+	if len(category) < 2 {
+		return "Other"
+	}
+	switch category[:2] {
+	case "JM", "JW":
+		return "Juniors"
+	case "SM", "VM":
+		return "Men"
+	case "SW", "VW":
+		return "Women"
+	}
+	return "Other"
+}
+
+// printTopAgeGraders prints the best age grades at a location
+func printTopAgeGraders(runners []RunnerStat) {
+	fmt.Printf("\n%s\n", heading("Top Age Graders"))
+	if len(runners) == 0 {
+		fmt.Printf("No age-graded results\n")
+		return
+	}
+	for i, runner := range runners {
+		fmt.Printf("%d. %s %.2f%% (%d runs)\n", i+1, runner.Name, runner.AgeGrade, runner.TotalRuns)
+	}
+}
+
+// printPersonalBests prints the fastest personal bests at a location
+func printPersonalBests(runners []RunnerStat) {
+	fmt.Printf("\n%s\n", heading("Personal Bests"))
+	if len(runners) == 0 {
+		fmt.Printf("No timed results\n")
+		return
+	}
+	for i, runner := range runners {
+		ageGrade := ""
+		if runner.AgeGrade > 0 {
+			ageGrade = fmt.Sprintf(", best age grade %.2f%%", runner.AgeGrade)
+		}
+		fmt.Printf("%d. %s %s (%d runs%s)\n", i+1, runner.Name, runner.BestTime, runner.TotalRuns, ageGrade)
+	}
+}
 
-	// Print median times by age category with grouping
+// printMedianTimesSection prints median times by age category, grouped into
+// juniors, men and women
+func printMedianTimesSection(db *sql.DB, locationID int, _ string) error {
 	times, err := GetMedianTimesByAgeCategory(db, locationID)
 	if err != nil {
 		return err
@@ -326,19 +2268,7 @@ func PrintReports(db *sql.DB, locationSlug string) error {
 	groupTimes := make(map[string][]string) // Store all times for each group
 
 	for _, stat := range times {
-		prefix := stat.Category[:2]
-		var groupName string
-		switch prefix {
-		case "JM", "JW":
-			groupName = "Juniors"
-		case "SM", "VM":
-			groupName = "Men"
-		case "SW", "VW":
-			groupName = "Women"
-		default:
-			groupName = "Other"
-		}
-
+		groupName := categoryGroup(stat.Category)
 		groups[groupName] = append(groups[groupName], stat)
 		// Add this category's times to the group's overall times
 		for i := 0; i < stat.Count; i++ {
@@ -347,7 +2277,7 @@ func PrintReports(db *sql.DB, locationSlug string) error {
 	}
 
 	// Print with groupings
-	fmt.Printf("\n=== Median Times by Age Category ===\n")
+	fmt.Printf("\n%s\n", heading("Median Times by Age Category"))
 
 	// Define the order we want to print the groups
 	groupOrder := []string{"Juniors", "Men", "Women", "Other"}
@@ -362,10 +2292,24 @@ func PrintReports(db *sql.DB, locationSlug string) error {
 			}
 		}
 	}
-
 	return nil
 }
 
+// printMedianTimesByGender prints the median time for men, women and results
+// whose gender isn't known
+func printMedianTimesByGender(stats map[string]TimeStats) {
+	fmt.Printf("\n%s\n", heading("Median Times by Gender"))
+	if len(stats) == 0 {
+		fmt.Printf("No timed results\n")
+		return
+	}
+	for _, gender := range []string{"Male", "Female", "Unknown"} {
+		if stat, ok := stats[gender]; ok {
+			fmt.Printf("%s: %s (from %d results)\n", gender, stat.Median, stat.Count)
+		}
+	}
+}
+
 // secondsToTime converts seconds to a time string (MM:SS or HH:MM:SS)
 func secondsToTime(seconds int) string {
 	if seconds == 0 {
@@ -404,6 +2348,68 @@ func parseDateTime(dateStr string) (time.Time, error) {
 	return t, nil
 }
 
+// GetAttendanceSeries returns the number of participants at each event, in event order
+func GetAttendanceSeries(db *sql.DB, locationID int) ([]EventAttendance, error) {
+	query := `
+		SELECT e.event_number, e.date, COUNT(r.id)
+		FROM events e
+		LEFT JOIN results r ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		GROUP BY e.id
+		ORDER BY e.event_number`
+
+	rows, err := db.Query(query, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var series []EventAttendance
+	for rows.Next() {
+		var attendance EventAttendance
+		if err := rows.Scan(&attendance.EventNumber, &attendance.Date, &attendance.Participants); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		series = append(series, attendance)
+	}
+
+	return series, nil
+}
+
+// GetAttendanceGrowth compares average attendance over a location's first and
+// last window events. With fewer than twice that many events, it compares the
+// first and second halves instead.
+func GetAttendanceGrowth(db *sql.DB, locationID int, window int) (AttendanceGrowth, error) {
+	series, err := GetAttendanceSeries(db, locationID)
+	if err != nil {
+		return AttendanceGrowth{}, err
+	}
+
+	growth := AttendanceGrowth{TotalEvents: len(series), Window: window}
+	if len(series) < 2*window {
+		growth.Window = len(series) / 2
+	}
+	if growth.Window == 0 {
+		return growth, nil
+	}
+
+	average := func(events []EventAttendance) float64 {
+		total := 0
+		for _, event := range events {
+			total += event.Participants
+		}
+		return float64(total) / float64(len(events))
+	}
+	growth.FirstAvg = average(series[:growth.Window])
+	growth.LastAvg = average(series[len(series)-growth.Window:])
+	if growth.FirstAvg > 0 {
+		growth.Rate = (growth.LastAvg - growth.FirstAvg) / growth.FirstAvg
+	}
+
+	return growth, nil
+}
+
 // PrintComparisonReport prints a comparison between two parkrun locations
 func PrintComparisonReport(db *sql.DB, location1, location2 string) error {
 	// Get stats for both locations
@@ -416,7 +2422,18 @@ func PrintComparisonReport(db *sql.DB, location1, location2 string) error {
 		return err
 	}
 
-	fmt.Printf("\n=== Comparison: %s | %s ===\n\n", location1, location2)
+	fmt.Printf("\n%s\n", heading("Comparison: %s | %s", location1, location2))
+	for _, location := range []struct {
+		slug  string
+		stats map[string]interface{}
+	}{{location1, stats1}, {location2, stats2}} {
+		meta, err := reportMeta(db, location.stats["location_id"].(int))
+		if err != nil {
+			return err
+		}
+		printReportMeta(location.slug, meta)
+	}
+	fmt.Println()
 
 	// Compare basic stats in table format
 	fmt.Printf("Total Events:       %6d | %6d\n",
@@ -428,6 +2445,27 @@ func PrintComparisonReport(db *sql.DB, location1, location2 string) error {
 	fmt.Printf("Biggest Event:      %6d | %6d runners\n",
 		stats1["biggest_event_count"], stats2["biggest_event_count"])
 
+	// Compare attendance growth
+	growth1, err := GetAttendanceGrowth(db, stats1["location_id"].(int), growthWindow)
+	if err != nil {
+		return err
+	}
+	growth2, err := GetAttendanceGrowth(db, stats2["location_id"].(int), growthWindow)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Attendance Growth:  %+5.1f%% | %+5.1f%%\n", growth1.Rate*100, growth2.Rate*100)
+	fmt.Printf("  (average of the first %d events vs the last %d)\n", growthWindow, growthWindow)
+	for _, location := range []struct {
+		slug   string
+		growth AttendanceGrowth
+	}{{location1, growth1}, {location2, growth2}} {
+		if location.growth.Window < growthWindow {
+			fmt.Printf("  Note: %s has only %d events, so its growth compares %d events at each end\n",
+				location.slug, location.growth.TotalEvents, location.growth.Window)
+		}
+	}
+
 	// Compare median times
 	times1, err := GetMedianTimesByAgeCategory(db, stats1["location_id"].(int))
 	if err != nil {
@@ -464,13 +2502,12 @@ func PrintComparisonReport(db *sql.DB, location1, location2 string) error {
 	others := make([]string, 0)
 
 	for cat := range categories {
-		prefix := cat[:2]
-		switch {
-		case prefix == "JM" || prefix == "JW":
+		switch categoryGroup(cat) {
+		case "Juniors":
 			juniors = append(juniors, cat)
-		case prefix == "SM" || prefix == "VM":
+		case "Men":
 			males = append(males, cat)
-		case prefix == "SW" || prefix == "VW":
+		case "Women":
 			females = append(females, cat)
 		default:
 			others = append(others, cat)
@@ -484,7 +2521,7 @@ func PrintComparisonReport(db *sql.DB, location1, location2 string) error {
 	sort.Strings(others)
 
 	// Print median time comparisons
-	fmt.Printf("\n=== Median Times by Category ===\n")
+	fmt.Printf("\n%s\n", heading("Median Times by Category"))
 
 	if len(juniors) > 0 {
 		fmt.Printf("\nJuniors:\n")
@@ -506,6 +2543,13 @@ func PrintComparisonReport(db *sql.DB, location1, location2 string) error {
 		printCategoryComparisons(others, medians1, medians2)
 	}
 
+	// Print the runners both locations share
+	shared, err := GetSharedRunners(db, location1, location2)
+	if err != nil {
+		return err
+	}
+	printSharedRunners(location1, location2, shared, 10)
+
 	return nil
 }
 
@@ -529,14 +2573,9 @@ func printCategoryComparisons(categories []string, medians1, medians2 map[string
 
 // Helper function to get location stats with ID included
 func getLocationStats(db *sql.DB, locationSlug string) (map[string]interface{}, error) {
-	// Get location ID
-	var locationID int
-	err := db.QueryRow(`SELECT id FROM locations WHERE slug = ?`, locationSlug).Scan(&locationID)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("location '%s' not found", locationSlug)
-	}
+	locationID, err := getLocationID(db, locationSlug)
 	if err != nil {
-		return nil, fmt.Errorf("database error: %v", err)
+		return nil, err
 	}
 
 	stats, err := GetLocationStats(db, locationID)
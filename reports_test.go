@@ -1,7 +1,12 @@
 package main
 
 import (
-
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -29,6 +34,190 @@ func TestGetTopParticipants(t *testing.T) {
 		t.Errorf("Expected Runner A with 2 runs, got %s with %d runs",
 			stats[0].Name, stats[0].TotalRuns)
 	}
+	if stats[0].BestTime != "19:40" || stats[0].AgeGrade != 66.0 {
+		t.Errorf("Expected Runner A's best of 19:40 and 66.0%%, got %s and %.1f%%",
+			stats[0].BestTime, stats[0].AgeGrade)
+	}
+}
+
+func TestGetTopAgeGraders(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Age grades that can't be read are skipped, and a runner without any is left out
+	_, err := db.Exec(`
+		INSERT INTO results (event_id, position, name, time_seconds, age_grade) VALUES
+		(1, 3, 'Runner B', 1600, 'n/a'),
+		(1, 4, 'Runner E', 1700, ''),
+		(2, 5, 'Runner F', 1400, '67.25 %')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := GetTopAgeGraders(db, 1, 10)
+	if err != nil {
+		t.Fatalf("GetTopAgeGraders failed: %v", err)
+	}
+
+	want := []RunnerStat{
+		{Name: "Runner F", TotalRuns: 1, AgeGrade: 67.25},
+		{Name: "Runner A", TotalRuns: 2, AgeGrade: 66.0},
+		{Name: "Runner D", TotalRuns: 1, AgeGrade: 65.8},
+		{Name: "Runner B", TotalRuns: 2, AgeGrade: 60.2},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("GetTopAgeGraders() = %+v, want %+v", stats, want)
+	}
+
+	stats, err = GetTopAgeGraders(db, 1, 2)
+	if err != nil {
+		t.Fatalf("GetTopAgeGraders failed: %v", err)
+	}
+	if len(stats) != 2 || stats[1].Name != "Runner A" {
+		t.Errorf("Expected the top 2 age graders, got %+v", stats)
+	}
+}
+
+func TestGetRunnerPersonalBest(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	seconds, date, err := GetRunnerPersonalBest(db, 1, "Runner A")
+	if err != nil {
+		t.Fatalf("GetRunnerPersonalBest failed: %v", err)
+	}
+	if seconds != 1180 || !date.Equal(parseDate(t, "2023-01-08")) {
+		t.Errorf("Expected 1180s on 2023-01-08, got %ds on %v", seconds, date)
+	}
+
+	if _, _, err := GetRunnerPersonalBest(db, 1, "Runner C"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a runner who hasn't run there, got %v", err)
+	}
+
+	// Runs under an alias count towards the canonical name, as in the report
+	_, err = db.Exec(`
+		INSERT INTO aliases (location_id, alias, canonical) VALUES (1, 'R. A.', 'Runner A');
+		INSERT INTO results (event_id, position, name, time_seconds) VALUES (1, 5, 'R. A.', 1100)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seconds, date, err = GetRunnerPersonalBest(db, 1, "Runner A")
+	if err != nil {
+		t.Fatalf("GetRunnerPersonalBest failed: %v", err)
+	}
+	if seconds != 1100 || !date.Equal(parseDate(t, "2023-01-01")) {
+		t.Errorf("Expected the aliased 1100s on 2023-01-01, got %ds on %v", seconds, date)
+	}
+}
+
+func TestGetPersonalBestReport(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// A runner without a time has no PB to list
+	_, err := db.Exec(`INSERT INTO results (event_id, position, name, time_seconds) VALUES (1, 3, 'Runner E', NULL)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := GetPersonalBestReport(db, 1, 10)
+	if err != nil {
+		t.Fatalf("GetPersonalBestReport failed: %v", err)
+	}
+
+	want := []struct {
+		name     string
+		best     string
+		runs     int
+		ageGrade float64
+	}{
+		{"Runner A", "19:40", 2, 66.0},
+		{"Runner D", "19:50", 1, 65.8},
+		{"Runner B", "25:00", 1, 60.2},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("Expected %d runners, got %+v", len(want), stats)
+	}
+	for i, w := range want {
+		got := stats[i]
+		if got.Name != w.name || got.BestTime != w.best || got.TotalRuns != w.runs || got.AgeGrade != w.ageGrade {
+			t.Errorf("Runner %d: expected %s %s from %d runs at %.1f%%, got %s %s from %d runs at %.1f%%",
+				i, w.name, w.best, w.runs, w.ageGrade, got.Name, got.BestTime, got.TotalRuns, got.AgeGrade)
+		}
+	}
+	if !stats[0].FirstEvent.Equal(parseDate(t, "2023-01-01")) || !stats[0].LastEvent.Equal(parseDate(t, "2023-01-08")) {
+		t.Errorf("Expected Runner A's runs from 2023-01-01 to 2023-01-08, got %v to %v", stats[0].FirstEvent, stats[0].LastEvent)
+	}
+
+	stats, err = GetPersonalBestReport(db, 1, 1)
+	if err != nil {
+		t.Fatalf("GetPersonalBestReport failed: %v", err)
+	}
+	if len(stats) != 1 {
+		t.Errorf("Expected the limit to keep 1 runner, got %d", len(stats))
+	}
+}
+
+func TestGetTopParticipantsJoinsRunners(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Runner A changes their name, which updates their runners row
+	if _, err := db.Exec(`DELETE FROM results WHERE name = 'Runner A'`); err != nil {
+		t.Fatal(err)
+	}
+	StoreResults(db, []Result{{Position: 1, Name: "Runner A", TimeSeconds: 1200, AthleteID: 1001}}, 1)
+	StoreResults(db, []Result{{Position: 3, Name: "Runner A-Smith", TimeSeconds: 1180, AthleteID: 1001}}, 2)
+
+	stats, err := GetTopParticipants(db, 1, 10)
+	if err != nil {
+		t.Fatalf("GetTopParticipants failed: %v", err)
+	}
+	if len(stats) != 3 || stats[0].Name != "Runner A-Smith" || stats[0].TotalRuns != 2 {
+		t.Errorf("Expected Runner A-Smith first with 2 runs, got %+v", stats)
+	}
+}
+
+func TestGetTopParticipantsWithAliases(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	if err := AddAliases(db, "test-park-1", "Runner D", []string{"Runner B"}); err != nil {
+		t.Fatalf("AddAliases failed: %v", err)
+	}
+	stats, err := GetTopParticipants(db, 1, 10)
+	if err != nil {
+		t.Fatalf("GetTopParticipants failed: %v", err)
+	}
+	runs := make(map[string]int)
+	for _, stat := range stats {
+		runs[stat.Name] = stat.TotalRuns
+	}
+	want := map[string]int{"Runner A": 2, "Runner D": 2}
+	if !reflect.DeepEqual(runs, want) {
+		t.Errorf("GetTopParticipants() runs = %v, want %v", runs, want)
+	}
+
+	// Aliasing the canonical name moves its aliases along too
+	if err := AddAliases(db, "test-park-1", "Runner A", []string{"Runner D"}); err != nil {
+		t.Fatalf("AddAliases failed: %v", err)
+	}
+	stats, err = GetTopParticipants(db, 1, 10)
+	if err != nil {
+		t.Fatalf("GetTopParticipants failed: %v", err)
+	}
+	if len(stats) != 1 || stats[0].Name != "Runner A" || stats[0].TotalRuns != 4 {
+		t.Errorf("Expected Runner A with 4 runs, got %+v", stats)
+	}
+
+	if err := AddAliases(db, "nowhere", "Runner A", []string{"Runner B"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown location, got %v", err)
+	}
 }
 
 func TestGetMedianTimesByAgeCategory(t *testing.T) {
@@ -63,6 +252,49 @@ func TestGetMedianTimesByAgeCategory(t *testing.T) {
 	}
 }
 
+func TestGetMedianTimesByGender(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// A woman, and runners with a one-letter and a missing category
+	_, err := db.Exec(`
+		INSERT INTO results (event_id, position, name, time_seconds, age_category) VALUES
+		(1, 3, 'Runner E', 1400, 'VW40-44'),
+		(1, 4, 'Runner F', 1600, 'V'),
+		(1, 5, 'Runner G', 1700, NULL)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := GetMedianTimesByGender(db, 1)
+	if err != nil {
+		t.Fatalf("GetMedianTimesByGender failed: %v", err)
+	}
+
+	want := map[string]struct {
+		median string
+		count  int
+	}{
+		"Male":    {"19:55", 4}, // Middle of 1180, 1190, 1200 and 1500
+		"Female":  {"23:20", 1},
+		"Unknown": {"27:30", 2},
+	}
+	if len(stats) != len(want) {
+		t.Errorf("Expected %d genders, got %+v", len(want), stats)
+	}
+	for gender, w := range want {
+		stat, ok := stats[gender]
+		if !ok {
+			t.Errorf("Expected a median for %s", gender)
+			continue
+		}
+		if stat.Median != w.median || stat.Count != w.count {
+			t.Errorf("%s: expected %s from %d results, got %s from %d", gender, w.median, w.count, stat.Median, stat.Count)
+		}
+	}
+}
+
 func TestGetLocationStats(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -95,6 +327,52 @@ func TestGetLocationStats(t *testing.T) {
 	}
 }
 
+func TestGetLocationAge(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// test-park-1 started on 1 January 2023
+	now := time.Date(2025, 4, 15, 0, 0, 0, 0, time.UTC)
+	defer func(original Clock) { clock = original }(clock)
+	clock = fixedClock(now)
+
+	age, err := GetLocationAge(db, 1)
+	if err != nil {
+		t.Fatalf("GetLocationAge failed: %v", err)
+	}
+	if want := now.Sub(parseDate(t, "2023-01-01")); age != want {
+		t.Errorf("GetLocationAge() = %v, want %v", age, want)
+	}
+	if got := formatRunningFor(parseDate(t, "2023-01-01"), now); got != "2 years, 3 months" {
+		t.Errorf("formatRunningFor() = %q, want %q", got, "2 years, 3 months")
+	}
+
+	// A month isn't complete until its day comes round
+	if got := formatRunningFor(parseDate(t, "2023-01-20"), now); got != "2 years, 2 months" {
+		t.Errorf("formatRunningFor() = %q, want %q", got, "2 years, 2 months")
+	}
+
+	// The overview reports the same age
+	out := captureStdout(t, func() {
+		if err := printOverviewSection(db, 1, "test-park-1"); err != nil {
+			t.Errorf("printOverviewSection failed: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Running for 2 years, 3 months") {
+		t.Errorf("Expected the overview to show the location's age, got:\n%s", out)
+	}
+
+	// A location with no events hasn't started
+	age, err = GetLocationAge(db, 3)
+	if err != nil {
+		t.Fatalf("GetLocationAge failed: %v", err)
+	}
+	if age != 0 {
+		t.Errorf("Expected no age for a location with no events, got %v", age)
+	}
+}
+
 func TestCalculateMedianTime(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -127,3 +405,949 @@ func TestCalculateMedianTime(t *testing.T) {
 		})
 	}
 }
+
+func TestGetFirstTimerTrend(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	_, err := db.Exec(`
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(4, 3, 1, '2023-01-15', 'http://example.com/4')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO results (position, name, time_seconds, note, event_id) VALUES 
+		(1, 'Runner E', 1250, 'First Timer!', 4),
+		(2, 'Runner F', 1350, 'First Timer!', 4),
+		(3, 'Runner A', 1170, 'New PB!', 4)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`UPDATE results SET note = 'First Timer!' WHERE event_id = 1 AND name = 'Runner A'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Location 2 is left with NULL notes, like results stored from pages
+	// without achievement data
+	_, err = db.Exec(`UPDATE results SET note = '' WHERE event_id IN (1, 2) AND note IS NULL`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points, err := GetFirstTimerTrend(db, 1)
+	if err != nil {
+		t.Fatalf("GetFirstTimerTrend failed: %v", err)
+	}
+
+	want := []struct {
+		eventNumber int
+		firstTimers int
+	}{
+		{1, 1},
+		{2, 0},
+		{3, 2},
+	}
+	if len(points) != len(want) {
+		t.Fatalf("Expected %d points, got %d", len(want), len(points))
+	}
+	for i, w := range want {
+		if points[i].EventNumber != w.eventNumber || points[i].FirstTimers != w.firstTimers || !points[i].Known {
+			t.Errorf("Point %d: got %+v, want event %d with %d first timers", i, points[i], w.eventNumber, w.firstTimers)
+		}
+	}
+
+	points, err = GetFirstTimerTrend(db, 2)
+	if err != nil {
+		t.Fatalf("GetFirstTimerTrend failed: %v", err)
+	}
+	if len(points) != 1 || points[0].Known {
+		t.Errorf("Expected a single unknown point, got %+v", points)
+	}
+
+	// Results stored from a page without achievement data leave the event unknown
+	_, err = db.Exec(`
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(5, 4, 1, '2023-01-22', 'http://example.com/5')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	StoreResults(db, []Result{{Position: 1, Name: "Runner G", TimeSeconds: 1300, NoteMissing: true}}, 5)
+	points, err = GetFirstTimerTrend(db, 1)
+	if err != nil {
+		t.Fatalf("GetFirstTimerTrend failed: %v", err)
+	}
+	if len(points) != 4 || points[3].Known {
+		t.Errorf("Expected event 4 to be unknown, got %+v", points)
+	}
+}
+
+func TestGetFirstTimers(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	_, err := db.Exec(`
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(4, 3, 1, '2023-02-05', 'http://example.com/4')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO results (position, name, time_seconds, athlete_id, event_id) VALUES 
+		(1, 'Runner E', 1250, 0, 4),
+		(2, 'Runner C', 1310, 0, 4),
+		(3, 'Runner A', 1170, 0, 4)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		eventNumber int
+		want        []string
+	}{
+		{1, []string{"Runner A", "Runner B"}},
+		{2, []string{"Runner D"}},
+		// Runner C has only run at location 2 before
+		{3, []string{"Runner E", "Runner C"}},
+	}
+	for _, tt := range tests {
+		names, err := GetFirstTimers(db, 1, tt.eventNumber)
+		if err != nil {
+			t.Fatalf("GetFirstTimers(%d) failed: %v", tt.eventNumber, err)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Event %d: expected first timers %v, got %v", tt.eventNumber, tt.want, names)
+		}
+	}
+
+	if _, err := GetFirstTimers(db, 1, 99); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing event, got %v", err)
+	}
+
+	months, err := GetFirstTimersByMonth(db, 1)
+	if err != nil {
+		t.Fatalf("GetFirstTimersByMonth failed: %v", err)
+	}
+	if len(months) != 2 || months["2023-01"] != 3 || months["2023-02"] != 2 {
+		t.Errorf("Expected 3 first timers in 2023-01 and 2 in 2023-02, got %v", months)
+	}
+}
+
+func TestGetEventGenderPodium(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Event 1 has stored gender positions, event 2 predates them
+	_, err := db.Exec(`
+		INSERT INTO results (position, name, time_seconds, age_category, gender, gender_position, event_id) VALUES 
+		(3, 'Runner E', 1550, 'SW25-29', 'Female', 1, 1),
+		(4, 'Runner F', 1560, 'SM25-29', 'Male', 3, 1),
+		(5, 'Runner G', 1570, 'SM30-34', 'Male', 4, 1);
+		UPDATE results SET gender = 'Male', gender_position = position WHERE event_id = 1 AND position <= 2;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	podium, err := GetEventGenderPodium(db, "test-park-1", 1)
+	if err != nil {
+		t.Fatalf("GetEventGenderPodium failed: %v", err)
+	}
+	if len(podium["Male"]) != 3 || len(podium["Female"]) != 1 {
+		t.Fatalf("Expected 3 men and 1 woman, got %+v", podium)
+	}
+	if podium["Male"][2].Name != "Runner F" || podium["Male"][2].GenderPosition != 3 {
+		t.Errorf("Expected Runner F third man, got %+v", podium["Male"][2])
+	}
+
+	// Without stored gender positions they come from overall position and category
+	podium, err = GetEventGenderPodium(db, "test-park-1", 2)
+	if err != nil {
+		t.Fatalf("GetEventGenderPodium failed: %v", err)
+	}
+	if len(podium["Male"]) != 2 {
+		t.Fatalf("Expected 2 men, got %+v", podium)
+	}
+	if podium["Male"][1].Name != "Runner D" || podium["Male"][1].GenderPosition != 2 {
+		t.Errorf("Expected Runner D second man, got %+v", podium["Male"][1])
+	}
+}
+
+func TestGetCategoryDepth(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// A blank category is left out
+	_, err := db.Exec(`
+		INSERT INTO results (position, name, time_seconds, age_category, event_id) VALUES 
+		(5, 'Runner E', 1600, '', 2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	depths, err := GetCategoryDepth(db, 1)
+	if err != nil {
+		t.Fatalf("GetCategoryDepth failed: %v", err)
+	}
+
+	want := []CategoryDepth{
+		{Category: "VM35-39", DistinctRunners: 2, Finishes: 3},
+		{Category: "VM40-44", DistinctRunners: 1, Finishes: 1},
+	}
+	if len(depths) != len(want) {
+		t.Fatalf("Expected %d categories, got %+v", len(want), depths)
+	}
+	for i := range want {
+		if depths[i] != want[i] {
+			t.Errorf("Category %d: got %+v, want %+v", i, depths[i], want[i])
+		}
+	}
+}
+
+func TestGetWeekdayStats(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	_, err := db.Exec(`
+		INSERT INTO locations (id, slug, country) VALUES 
+		(1, 'test-park-1', 'AUS'),
+		(2, 'saturday-park', 'AUS');
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(1, 1, 1, '2022-12-17', 'http://example.com/1'),
+		(2, 2, 1, '2022-12-24', 'http://example.com/2'),
+		(3, 3, 1, '2022-12-25', 'http://example.com/3'),
+		(4, 1, 2, '2022-12-24', 'http://example.com/4');
+		INSERT INTO results (position, name, time_seconds, event_id) VALUES 
+		(1, 'Runner A', 1200, 1),
+		(2, 'Runner B', 1300, 1),
+		(1, 'Runner A', 1100, 2),
+		(2, 'Runner B', 1400, 2),
+		(3, 'Runner C', 1500, 2),
+		(4, 'Unknown', NULL, 2),
+		(1, 'Runner A', 1500, 3),
+		(2, 'Runner B', 1600, 3),
+		(3, 'Runner C', 1700, 3),
+		(4, 'Runner D', 1800, 3),
+		(5, 'Runner E', 1900, 3),
+		(6, 'Runner F', 2000, 3),
+		(1, 'Runner A', 1250, 4);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := GetWeekdayStats(db, 1)
+	if err != nil {
+		t.Fatalf("GetWeekdayStats failed: %v", err)
+	}
+
+	if len(stats) != 2 {
+		t.Fatalf("Expected Saturday and Sunday stats, got %+v", stats)
+	}
+	want := WeekdayStat{Events: 2, AvgParticipants: 3, MedianTime: "21:40"}
+	if stats[time.Saturday] != want {
+		t.Errorf("Saturday: got %+v, want %+v", stats[time.Saturday], want)
+	}
+	want = WeekdayStat{Events: 1, AvgParticipants: 6, MedianTime: "29:10"}
+	if stats[time.Sunday] != want {
+		t.Errorf("Sunday: got %+v, want %+v", stats[time.Sunday], want)
+	}
+
+	// A location with only Saturday events has a single entry
+	stats, err = GetWeekdayStats(db, 2)
+	if err != nil {
+		t.Fatalf("GetWeekdayStats failed: %v", err)
+	}
+	if len(stats) != 1 || stats[time.Saturday].Events != 1 {
+		t.Errorf("Expected only a Saturday entry, got %+v", stats)
+	}
+}
+
+func TestGetAllLocationStats(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// A location with no events yet is left out
+	_, err := db.Exec(`INSERT INTO locations (id, slug, country) VALUES (3, 'test-park-3', 'AUS')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := GetAllLocationStats(db)
+	if err != nil {
+		t.Fatalf("GetAllLocationStats failed: %v", err)
+	}
+
+	want := []LocationStats{
+		{Slug: "test-park-1", TotalEvents: 2, AvgParticipants: 2, MedianSeconds: 1195, MedianAgeGrade: 65.65},
+		{Slug: "test-park-2", TotalEvents: 1, AvgParticipants: 1, MedianSeconds: 1300, MedianAgeGrade: 70.1},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("Expected %d locations, got %+v", len(want), stats)
+	}
+	for i := range want {
+		got := stats[i]
+		if got.Slug != want[i].Slug || got.TotalEvents != want[i].TotalEvents ||
+			got.AvgParticipants != want[i].AvgParticipants || got.MedianSeconds != want[i].MedianSeconds ||
+			got.MedianAgeGrade < want[i].MedianAgeGrade-0.001 || got.MedianAgeGrade > want[i].MedianAgeGrade+0.001 {
+			t.Errorf("Location %d: got %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	if err := sortLocationStats(stats, "agegrade"); err != nil {
+		t.Fatal(err)
+	}
+	if stats[0].Slug != "test-park-2" {
+		t.Errorf("Expected test-park-2 first by age grade, got %s", stats[0].Slug)
+	}
+	if err := sortLocationStats(stats, "bogus"); err == nil {
+		t.Error("Expected an error for an unknown sort column")
+	}
+}
+
+func TestGetLastFinisherTrend(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// An untimed Unknown finisher comes last in event 2, and event 4 has no times at all
+	_, err := db.Exec(`
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(4, 3, 1, '2023-01-15', 'http://example.com/4');
+		INSERT INTO results (position, name, time_seconds, event_id) VALUES 
+		(5, 'Unknown', NULL, 2),
+		(1, 'Runner A', NULL, 4);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	finishers, err := GetLastFinisherTrend(db, 1)
+	if err != nil {
+		t.Fatalf("GetLastFinisherTrend failed: %v", err)
+	}
+
+	if len(finishers) != 3 {
+		t.Fatalf("Expected 3 events, got %+v", finishers)
+	}
+	if finishers[0].Name != "Runner B" || finishers[0].TimeSeconds != 1500 || finishers[0].Position != 2 {
+		t.Errorf("Expected Runner B last at event 1 in 25:00, got %+v", finishers[0])
+	}
+	if finishers[1].Name != "Runner D" || finishers[1].TimeSeconds != 1190 {
+		t.Errorf("Expected Runner D last timed finisher at event 2, got %+v", finishers[1])
+	}
+	if finishers[2].TimeSeconds != 0 {
+		t.Errorf("Expected no time at event 3, got %+v", finishers[2])
+	}
+}
+
+func TestGetEventSpread(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Event 3 has eight timed finishers and an untimed one, which is ignored
+	_, err := db.Exec(`
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(4, 3, 1, '2023-01-15', 'http://example.com/4');
+		INSERT INTO results (position, name, time_seconds, event_id) VALUES 
+		(1, 'Runner A', 1000, 4),
+		(2, 'Runner B', 1100, 4),
+		(3, 'Runner C', 1200, 4),
+		(4, 'Runner D', 1300, 4),
+		(5, 'Runner E', 1400, 4),
+		(6, 'Runner F', 1500, 4),
+		(7, 'Runner G', 1600, 4),
+		(8, 'Runner H', 2000, 4),
+		(9, 'Unknown', NULL, 4);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spreads, err := GetEventSpread(db, 1)
+	if err != nil {
+		t.Fatalf("GetEventSpread failed: %v", err)
+	}
+	if len(spreads) != 3 {
+		t.Fatalf("Expected 3 events, got %+v", spreads)
+	}
+
+	want := EventSpread{
+		EventNumber:    3,
+		Date:           parseDate(t, "2023-01-15"),
+		Finishers:      8,
+		FastestSeconds: 1000,
+		MedianSeconds:  1350,
+		SlowestSeconds: 2000,
+		IQRSeconds:     400,
+	}
+	if got := spreads[2]; !got.Date.Equal(want.Date) || got.EventNumber != want.EventNumber ||
+		got.Finishers != want.Finishers || got.FastestSeconds != want.FastestSeconds ||
+		got.MedianSeconds != want.MedianSeconds || got.SlowestSeconds != want.SlowestSeconds ||
+		got.IQRSeconds != want.IQRSeconds {
+		t.Errorf("GetEventSpread() event 3 = %+v, want %+v", got, want)
+	}
+
+	// Two finishers 300 seconds apart
+	if spreads[0].IQRSeconds != 300 || spreads[0].MedianSeconds != 1350 {
+		t.Errorf("Expected an IQR of 300 at event 1, got %+v", spreads[0])
+	}
+}
+
+func TestGetEventPaceStats(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	stats, err := GetEventPaceStats(db, 1)
+	if err != nil {
+		t.Fatalf("GetEventPaceStats failed: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("Expected 2 events, got %+v", stats)
+	}
+	// 1200 and 1500 seconds over 5km
+	if got := stats[0]; got.MedianPace != 270 || got.FastestPace != 240 || got.SlowestPace != 300 || got.AveragePace != 270 {
+		t.Errorf("Unexpected paces at event 1: %+v", got)
+	}
+	if got := formatPace(stats[0].MedianPace); got != "4:30/km" {
+		t.Errorf("Expected a median pace of 4:30/km, got %s", got)
+	}
+
+	// A 2km junior event, where the untimed finisher is ignored
+	_, err = db.Exec(`
+		INSERT INTO locations (id, slug, country, distance_km) VALUES (3, 'test-juniors', 'AUS', 2);
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(4, 1, 3, '2023-01-01', 'http://example.com/4');
+		INSERT INTO results (position, name, time_seconds, event_id) VALUES 
+		(1, 'Runner J', 600, 4),
+		(2, 'Runner K', 700, 4),
+		(3, 'Runner L', 900, 4),
+		(4, 'Unknown', NULL, 4);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err = GetEventPaceStats(db, 3)
+	if err != nil {
+		t.Fatalf("GetEventPaceStats failed: %v", err)
+	}
+	if len(stats) != 1 || stats[0].MedianPace != 350 || stats[0].Finishers != 3 {
+		t.Errorf("Expected a median pace of 350s/km over 3 finishers, got %+v", stats)
+	}
+
+	if _, err := GetEventPaceStats(db, 99); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown location, got %v", err)
+	}
+}
+
+func TestGetMedianTimeTrend(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Medians of 22:30, 19:45 and 21:40 over three events
+	_, err := db.Exec(`
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(4, 3, 1, '2023-01-15', 'http://example.com/4');
+		INSERT INTO results (position, name, time_seconds, event_id) VALUES 
+		(1, 'Runner A', 1300, 4);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points, err := GetMedianTimeTrend(db, 1, 2)
+	if err != nil {
+		t.Fatalf("GetMedianTimeTrend failed: %v", err)
+	}
+
+	want := []struct {
+		eventNumber, median, window int
+		average                     float64
+	}{
+		{1, 1350, 1, 1350},
+		{2, 1185, 2, 1267.5},
+		{3, 1300, 2, 1242.5},
+	}
+	if len(points) != len(want) {
+		t.Fatalf("Expected %d points, got %+v", len(want), points)
+	}
+	for i, w := range want {
+		p := points[i]
+		if p.EventNumber != w.eventNumber || p.MedianSeconds != w.median || p.Window != w.window || p.AverageSeconds != w.average {
+			t.Errorf("Point %d = %+v, want %+v", i, p, w)
+		}
+	}
+
+	if _, err := GetMedianTimeTrend(db, 1, 0); err == nil {
+		t.Error("Expected an error for an empty window")
+	}
+}
+
+func TestReportMeta(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	before := time.Now()
+	meta, err := reportMeta(db, 1)
+	if err != nil {
+		t.Fatalf("reportMeta failed: %v", err)
+	}
+	if meta.GeneratedAt.Before(before) || meta.GeneratedAt.After(time.Now()) {
+		t.Errorf("Expected generated-at to be now, got %v", meta.GeneratedAt)
+	}
+	if meta.LatestEvent != 2 || !meta.LatestEventDate.Equal(parseDate(t, "2023-01-08")) {
+		t.Errorf("Expected latest event 2 on 2023-01-08, got %d on %v", meta.LatestEvent, meta.LatestEventDate)
+	}
+
+	// A location with no events has no latest event
+	meta, err = reportMeta(db, 99)
+	if err != nil {
+		t.Fatalf("reportMeta failed: %v", err)
+	}
+	if meta.LatestEvent != 0 || !meta.LatestEventDate.IsZero() {
+		t.Errorf("Expected no latest event, got %d on %v", meta.LatestEvent, meta.LatestEventDate)
+	}
+}
+
+func TestGetModalTimeBand(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	_, err := db.Exec(`
+		INSERT INTO locations (id, slug, country) VALUES (1, 'test-park', 'AUS');
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES (1, 1, 1, '2023-01-01', '');
+		INSERT INTO results (position, name, time_seconds, age_grade, age_category, total_runs, event_id) VALUES
+		(1, 'Runner A', 1205, '', 'SM30-34', 1, 1),
+		(2, 'Runner B', 1210, '', 'SM30-34', 1, 1),
+		(3, 'Runner C', 1229, '', 'SM30-34', 1, 1),
+		(4, 'Runner D', 1240, '', 'SM30-34', 1, 1),
+		(5, 'Runner E', 1250, '', 'SM30-34', 1, 1),
+		(6, 'Runner F', 1500, '', 'SM30-34', 1, 1),
+		(7, 'Runner G', 1410, '', 'VW40-44', 1, 1),
+		(8, 'Runner H', 1400, '', 'VW40-44', 1, 1),
+		(9, 'Runner I', 1320, '', 'VW40-44', 1, 1),
+		(10, 'Runner J', 1300, '', 'VW40-44', 1, 1),
+		(11, 'Runner K', 0, '', 'VW40-44', 1, 1),
+		(12, 'Runner L', 0, '', 'VW40-44', 1, 1),
+		(13, 'Runner M', 0, '', 'VW40-44', 1, 1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bands, err := GetModalTimeBand(db, 1, 30)
+	if err != nil {
+		t.Fatalf("GetModalTimeBand failed: %v", err)
+	}
+
+	// Untimed results don't count, and the VW40-44 tie goes to the faster band
+	want := map[string]string{
+		"SM30-34": "20:00-20:29",
+		"VW40-44": "21:30-21:59",
+	}
+	if len(bands) != len(want) {
+		t.Fatalf("Expected %d categories, got %v", len(want), bands)
+	}
+	for category, band := range want {
+		if bands[category] != band {
+			t.Errorf("Expected %s modal band %s, got %s", category, band, bands[category])
+		}
+	}
+
+	if _, err := GetModalTimeBand(db, 1, 0); err == nil {
+		t.Error("Expected an error for a zero-width band")
+	}
+}
+
+func TestGetAttendanceGrowth(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	_, err := db.Exec(`
+		INSERT INTO locations (id, slug, country) VALUES 
+		(1, 'growing-park', 'AUS'),
+		(2, 'flat-park', 'AUS')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The growing park doubles from 2 to 4 runners over 24 events, while
+	// the flat park has 3 runners at each of its 6 events
+	addEvents := func(locationID, events int, participants func(eventNumber int) int) {
+		start := parseDate(t, "2023-01-07")
+		for n := 1; n <= events; n++ {
+			result, err := db.Exec(`INSERT INTO events (event_number, location_id, date, url) VALUES (?, ?, ?, '')`,
+				n, locationID, start.AddDate(0, 0, 7*(n-1)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			eventID, _ := result.LastInsertId()
+			for position := 1; position <= participants(n); position++ {
+				_, err := db.Exec(`
+					INSERT INTO results (position, name, time_seconds, age_category, event_id)
+					VALUES (?, ?, 1500, 'SM30-34', ?)`, position, fmt.Sprintf("Runner %d", position), eventID)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	addEvents(1, 24, func(n int) int {
+		if n <= 12 {
+			return 2
+		}
+		return 4
+	})
+	addEvents(2, 6, func(n int) int { return 3 })
+
+	growing, err := GetAttendanceGrowth(db, 1, 12)
+	if err != nil {
+		t.Fatalf("GetAttendanceGrowth failed: %v", err)
+	}
+	want := AttendanceGrowth{Window: 12, TotalEvents: 24, FirstAvg: 2, LastAvg: 4, Rate: 1}
+	if growing != want {
+		t.Errorf("GetAttendanceGrowth() = %+v, want %+v", growing, want)
+	}
+
+	// Too few events for the full window, so it compares halves
+	flat, err := GetAttendanceGrowth(db, 2, 12)
+	if err != nil {
+		t.Fatalf("GetAttendanceGrowth failed: %v", err)
+	}
+	want = AttendanceGrowth{Window: 3, TotalEvents: 6, FirstAvg: 3, LastAvg: 3, Rate: 0}
+	if flat != want {
+		t.Errorf("GetAttendanceGrowth() = %+v, want %+v", flat, want)
+	}
+
+	// A location with no events has nothing to compare
+	empty, err := GetAttendanceGrowth(db, 3, 12)
+	if err != nil {
+		t.Fatalf("GetAttendanceGrowth failed: %v", err)
+	}
+	if empty.Window != 0 || empty.Rate != 0 {
+		t.Errorf("Expected no growth for an empty location, got %+v", empty)
+	}
+}
+
+func TestGetGenderGapByAge(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// 35-39 has both genders, 40-44 only women. Runner E's stored gender wins
+	// over the category.
+	_, err := db.Exec(`
+		INSERT INTO locations (id, slug, country) VALUES (1, 'test-park', 'AUS');
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES (1, 1, 1, '2023-01-01', '');
+		INSERT INTO results (position, name, time_seconds, age_category, gender, event_id) VALUES
+		(1, 'Runner A', 1200, 'VM35-39', NULL, 1),
+		(2, 'Runner B', 1300, 'VM35-39', NULL, 1),
+		(3, 'Runner C', 1400, 'VM35-39', NULL, 1),
+		(4, 'Runner D', 1500, 'VW35-39', NULL, 1),
+		(5, 'Runner E', 1800, 'VM35-39', 'Female', 1),
+		(6, 'Runner F', 1600, 'VW40-44', NULL, 1),
+		(7, 'Runner G', 0, 'VW35-39', NULL, 1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gaps, err := GetGenderGapByAge(db, 1)
+	if err != nil {
+		t.Fatalf("GetGenderGapByAge failed: %v", err)
+	}
+
+	// Men 1200, 1300, 1400 -> 1300. Women 1500, 1800 -> 1650
+	want := []GenderGap{{
+		AgeBand:      "35-39",
+		MaleMedian:   1300,
+		FemaleMedian: 1650,
+		MaleCount:    3,
+		FemaleCount:  2,
+		GapSeconds:   350,
+		GapPercent:   350.0 / 1300 * 100,
+	}}
+	if !reflect.DeepEqual(gaps, want) {
+		t.Errorf("GetGenderGapByAge() = %+v, want %+v", gaps, want)
+	}
+}
+
+func TestGetLocationStatus(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	_, err := db.Exec(`INSERT INTO locations (id, slug, country) VALUES (3, 'test-park-3', 'AUS')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(original Clock) { clock = original }(clock)
+	clock = fixedClock(parseDate(t, "2023-02-01"))
+
+	statuses, err := GetLocationStatus(db)
+	if err != nil {
+		t.Fatalf("GetLocationStatus failed: %v", err)
+	}
+
+	want := []LocationStatus{
+		{Slug: "test-park-1", LatestEvent: 2, LatestEventDate: parseDate(t, "2023-01-08"), DaysSince: 24, TotalResults: 4},
+		{Slug: "test-park-2", LatestEvent: 1, LatestEventDate: parseDate(t, "2023-01-01"), DaysSince: 31, TotalResults: 1},
+		{Slug: "test-park-3"},
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("GetLocationStatus() = %+v, want %+v", statuses, want)
+	}
+
+	if err := sortLocationStatus(statuses, "stale"); err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, s := range statuses {
+		order = append(order, s.Slug)
+	}
+	wantOrder := []string{"test-park-3", "test-park-2", "test-park-1"}
+	if !reflect.DeepEqual(order, wantOrder) {
+		t.Errorf("Stale order = %v, want %v", order, wantOrder)
+	}
+
+	if err := sortLocationStatus(statuses, "size"); err == nil {
+		t.Error("Expected an error for an unknown sort column")
+	}
+}
+
+func TestSelectReportSections(t *testing.T) {
+	tests := []struct {
+		name     string
+		names    []string
+		all      bool
+		included string
+		want     bool
+	}{
+		{"Optional section left out by default", []string{""}, false, "gender-gap", false},
+		{"Default section included", nil, false, "overview", true},
+		{"Optional section named", []string{"plateaued", " gender-gap"}, false, "gender-gap", true},
+		{"Other optional sections still left out", []string{"gender-gap"}, false, "plateaued", false},
+		{"All sections", nil, true, "time-bands", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sections, err := selectReportSections(tt.names, tt.all)
+			if err != nil {
+				t.Fatalf("selectReportSections failed: %v", err)
+			}
+			got := false
+			for _, section := range sections {
+				got = got || section.Name == tt.included
+			}
+			if got != tt.want {
+				t.Errorf("Section %q included = %v, want %v", tt.included, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := selectReportSections([]string{"streaks"}, false); err == nil {
+		t.Error("Expected an error for an unknown section")
+	}
+}
+
+// fixedClock always returns the same time
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// captureStdout returns what f prints to stdout
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- string(data)
+	}()
+	f()
+	w.Close()
+	return <-output
+}
+
+func TestPrintReportsSections(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	report := func(names []string) string {
+		sections, err := selectReportSections(names, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return captureStdout(t, func() {
+			if err := PrintReports(db, "test-park-1", sections); err != nil {
+				t.Errorf("PrintReports failed: %v", err)
+			}
+		})
+	}
+
+	const gapHeading = "Gender Gap in Median Times by Age"
+	if output := report(nil); strings.Contains(output, gapHeading) || !strings.Contains(output, "Top 10 Participants") {
+		t.Errorf("Unexpected default report:\n%s", output)
+	}
+	if output := report([]string{"gender-gap"}); !strings.Contains(output, gapHeading) {
+		t.Errorf("Expected the gender gap section when requested:\n%s", output)
+	}
+}
+
+func TestGetMilestoneRunners(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Runner E's 6th parkrun is their first here, which is close enough to count
+	_, err := db.Exec(`INSERT INTO results (event_id, position, name, time_seconds, total_runs) VALUES (2, 5, 'Runner E', 1500, 6)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runners, err := GetMilestoneRunners(db, 1, 10)
+	if err != nil {
+		t.Fatalf("GetMilestoneRunners failed: %v", err)
+	}
+	if len(runners) != 1 || runners[0].Name != "Runner A" || runners[0].TotalRuns != 10 ||
+		!runners[0].FirstEvent.Equal(parseDate(t, "2023-01-01")) {
+		t.Errorf("Expected Runner A reaching 10 on 2023-01-01, got %+v", runners)
+	}
+
+	// Runner A already had 10 runs when they first reached 5 here
+	runners, err = GetMilestoneRunners(db, 1, 5)
+	if err != nil {
+		t.Fatalf("GetMilestoneRunners failed: %v", err)
+	}
+	var names []string
+	for _, runner := range runners {
+		names = append(names, runner.Name)
+	}
+	if want := []string{"Runner B", "Runner E"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected %v to reach 5, got %v", want, names)
+	}
+
+	runners, err = GetMilestoneRunners(db, 1, 50)
+	if err != nil {
+		t.Fatalf("GetMilestoneRunners failed: %v", err)
+	}
+	if len(runners) != 0 {
+		t.Errorf("Expected nobody to reach 50, got %+v", runners)
+	}
+}
+
+func TestGetRunnerImprovementRate(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Runner D gets slower at a third event. It's dated before event 2, so
+	// event 2 is still their latest run.
+	_, err := db.Exec(`
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES
+		(4, 3, 1, '2023-01-05', 'http://example.com/4');
+		INSERT INTO results (event_id, position, name, time_seconds) VALUES
+		(4, 1, 'Runner D', 1100)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := GetRunnerImprovementRate(db, 1, 2)
+	if err != nil {
+		t.Fatalf("GetRunnerImprovementRate failed: %v", err)
+	}
+
+	want := []ImprovementStat{
+		{Name: "Runner A", FirstTime: 1200, LatestTime: 1180, ImprovementSeconds: 20, ImprovementPercent: 20.0 / 1200 * 100, RunCount: 2},
+		{Name: "Runner D", FirstTime: 1100, LatestTime: 1190, ImprovementSeconds: -90, ImprovementPercent: -90.0 / 1100 * 100, RunCount: 2},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("GetRunnerImprovementRate() = %+v, want %+v", stats, want)
+	}
+
+	stats, err = GetRunnerImprovementRate(db, 1, 3)
+	if err != nil {
+		t.Fatalf("GetRunnerImprovementRate failed: %v", err)
+	}
+	if len(stats) != 0 {
+		t.Errorf("Expected no runners with 3 runs, got %+v", stats)
+	}
+}
+
+func TestReportsWithShortAgeCategory(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Some unknown runners have a one-letter age category
+	_, err := db.Exec(`
+		INSERT INTO results (event_id, position, name, time_seconds, age_category) VALUES
+		(1, 3, 'Runner E', 1600, 'V'),
+		(3, 2, 'Runner F', 1700, 'V')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureStdout(t, func() {
+		if err := PrintReports(db, "test-park-1", reportSections); err != nil {
+			t.Errorf("PrintReports failed: %v", err)
+		}
+	})
+	if !strings.Contains(output, "--- Other") || !strings.Contains(output, "V: 26:40") {
+		t.Errorf("Expected the one-letter category under Other:\n%s", output)
+	}
+
+	output = captureStdout(t, func() {
+		if err := PrintComparisonReport(db, "test-park-1", "test-park-2"); err != nil {
+			t.Errorf("PrintComparisonReport failed: %v", err)
+		}
+	})
+	if !strings.Contains(output, "Others:") {
+		t.Errorf("Expected the one-letter category under Others:\n%s", output)
+	}
+}
+
+func TestGetVolunteerStats(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	volunteers := []Volunteer{{Name: "Volunteer X"}, {Name: "Volunteer Y", Role: "Timekeeper"}}
+	if err := StoreVolunteers(db, volunteers, 1); err != nil {
+		t.Fatalf("StoreVolunteers failed: %v", err)
+	}
+	if volunteers[0].EventID != 1 || volunteers[1].EventID != 1 {
+		t.Errorf("Expected StoreVolunteers to set each EventID to 1, got %+v", volunteers)
+	}
+	// Storing an event's volunteers again replaces them
+	for i := 0; i < 2; i++ {
+		if err := StoreVolunteers(db, []Volunteer{{Name: "Volunteer X"}}, 2); err != nil {
+			t.Fatalf("StoreVolunteers failed: %v", err)
+		}
+	}
+	if err := StoreVolunteers(db, []Volunteer{{Name: "Volunteer Z"}}, 3); err != nil {
+		t.Fatalf("StoreVolunteers failed: %v", err)
+	}
+
+	stats, err := GetVolunteerStats(db, 1, 10)
+	if err != nil {
+		t.Fatalf("GetVolunteerStats failed: %v", err)
+	}
+	want := []VolunteerStat{{Name: "Volunteer X", Events: 2}, {Name: "Volunteer Y", Events: 1}}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("GetVolunteerStats() = %+v, want %+v", stats, want)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// RetryPolicy is how long to wait before retrying an event after a transient
+// error, growing by Multiplier after each failure up to MaxDelay
+type RetryPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	// Jitter is the fraction of each delay randomly added or taken off, e.g.
+	// 0.2 for ±20%, so clients that failed together don't retry together
+	Jitter float64
+	// Attempts is how many times an event is retried after transient errors
+	// in a row before the scrape stops
+	Attempts int
+}
+
+// retryPolicy is used for transient errors while scraping, set with the
+// --retry-* parse flags
+var retryPolicy = RetryPolicy{
+	InitialDelay: 5 * time.Second,
+	MaxDelay:     2 * time.Minute,
+	Multiplier:   2,
+	Jitter:       0.2,
+	// Enough retries for the wait to reach MaxDelay: 5s, 10s, 20s, 40s, 80s, 2m
+	Attempts: 6,
+}
+
+// Delay returns the wait before the given retry, counting from 1
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	delay := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(retry-1))
+	if max := float64(p.MaxDelay); p.MaxDelay > 0 && delay > max {
+		delay = max
+	}
+	if p.Jitter > 0 {
+		delay *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(delay)
+}
+
+// isTransient reports whether err is a server or network failure that's
+// likely to go away if the request is retried
+func isTransient(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case 500, 502, 503, 504:
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// maxFailures returns how many failures in a row, the last being err, stop a
+// scrape. Transient errors get the retry policy's attempts, anything else
+// maxConsecutiveErrors.
+func maxFailures(err error) int {
+	if isTransient(err) {
+		return retryPolicy.Attempts + 1
+	}
+	return maxConsecutiveErrors
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{InitialDelay: time.Second, MaxDelay: 5 * time.Second, Multiplier: 2}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := policy.Delay(i + 1); got != w {
+			t.Errorf("Delay(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.Delay(2); got < time.Second || got > 3*time.Second {
+			t.Fatalf("Expected 2s ±50%%, got %v", got)
+		}
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&HTTPError{StatusCode: 503}, true},
+		{fmt.Errorf("fetching: %w", &HTTPError{StatusCode: 500}), true},
+		{&HTTPError{StatusCode: 404}, false},
+		{&HTTPError{StatusCode: 405}, false},
+		{fmt.Errorf("failed to make HTTP request: %w", timeoutError{}), true},
+		{errors.New("no results table"), false},
+	}
+	for _, tt := range tests {
+		if got := isTransient(tt.err); got != tt.want {
+			t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// timeoutError is a net.Error like a request timing out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestScrapeRetriesServerErrors(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	serve := servePages(map[int]string{
+		1: fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30")),
+	})
+	failures := 0
+	server := newFakeParkrunServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if failures < 4 {
+			failures++
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		serve(w, r)
+	})
+	defer server.Close()
+	retryPolicy = RetryPolicy{InitialDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, Multiplier: 2, Attempts: 4}
+
+	result, err := Scrape(db, "test-park", ScrapeOptions{})
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	if result.EventsStored != 1 || result.Errors != 4 || result.StopReason != StopEndOfEvents {
+		t.Errorf("Expected event 1 stored after 4 retries, got %+v", result)
+	}
+}
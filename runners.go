@@ -0,0 +1,1192 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunnerTotals holds a runner's cumulative totals at a location
+type RunnerTotals struct {
+	Name       string
+	TotalRuns  int
+	DistanceKm float64
+	// Time totals only include runs with a recorded time
+	TimedRuns      int
+	TotalSeconds   int
+	AverageSeconds int
+}
+
+// SharedRunner is a runner who has run at both of two locations
+type SharedRunner struct {
+	AthleteID int
+	Name      string
+	Runs1     int
+	Runs2     int
+}
+
+// TourismEdge is how many runners two locations have in common
+type TourismEdge struct {
+	From          string `json:"from"`
+	To            string `json:"to"`
+	SharedRunners int    `json:"shared_runners"`
+}
+
+// CategorySpell is a stretch of time a runner ran in one age category
+type CategorySpell struct {
+	Category string
+	From     time.Time
+	To       time.Time
+	Runs     int
+}
+
+// GlobalProfile is a runner's all-time record across every stored location
+type GlobalProfile struct {
+	AthleteID int
+	Name      string
+	// TotalRuns counts stored results. ParkrunTotal is parkrun's own count from
+	// their latest result, which includes locations that haven't been scraped.
+	TotalRuns    int
+	ParkrunTotal int
+	Locations    int
+	DistanceKm   float64
+	BestSeconds  int
+	BestLocation string
+	BestDate     time.Time
+	Milestones   []int
+}
+
+// AGPoint is one of a runner's runs in their age-grade progression
+type AGPoint struct {
+	EventNumber int
+	Date        time.Time
+	TimeSeconds int
+	// AgeGrade is 0 for runs without a numeric age grade
+	AgeGrade float64
+	// TimePB and AgeGradePB mark runs that beat every earlier time or age grade
+	TimePB     bool
+	AgeGradePB bool
+}
+
+// PBEvent is a run that was a runner's fastest at a location at the time
+type PBEvent struct {
+	EventNumber int
+	Date        time.Time
+	TimeSeconds int
+	// Improvement is how many seconds faster than the previous PB, 0 for the first run
+	Improvement int
+}
+
+// RunnerRun is one of a runner's runs at a location
+type RunnerRun struct {
+	Name        string
+	EventNumber int
+	Date        time.Time
+	Position    int
+	// TimeSeconds is 0 for runs without a time
+	TimeSeconds int
+	AgeGrade    string
+}
+
+// RunnerSummary sums up a runner's history at a location
+type RunnerSummary struct {
+	Name      string
+	TotalRuns int
+	// Time stats only include runs with a recorded time
+	BestSeconds    int
+	BestDate       time.Time
+	AverageSeconds int
+	BestAgeGrade   float64
+	// Streaks are counted in runs, as worked out by GetRunnerStreaks
+	CurrentStreak int
+	LongestStreak int
+}
+
+// streakMaxGapDays is the most days between runs that keeps a streak going.
+// It allows for an extra event in the same week, like Christmas Day and New
+// Year's Day, but not a missed week.
+const streakMaxGapDays = 8
+
+// runMilestones are the parkrun run counts marked with a milestone
+var runMilestones = []int{25, 50, 100, 250, 500, 1000}
+
+// ErrTooFewRuns is returned for a trend when a runner has fewer than two runs
+var ErrTooFewRuns = errors.New("at least 2 runs are needed for a trend")
+
+// plateauRecentRuns is how many of a runner's latest timed runs are checked
+// for improvement when looking for plateaued runners
+const plateauRecentRuns = 5
+
+// splitLocation splits a location like "bushy" or "bushy:GBR" into its slug
+// and country code. The country is empty when it isn't given.
+func splitLocation(location string) (string, string) {
+	if i := strings.LastIndex(location, ":"); i != -1 {
+		return location[:i], strings.ToUpper(location[i+1:])
+	}
+	return location, ""
+}
+
+// findLocationID looks up a location's ID from its slug, qualified with a
+// country if the slug is used in more than one. found is false if there's no
+// such location.
+func findLocationID(db *sql.DB, location string) (int, bool, error) {
+	slug, country := splitLocation(location)
+	rows, err := db.Query(`
+		SELECT id, country 
+		FROM locations 
+		WHERE slug = ? 
+		AND (? = '' OR country = ?)
+		ORDER BY country`, slug, country, country)
+	if err != nil {
+		return 0, false, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	var countries []string
+	for rows.Next() {
+		var id int
+		var locationCountry string
+		if err := rows.Scan(&id, &locationCountry); err != nil {
+			return 0, false, fmt.Errorf("database error: %v", err)
+		}
+		ids = append(ids, id)
+		countries = append(countries, locationCountry)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, false, fmt.Errorf("database error: %v", err)
+	}
+
+	switch len(ids) {
+	case 0:
+		return 0, false, nil
+	case 1:
+		return ids[0], true, nil
+	}
+	return 0, false, fmt.Errorf("location '%s' exists in %s, choose one like %s:%s",
+		slug, strings.Join(countries, " and "), slug, countries[0])
+}
+
+// getLocationID looks up a location's ID, returning an error if it isn't found
+func getLocationID(db *sql.DB, location string) (int, error) {
+	locationID, found, err := findLocationID(db, location)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("location '%s' %w", location, ErrNotFound)
+	}
+	return locationID, nil
+}
+
+// GetRunnerStatsAtLocation returns a runner's statistics at a single location.
+// A runner who has never run there gets a stat with zero runs.
+func GetRunnerStatsAtLocation(db *sql.DB, locationID int, runnerName string) (RunnerStat, error) {
+	stat := RunnerStat{Name: runnerName}
+
+	var bestSeconds sql.NullInt64
+	var ageGrade sql.NullFloat64
+	var firstEventStr, lastEventStr sql.NullString
+	err := db.QueryRow(`
+		SELECT 
+			COUNT(*),
+			MIN(CASE WHEN r.time_seconds > 0 THEN r.time_seconds END),
+			AVG(CAST(REPLACE(r.age_grade, '%', '') AS REAL)),
+			MIN(e.date),
+			MAX(e.date)
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.name = ?`, locationID, runnerName).Scan(
+		&stat.TotalRuns,
+		&bestSeconds,
+		&ageGrade,
+		&firstEventStr,
+		&lastEventStr,
+	)
+	if err != nil {
+		return RunnerStat{}, fmt.Errorf("runner stats error: %v", err)
+	}
+	if stat.TotalRuns == 0 {
+		return stat, nil
+	}
+
+	stat.BestTime = secondsToTime(int(bestSeconds.Int64))
+	stat.AgeGrade = ageGrade.Float64
+	stat.FirstEvent, err = parseDateTime(firstEventStr.String)
+	if err != nil {
+		return RunnerStat{}, err
+	}
+	stat.LastEvent, err = parseDateTime(lastEventStr.String)
+	if err != nil {
+		return RunnerStat{}, err
+	}
+	return stat, nil
+}
+
+// CompareCourseForRunner returns a runner's statistics at each of two locations
+func CompareCourseForRunner(db *sql.DB, runnerName, location1, location2 string) (RunnerStat, RunnerStat, error) {
+	var stats [2]RunnerStat
+	for i, slug := range []string{location1, location2} {
+		locationID, err := getLocationID(db, slug)
+		if err != nil {
+			return RunnerStat{}, RunnerStat{}, err
+		}
+		stats[i], err = GetRunnerStatsAtLocation(db, locationID, runnerName)
+		if err != nil {
+			return RunnerStat{}, RunnerStat{}, err
+		}
+	}
+	return stats[0], stats[1], nil
+}
+
+// PrintRunnerComparisonReport prints a runner's stats at two locations
+// followed by the comparison of the locations themselves
+func PrintRunnerComparisonReport(db *sql.DB, runnerName, location1, location2 string) error {
+	stat1, stat2, err := CompareCourseForRunner(db, runnerName, location1, location2)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n\n", heading("%s: %s | %s", runnerName, location1, location2))
+	if stat1.TotalRuns == 0 {
+		fmt.Printf("%s has not run at %s\n", runnerName, location1)
+	}
+	if stat2.TotalRuns == 0 {
+		fmt.Printf("%s has not run at %s\n", runnerName, location2)
+	}
+
+	fmt.Printf("Runs:               %8d | %8d\n", stat1.TotalRuns, stat2.TotalRuns)
+	fmt.Printf("Best Time:          %8s | %8s\n", runnerValue(stat1, stat1.BestTime), runnerValue(stat2, stat2.BestTime))
+	fmt.Printf("Avg Age Grade:      %8s | %8s\n",
+		runnerValue(stat1, fmt.Sprintf("%.2f%%", stat1.AgeGrade)),
+		runnerValue(stat2, fmt.Sprintf("%.2f%%", stat2.AgeGrade)))
+	fmt.Printf("First Run:          %8s | %8s\n",
+		runnerValue(stat1, stat1.FirstEvent.Format("02/01/06")),
+		runnerValue(stat2, stat2.FirstEvent.Format("02/01/06")))
+	fmt.Printf("Last Run:           %8s | %8s\n",
+		runnerValue(stat1, stat1.LastEvent.Format("02/01/06")),
+		runnerValue(stat2, stat2.LastEvent.Format("02/01/06")))
+
+	return PrintComparisonReport(db, location1, location2)
+}
+
+// runnerValue returns value, or N/A if the runner has no runs to take it from
+func runnerValue(stat RunnerStat, value string) string {
+	if stat.TotalRuns == 0 {
+		return "N/A"
+	}
+	return value
+}
+
+// GetRunnerTotals returns a runner's total runs, distance and time at a
+// location, using the location's configured distance
+func GetRunnerTotals(db *sql.DB, locationID int, runnerName string) (*RunnerTotals, error) {
+	totals := &RunnerTotals{Name: runnerName}
+
+	var distanceKm float64
+	err := db.QueryRow(`SELECT distance_km FROM locations WHERE id = ?`, locationID).Scan(&distanceKm)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("location %d %w", locationID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("distance error: %v", err)
+	}
+
+	err = db.QueryRow(`
+		SELECT 
+			COUNT(*),
+			COUNT(CASE WHEN r.time_seconds > 0 THEN 1 END),
+			COALESCE(SUM(CASE WHEN r.time_seconds > 0 THEN r.time_seconds END), 0)
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.name = ?`, locationID, runnerName).Scan(
+		&totals.TotalRuns,
+		&totals.TimedRuns,
+		&totals.TotalSeconds,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("runner totals error: %v", err)
+	}
+
+	totals.DistanceKm = float64(totals.TotalRuns) * distanceKm
+	if totals.TimedRuns > 0 {
+		totals.AverageSeconds = totals.TotalSeconds / totals.TimedRuns
+	}
+	return totals, nil
+}
+
+// PrintRunnerTotals prints a runner's cumulative totals at a location
+func PrintRunnerTotals(db *sql.DB, runnerName, locationSlug string) error {
+	locationID, err := getLocationID(db, locationSlug)
+	if err != nil {
+		return err
+	}
+	totals, err := GetRunnerTotals(db, locationID, runnerName)
+	if err != nil {
+		return err
+	}
+
+	meta, err := reportMeta(db, locationID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n", heading("Totals for %s at %s", runnerName, locationSlug))
+	printReportMeta(locationSlug, meta)
+	if totals.TotalRuns == 0 {
+		fmt.Printf("%s has not run at %s\n", runnerName, locationSlug)
+		return nil
+	}
+	fmt.Printf("You've run %g km across %d parkruns here\n", totals.DistanceKm, totals.TotalRuns)
+	if totals.TimedRuns > 0 {
+		fmt.Printf("Total Time: %s\n", secondsToTime(totals.TotalSeconds))
+		fmt.Printf("Average Time: %s (from %d timed runs)\n", secondsToTime(totals.AverageSeconds), totals.TimedRuns)
+	}
+
+	slope, err := GetRunnerPositionTrend(db, locationID, runnerName)
+	if err != nil && err != ErrTooFewRuns {
+		return err
+	}
+	if err == nil {
+		fmt.Printf("Position Trend: %s\n", describePositionTrend(slope))
+	}
+	return nil
+}
+
+// GetRunnerPositionTrend fits a straight line to a runner's finishing positions
+// at a location, in the order they ran, and returns its slope: the average
+// change in position per run. A negative slope means finishing higher.
+func GetRunnerPositionTrend(db *sql.DB, locationID int, runnerName string) (float64, error) {
+	rows, err := db.Query(`
+		SELECT r.position
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.name = ?
+		ORDER BY e.date, e.event_number`, locationID, runnerName)
+	if err != nil {
+		return 0, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var positions []float64
+	for rows.Next() {
+		var position int
+		if err := rows.Scan(&position); err != nil {
+			return 0, fmt.Errorf("scan error: %v", err)
+		}
+		positions = append(positions, float64(position))
+	}
+	if len(positions) < 2 {
+		return 0, ErrTooFewRuns
+	}
+
+	// Least squares fit of position against run index
+	n := float64(len(positions))
+	meanX := (n - 1) / 2
+	var meanY float64
+	for _, y := range positions {
+		meanY += y
+	}
+	meanY /= n
+
+	var covariance, variance float64
+	for i, y := range positions {
+		dx := float64(i) - meanX
+		covariance += dx * (y - meanY)
+		variance += dx * dx
+	}
+	return covariance / variance, nil
+}
+
+// describePositionTrend puts a position trend slope into words
+func describePositionTrend(slope float64) string {
+	places := math.Abs(slope)
+	switch {
+	case places < 0.5:
+		return "you typically finish in about the same place each week"
+	case slope < 0:
+		return fmt.Sprintf("you typically finish ~%.0f places higher each week", places)
+	default:
+		return fmt.Sprintf("you typically finish ~%.0f places lower each week", places)
+	}
+}
+
+// GetPlateauedRunners returns regulars with at least minRuns timed runs at a
+// location whose last plateauRecentRuns runs are all slower than their best
+// from before then. BestTime is that earlier best. Runners with an athlete ID
+// are listed under their current name.
+func GetPlateauedRunners(db *sql.DB, locationID int, minRuns int) ([]RunnerStat, error) {
+	query := `
+		SELECT COALESCE(ru.name, r.name) as runner_name, r.time_seconds, e.date
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		LEFT JOIN runners ru ON ru.id = r.runner_id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.name != 'Unknown'
+		AND r.time_seconds > 0
+		ORDER BY runner_name, e.event_number`
+
+	rows, err := db.Query(query, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	type timedRun struct {
+		seconds int
+		date    time.Time
+	}
+	var names []string
+	progressions := make(map[string][]timedRun)
+	for rows.Next() {
+		var name string
+		var run timedRun
+		if err := rows.Scan(&name, &run.seconds, &run.date); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		if _, seen := progressions[name]; !seen {
+			names = append(names, name)
+		}
+		progressions[name] = append(progressions[name], run)
+	}
+
+	var plateaued []RunnerStat
+	for _, name := range names {
+		runs := progressions[name]
+		// Need some earlier runs to compare the recent ones against
+		if len(runs) < minRuns || len(runs) <= plateauRecentRuns {
+			continue
+		}
+
+		split := len(runs) - plateauRecentRuns
+		earlierBest := runs[0].seconds
+		for _, run := range runs[:split] {
+			if run.seconds < earlierBest {
+				earlierBest = run.seconds
+			}
+		}
+		improved := false
+		for _, run := range runs[split:] {
+			if run.seconds <= earlierBest {
+				improved = true
+				break
+			}
+		}
+		if improved {
+			continue
+		}
+
+		plateaued = append(plateaued, RunnerStat{
+			Name:       name,
+			TotalRuns:  len(runs),
+			BestTime:   secondsToTime(earlierBest),
+			FirstEvent: runs[0].date,
+			LastEvent:  runs[len(runs)-1].date,
+		})
+	}
+
+	// Longest-serving regulars first
+	sort.SliceStable(plateaued, func(i, j int) bool {
+		return plateaued[i].TotalRuns > plateaued[j].TotalRuns
+	})
+	return plateaued, nil
+}
+
+// printPlateauedRunners prints regulars who haven't improved on their best lately
+func printPlateauedRunners(runners []RunnerStat) {
+	fmt.Printf("\n%s\n", heading("Plateaued Runners (no PB in last %d runs)", plateauRecentRuns))
+	if len(runners) == 0 {
+		fmt.Printf("None\n")
+		return
+	}
+	for _, runner := range runners {
+		fmt.Printf("%s: best %s, %d runs, last ran %s\n",
+			runner.Name, runner.BestTime, runner.TotalRuns, runner.LastEvent.Format("2 January 2006"))
+	}
+}
+
+// GetRunnerCategoryHistory returns the age categories a runner has run in at a
+// location, in date order, with the first and last run in each. Results with no
+// category are skipped rather than splitting a spell.
+func GetRunnerCategoryHistory(db *sql.DB, locationID int, runnerName string) ([]CategorySpell, error) {
+	query := `
+		SELECT r.age_category, e.date
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.name = ?
+		AND r.age_category != ''
+		ORDER BY e.date, e.event_number`
+
+	rows, err := db.Query(query, locationID, runnerName)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var spells []CategorySpell
+	for rows.Next() {
+		var category string
+		var date time.Time
+		if err := rows.Scan(&category, &date); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		if len(spells) > 0 && spells[len(spells)-1].Category == category {
+			spells[len(spells)-1].To = date
+			spells[len(spells)-1].Runs++
+			continue
+		}
+		spells = append(spells, CategorySpell{Category: category, From: date, To: date, Runs: 1})
+	}
+
+	return spells, nil
+}
+
+// PrintRunnerCategoryHistory prints a runner's age category timeline at a location
+func PrintRunnerCategoryHistory(db *sql.DB, runnerName, locationSlug string) error {
+	locationID, err := getLocationID(db, locationSlug)
+	if err != nil {
+		return err
+	}
+	spells, err := GetRunnerCategoryHistory(db, locationID, runnerName)
+	if err != nil {
+		return err
+	}
+	meta, err := reportMeta(db, locationID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n", heading("Age Categories for %s at %s", runnerName, locationSlug))
+	printReportMeta(locationSlug, meta)
+	if len(spells) == 0 {
+		fmt.Printf("%s has no results with an age category at %s\n", runnerName, locationSlug)
+		return nil
+	}
+	for _, spell := range spells {
+		fmt.Printf("%s: %s to %s (%d runs)\n", spell.Category,
+			spell.From.Format("2 January 2006"), spell.To.Format("2 January 2006"), spell.Runs)
+	}
+	return nil
+}
+
+// GetSharedRunners returns the runners, matched by athlete ID, who have run at
+// both locations, most runs first
+func GetSharedRunners(db *sql.DB, location1, location2 string) ([]SharedRunner, error) {
+	locationID1, err := getLocationID(db, location1)
+	if err != nil {
+		return nil, err
+	}
+	locationID2, err := getLocationID(db, location2)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT 
+			r.athlete_id,
+			COALESCE(MAX(ru.name), MAX(r.name)) AS name,
+			COUNT(CASE WHEN e.location_id = ? THEN 1 END) AS runs1,
+			COUNT(CASE WHEN e.location_id = ? THEN 1 END) AS runs2
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		LEFT JOIN runners ru ON ru.id = r.runner_id
+		WHERE e.location_id IN (?, ?)
+		AND e.excluded = 0
+		AND r.athlete_id > 0
+		GROUP BY r.athlete_id
+		HAVING runs1 > 0 AND runs2 > 0
+		ORDER BY runs1 + runs2 DESC, name`
+
+	rows, err := db.Query(query, locationID1, locationID2, locationID1, locationID2)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var shared []SharedRunner
+	for rows.Next() {
+		var runner SharedRunner
+		if err := rows.Scan(&runner.AthleteID, &runner.Name, &runner.Runs1, &runner.Runs2); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		shared = append(shared, runner)
+	}
+
+	return shared, nil
+}
+
+// GetTourismEdges returns how many runners, matched by athlete ID, each pair
+// of locations has in common, most shared first. Pairs with no runners in
+// common are left out. Every pair is counted in one pass over each runner's
+// distinct locations rather than comparing locations two at a time.
+func GetTourismEdges(db *sql.DB) ([]TourismEdge, error) {
+	// Slugs used in more than one country are qualified, e.g. bushy:GBR
+	query := `
+		WITH visits AS (
+			SELECT DISTINCT r.athlete_id, e.location_id
+			FROM results r
+			JOIN events e ON r.event_id = e.id
+			WHERE e.excluded = 0
+			AND r.athlete_id > 0
+		),
+		names AS (
+			SELECT 
+				l.id,
+				CASE WHEN (SELECT COUNT(*) FROM locations other WHERE other.slug = l.slug) > 1
+					THEN l.slug || ':' || l.country
+					ELSE l.slug
+				END AS name
+			FROM locations l
+		)
+		SELECT n1.name, n2.name, COUNT(*) AS shared
+		FROM visits v1
+		JOIN visits v2 ON v1.athlete_id = v2.athlete_id AND v1.location_id < v2.location_id
+		JOIN names n1 ON n1.id = v1.location_id
+		JOIN names n2 ON n2.id = v2.location_id
+		GROUP BY v1.location_id, v2.location_id
+		ORDER BY shared DESC, n1.name, n2.name`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var edges []TourismEdge
+	for rows.Next() {
+		var edge TourismEdge
+		if err := rows.Scan(&edge.From, &edge.To, &edge.SharedRunners); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		edges = append(edges, edge)
+	}
+	return edges, nil
+}
+
+// printSharedRunners prints the runners two locations have in common, up to limit of them
+func printSharedRunners(location1, location2 string, shared []SharedRunner, limit int) {
+	fmt.Printf("\n%s\n", heading("Runners Shared by %s and %s", location1, location2))
+	if len(shared) == 0 {
+		fmt.Printf("No runners have run at both\n")
+		return
+	}
+	fmt.Printf("%d runners have run at both\n", len(shared))
+	for i, runner := range shared {
+		if i == limit {
+			fmt.Printf("...and %d more\n", len(shared)-limit)
+			break
+		}
+		fmt.Printf("%s: %d | %d runs\n", runner.Name, runner.Runs1, runner.Runs2)
+	}
+}
+
+// GetGlobalRunnerProfile returns an athlete's totals, best time and
+// milestones across every location in the database
+func GetGlobalRunnerProfile(db *sql.DB, athleteID int) (*GlobalProfile, error) {
+	profile := &GlobalProfile{AthleteID: athleteID}
+
+	err := db.QueryRow(`
+		SELECT 
+			COUNT(*),
+			COUNT(DISTINCT e.location_id),
+			COALESCE(SUM(l.distance_km), 0),
+			COALESCE(MAX(r.total_runs), 0)
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		JOIN locations l ON e.location_id = l.id
+		WHERE r.athlete_id = ?
+		AND e.excluded = 0`, athleteID).Scan(
+		&profile.TotalRuns,
+		&profile.Locations,
+		&profile.DistanceKm,
+		&profile.ParkrunTotal,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("runner profile error: %v", err)
+	}
+	if profile.TotalRuns == 0 {
+		return nil, fmt.Errorf("athlete %d %w", athleteID, ErrNotFound)
+	}
+
+	// Their name in the runners table, or from their latest run for results
+	// not yet linked to it, in case it has changed
+	err = db.QueryRow(`
+		SELECT COALESCE(ru.name, r.name)
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		LEFT JOIN runners ru ON ru.id = r.runner_id
+		WHERE r.athlete_id = ?
+		AND e.excluded = 0
+		ORDER BY e.date DESC
+		LIMIT 1`, athleteID).Scan(&profile.Name)
+	if err != nil {
+		return nil, fmt.Errorf("runner name error: %v", err)
+	}
+
+	err = db.QueryRow(`
+		SELECT r.time_seconds, l.slug, e.date
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		JOIN locations l ON e.location_id = l.id
+		WHERE r.athlete_id = ?
+		AND e.excluded = 0
+		AND r.time_seconds > 0
+		ORDER BY r.time_seconds, e.date
+		LIMIT 1`, athleteID).Scan(&profile.BestSeconds, &profile.BestLocation, &profile.BestDate)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("runner best time error: %v", err)
+	}
+
+	runs := profile.TotalRuns
+	if profile.ParkrunTotal > runs {
+		runs = profile.ParkrunTotal
+	}
+	for _, milestone := range runMilestones {
+		if runs >= milestone {
+			profile.Milestones = append(profile.Milestones, milestone)
+		}
+	}
+
+	return profile, nil
+}
+
+// findAthleteID returns the athlete ID for a runner given by ID or by name.
+// A name has to belong to exactly one athlete.
+func findAthleteID(db *sql.DB, runner string) (int, error) {
+	if athleteID, err := strconv.Atoi(runner); err == nil {
+		return athleteID, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT DISTINCT athlete_id
+		FROM results
+		WHERE name = ?
+		AND athlete_id > 0
+		ORDER BY athlete_id`, runner)
+	if err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	var athleteID int
+	for rows.Next() {
+		if err := rows.Scan(&athleteID); err != nil {
+			return 0, fmt.Errorf("database error: %v", err)
+		}
+		ids = append(ids, strconv.Itoa(athleteID))
+	}
+	switch len(ids) {
+	case 0:
+		return 0, fmt.Errorf("no athlete ID found for '%s'", runner)
+	case 1:
+		return athleteID, nil
+	}
+	return 0, fmt.Errorf("'%s' matches athletes %s, use an athlete ID", runner, strings.Join(ids, ", "))
+}
+
+// PrintGlobalRunnerProfile prints a runner's all-time stats across every location
+func PrintGlobalRunnerProfile(db *sql.DB, runner string) error {
+	athleteID, err := findAthleteID(db, runner)
+	if err != nil {
+		return err
+	}
+	profile, err := GetGlobalRunnerProfile(db, athleteID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n", heading("Profile for %s (A%d)", profile.Name, profile.AthleteID))
+	fmt.Printf("Parkruns: %d at %d locations\n", profile.TotalRuns, profile.Locations)
+	if profile.ParkrunTotal > profile.TotalRuns {
+		fmt.Printf("Parkruns including unscraped locations: %d\n", profile.ParkrunTotal)
+	}
+	fmt.Printf("Distance: %g km\n", profile.DistanceKm)
+	if profile.BestSeconds > 0 {
+		fmt.Printf("PB: %s at %s on %s\n", secondsToTime(profile.BestSeconds), profile.BestLocation,
+			profile.BestDate.Format("2006-01-02"))
+	}
+	if len(profile.Milestones) > 0 {
+		milestones := make([]string, len(profile.Milestones))
+		for i, milestone := range profile.Milestones {
+			milestones[i] = strconv.Itoa(milestone)
+		}
+		fmt.Printf("Milestones: %s\n", strings.Join(milestones, ", "))
+	}
+	return nil
+}
+
+// GetRunnerAgeGradeProgression returns a runner's runs at a location in date
+// order, marking the ones that were time PBs and age-grade PBs. An older runner
+// can set an age-grade PB without beating their fastest time.
+func GetRunnerAgeGradeProgression(db *sql.DB, locationID int, runnerName string) ([]AGPoint, error) {
+	rows, err := db.Query(`
+		SELECT e.event_number, e.date, COALESCE(r.time_seconds, 0), COALESCE(r.age_grade, '')
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.name = ?
+		ORDER BY e.date, e.event_number`, locationID, runnerName)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var points []AGPoint
+	bestSeconds := 0
+	bestAgeGrade := 0.0
+	for rows.Next() {
+		var point AGPoint
+		var ageGradeText string
+		if err := rows.Scan(&point.EventNumber, &point.Date, &point.TimeSeconds, &ageGradeText); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		point.AgeGrade, _ = parseAgeGrade(ageGradeText)
+
+		if point.TimeSeconds > 0 && (bestSeconds == 0 || point.TimeSeconds < bestSeconds) {
+			point.TimePB = true
+			bestSeconds = point.TimeSeconds
+		}
+		if point.AgeGrade > bestAgeGrade {
+			point.AgeGradePB = true
+			bestAgeGrade = point.AgeGrade
+		}
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// PrintRunnerAgeGradeProgression prints a runner's times and age grades at a
+// location, marking time PBs and age-grade PBs
+func PrintRunnerAgeGradeProgression(db *sql.DB, runnerName, locationSlug string) error {
+	locationID, err := getLocationID(db, locationSlug)
+	if err != nil {
+		return err
+	}
+	points, err := GetRunnerAgeGradeProgression(db, locationID, runnerName)
+	if err != nil {
+		return err
+	}
+
+	meta, err := reportMeta(db, locationID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n", heading("Progression for %s at %s", runnerName, locationSlug))
+	printReportMeta(locationSlug, meta)
+	if len(points) == 0 {
+		fmt.Printf("%s has not run at %s\n", runnerName, locationSlug)
+		return nil
+	}
+	for _, point := range points {
+		ageGrade := "no age grade"
+		if point.AgeGrade > 0 {
+			ageGrade = fmt.Sprintf("%.2f%%", point.AgeGrade)
+		}
+		var pbs []string
+		if point.TimePB {
+			pbs = append(pbs, "time PB")
+		}
+		if point.AgeGradePB {
+			pbs = append(pbs, "age-grade PB")
+		}
+		marker := ""
+		if len(pbs) > 0 {
+			marker = " " + highlight(strings.Join(pbs, ", "))
+		}
+		fmt.Printf("#%d %s: %s, %s%s\n", point.EventNumber, point.Date.Format("2006-01-02"),
+			secondsToTime(point.TimeSeconds), ageGrade, marker)
+	}
+	return nil
+}
+
+// GetRunnerPBEvents returns the runs where a runner beat all their previous
+// times at a location, worked out from their times rather than the PB note
+// scraped from parkrun
+func GetRunnerPBEvents(db *sql.DB, locationID int, runnerName string) ([]PBEvent, error) {
+	points, err := GetRunnerAgeGradeProgression(db, locationID, runnerName)
+	if err != nil {
+		return nil, err
+	}
+
+	var pbs []PBEvent
+	for _, point := range points {
+		if !point.TimePB {
+			continue
+		}
+		pb := PBEvent{EventNumber: point.EventNumber, Date: point.Date, TimeSeconds: point.TimeSeconds}
+		if len(pbs) > 0 {
+			pb.Improvement = pbs[len(pbs)-1].TimeSeconds - point.TimeSeconds
+		}
+		pbs = append(pbs, pb)
+	}
+	return pbs, nil
+}
+
+// PrintRunnerPBEvents lists the runs where a runner set a PB at a location
+func PrintRunnerPBEvents(db *sql.DB, runnerName, locationSlug string) error {
+	locationID, err := getLocationID(db, locationSlug)
+	if err != nil {
+		return err
+	}
+	pbs, err := GetRunnerPBEvents(db, locationID, runnerName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n", heading("PBs for %s at %s", runnerName, locationSlug))
+	if len(pbs) == 0 {
+		fmt.Printf("%s has no timed runs at %s\n", runnerName, locationSlug)
+		return nil
+	}
+	for _, pb := range pbs {
+		improvement := "first run"
+		if pb.Improvement > 0 {
+			improvement = fmt.Sprintf("%s faster", secondsToTime(pb.Improvement))
+		}
+		fmt.Printf("#%d %s: %s (%s)\n", pb.EventNumber, pb.Date.Format("2006-01-02"), secondsToTime(pb.TimeSeconds), improvement)
+	}
+	return nil
+}
+
+// runnerNameMatch returns the condition and argument for matching a runner's
+// name in results r, the whole name if exact is set or otherwise any name
+// containing it. LIKE wildcards in name are matched literally.
+func runnerNameMatch(name string, exact bool) (string, string) {
+	if exact {
+		return "r.name = ?", name
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(name)
+	return `r.name LIKE '%' || ? || '%' ESCAPE '\'`, escaped
+}
+
+// GetRunnerHistory returns every run at a location by runners matching name,
+// in date order. With exact, only runners with exactly that name match.
+func GetRunnerHistory(db *sql.DB, locationID int, name string, exact bool) ([]RunnerRun, error) {
+	match, arg := runnerNameMatch(name, exact)
+	rows, err := db.Query(`
+		SELECT r.name, e.event_number, e.date, r.position, COALESCE(r.time_seconds, 0), COALESCE(r.age_grade, '')
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.name != 'Unknown'
+		AND `+match+`
+		ORDER BY e.date, e.event_number, r.position`, locationID, arg)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var runs []RunnerRun
+	for rows.Next() {
+		var run RunnerRun
+		if err := rows.Scan(&run.Name, &run.EventNumber, &run.Date, &run.Position, &run.TimeSeconds, &run.AgeGrade); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// GetRunnerSummary returns the totals, PB, average time, best age grade and
+// streaks of runners matching name at a location. A runner who has
+// never run there gets a summary with zero runs. Streaks are only worked out
+// when the runs matched are all under one name, as the run dates of several
+// runners together aren't anyone's streak.
+func GetRunnerSummary(db *sql.DB, locationID int, name string, exact bool) (RunnerSummary, error) {
+	summary := RunnerSummary{Name: name}
+	runs, err := GetRunnerHistory(db, locationID, name, exact)
+	if err != nil {
+		return RunnerSummary{}, err
+	}
+
+	attended := make(map[int]bool)
+	timedRuns, totalSeconds := 0, 0
+	for _, run := range runs {
+		if !attended[run.EventNumber] {
+			attended[run.EventNumber] = true
+			summary.TotalRuns++
+		}
+		if run.TimeSeconds > 0 {
+			timedRuns++
+			totalSeconds += run.TimeSeconds
+			if summary.BestSeconds == 0 || run.TimeSeconds < summary.BestSeconds {
+				summary.BestSeconds = run.TimeSeconds
+				summary.BestDate = run.Date
+			}
+		}
+		if ageGrade, ok := parseAgeGrade(run.AgeGrade); ok && ageGrade > summary.BestAgeGrade {
+			summary.BestAgeGrade = ageGrade
+		}
+	}
+	if timedRuns > 0 {
+		summary.AverageSeconds = totalSeconds / timedRuns
+	}
+	if summary.TotalRuns == 0 {
+		return summary, nil
+	}
+
+	names := runnerNames(runs)
+	if len(names) > 1 {
+		return summary, nil
+	}
+	summary.CurrentStreak, summary.LongestStreak, err = GetRunnerStreaks(db, locationID, names[0])
+	if err != nil {
+		return RunnerSummary{}, err
+	}
+	return summary, nil
+}
+
+// runnerNames returns the different runner names in runs, in the order they
+// first appear
+func runnerNames(runs []RunnerRun) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, run := range runs {
+		if !seen[run.Name] {
+			seen[run.Name] = true
+			names = append(names, run.Name)
+		}
+	}
+	return names
+}
+
+// GetRunnerStreaks walks the dates the runner with exactly this name ran at a
+// location and returns their current and longest streaks of runs, where a streak ends
+// at a gap of more than streakMaxGapDays. The current streak is 0 if the
+// location has held events since their last run that they've missed for that
+// long.
+func GetRunnerStreaks(db *sql.DB, locationID int, name string) (current, longest int, err error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT e.date
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.name != 'Unknown'
+		AND r.name = ?
+		ORDER BY e.date`, locationID, name)
+	if err != nil {
+		return 0, 0, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var last time.Time
+	for rows.Next() {
+		var date time.Time
+		if err := rows.Scan(&date); err != nil {
+			return 0, 0, fmt.Errorf("scan error: %v", err)
+		}
+		if current > 0 && date.Sub(last) > streakMaxGapDays*24*time.Hour {
+			current = 0
+		}
+		current++
+		if current > longest {
+			longest = current
+		}
+		last = date
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("rows error: %v", err)
+	}
+	if current == 0 {
+		return 0, 0, nil
+	}
+
+	var latestStr string
+	err = db.QueryRow(`
+		SELECT MAX(date)
+		FROM events
+		WHERE location_id = ?
+		AND excluded = 0`, locationID).Scan(&latestStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("latest event error: %v", err)
+	}
+	latest, err := parseDateTime(latestStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if latest.Sub(last) > streakMaxGapDays*24*time.Hour {
+		current = 0
+	}
+	return current, longest, nil
+}
+
+// PrintRunnerHistory prints every run by runners matching name at a location
+// followed by a summary of them
+func PrintRunnerHistory(db *sql.DB, locationSlug, name string, exact bool) error {
+	locationID, err := getLocationID(db, locationSlug)
+	if err != nil {
+		return err
+	}
+	runs, err := GetRunnerHistory(db, locationID, name, exact)
+	if err != nil {
+		return err
+	}
+	summary, err := GetRunnerSummary(db, locationID, name, exact)
+	if err != nil {
+		return err
+	}
+	meta, err := reportMeta(db, locationID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n", heading("Runs by %s at %s", name, locationSlug))
+	printReportMeta(locationSlug, meta)
+	if len(runs) == 0 {
+		fmt.Printf("%s has not run at %s\n", name, locationSlug)
+		return nil
+	}
+	for _, run := range runs {
+		timeText := "no time"
+		if run.TimeSeconds > 0 {
+			timeText = secondsToTime(run.TimeSeconds)
+		}
+		ageGrade := "no age grade"
+		if value, ok := parseAgeGrade(run.AgeGrade); ok {
+			ageGrade = fmt.Sprintf("%.2f%%", value)
+		}
+		// Partial matches can take in more than one runner
+		runner := ""
+		if run.Name != name {
+			runner = run.Name + " "
+		}
+		fmt.Printf("#%d %s: %s%s, position %d, %s\n", run.EventNumber, run.Date.Format("2006-01-02"),
+			runner, timeText, run.Position, ageGrade)
+	}
+
+	fmt.Printf("\nTotal Runs: %d\n", summary.TotalRuns)
+	if summary.BestSeconds > 0 {
+		fmt.Printf("PB: %s on %s\n", secondsToTime(summary.BestSeconds), summary.BestDate.Format("2006-01-02"))
+		fmt.Printf("Average Time: %s\n", secondsToTime(summary.AverageSeconds))
+	}
+	if summary.BestAgeGrade > 0 {
+		fmt.Printf("Best Age Grade: %.2f%%\n", summary.BestAgeGrade)
+	}
+	if len(runnerNames(runs)) > 1 {
+		fmt.Println("Streaks: more than one runner matched, give more of the name or add --exact to see them")
+		return nil
+	}
+	fmt.Printf("Current Streak: %d\n", summary.CurrentStreak)
+	fmt.Printf("Longest Streak: %d\n", summary.LongestStreak)
+	return nil
+}
@@ -0,0 +1,596 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompareCourseForRunner(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Runner A also runs at the second park
+	_, err := db.Exec(`
+		INSERT INTO results (position, name, time_seconds, age_grade, age_category, total_runs, event_id) VALUES 
+		(2, 'Runner A', 1250, '63.0%', 'VM35-39', 12, 3)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stat1, stat2, err := CompareCourseForRunner(db, "Runner A", "test-park-1", "test-park-2")
+	if err != nil {
+		t.Fatalf("CompareCourseForRunner failed: %v", err)
+	}
+
+	if stat1.TotalRuns != 2 || stat1.BestTime != "19:40" {
+		t.Errorf("Expected 2 runs with best 19:40 at park 1, got %d runs with best %s", stat1.TotalRuns, stat1.BestTime)
+	}
+	if stat1.AgeGrade < 65.74 || stat1.AgeGrade > 65.76 {
+		t.Errorf("Expected average age grade 65.75 at park 1, got %v", stat1.AgeGrade)
+	}
+	if !stat1.LastEvent.Equal(time.Date(2023, 1, 8, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected last run on 2023-01-08 at park 1, got %v", stat1.LastEvent)
+	}
+	if stat2.TotalRuns != 1 || stat2.BestTime != "20:50" {
+		t.Errorf("Expected 1 run with best 20:50 at park 2, got %d runs with best %s", stat2.TotalRuns, stat2.BestTime)
+	}
+
+	// Runner B has only run at the first park
+	stat1, stat2, err = CompareCourseForRunner(db, "Runner B", "test-park-1", "test-park-2")
+	if err != nil {
+		t.Fatalf("CompareCourseForRunner failed: %v", err)
+	}
+	if stat1.TotalRuns != 1 || stat2.TotalRuns != 0 {
+		t.Errorf("Expected 1 run at park 1 and none at park 2, got %d and %d", stat1.TotalRuns, stat2.TotalRuns)
+	}
+
+	_, _, err = CompareCourseForRunner(db, "Runner A", "test-park-1", "missing-park")
+	if err == nil {
+		t.Error("Expected an error for an unknown location")
+	}
+}
+
+func TestGetRunnerTotals(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// An untimed run still counts towards distance but not time
+	_, err := db.Exec(`
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(4, 3, 1, '2023-01-15', 'http://example.com/4')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO results (position, name, time_seconds, event_id) VALUES 
+		(1, 'Runner A', NULL, 4)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	totals, err := GetRunnerTotals(db, 1, "Runner A")
+	if err != nil {
+		t.Fatalf("GetRunnerTotals failed: %v", err)
+	}
+
+	want := RunnerTotals{
+		Name:           "Runner A",
+		TotalRuns:      3,
+		DistanceKm:     15,
+		TimedRuns:      2,
+		TotalSeconds:   2380,
+		AverageSeconds: 1190,
+	}
+	if *totals != want {
+		t.Errorf("GetRunnerTotals() = %+v, want %+v", *totals, want)
+	}
+}
+
+func TestGetPlateauedRunners(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	_, err := db.Exec(`INSERT INTO locations (id, slug, country) VALUES (1, 'test-park', 'AUS')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := parseDate(t, "2023-01-07")
+	for i := 1; i <= 8; i++ {
+		_, err := db.Exec(`INSERT INTO events (id, event_number, location_id, date, url) VALUES (?, ?, 1, ?, '')`,
+			i, i, start.AddDate(0, 0, 7*(i-1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Runner P set a best early on and has been slower ever since, while
+	// Runner I keeps getting faster. Runner F hasn't run enough to count.
+	times := map[string][]int{
+		"Runner P": {1300, 1200, 1250, 1240, 1260, 1255, 1245, 1250},
+		"Runner I": {1400, 1380, 1390, 1370, 1360, 1350, 1340, 1330},
+		"Runner F": {1500, 1400, 1450},
+		"Unknown":  {1600, 1500, 1550, 1560, 1570, 1580, 1590, 1600},
+	}
+	position := 0
+	for name, runnerTimes := range times {
+		position++
+		for i, seconds := range runnerTimes {
+			_, err := db.Exec(`
+				INSERT INTO results (position, name, time_seconds, age_grade, age_category, total_runs, event_id)
+				VALUES (?, ?, ?, '', 'SM30-34', ?, ?)`, position, name, seconds, i+1, i+1)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	runners, err := GetPlateauedRunners(db, 1, 6)
+	if err != nil {
+		t.Fatalf("GetPlateauedRunners failed: %v", err)
+	}
+	if len(runners) != 1 {
+		t.Fatalf("Expected 1 plateaued runner, got %+v", runners)
+	}
+	if runners[0].Name != "Runner P" || runners[0].BestTime != "20:00" || runners[0].TotalRuns != 8 {
+		t.Errorf("Expected Runner P with best 20:00 over 8 runs, got %+v", runners[0])
+	}
+
+	// Too few runs to be a regular
+	runners, err = GetPlateauedRunners(db, 1, 9)
+	if err != nil {
+		t.Fatalf("GetPlateauedRunners failed: %v", err)
+	}
+	if len(runners) != 0 {
+		t.Errorf("Expected no regulars with 9 runs, got %+v", runners)
+	}
+}
+
+func TestGetRunnerCategoryHistory(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Runner A ages into VM40-44, with an event missing a category in between
+	_, err := db.Exec(`
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(4, 3, 1, '2023-06-03', 'http://example.com/4'),
+		(5, 4, 1, '2023-06-10', 'http://example.com/5'),
+		(6, 5, 1, '2023-06-17', 'http://example.com/6');
+		INSERT INTO results (position, name, time_seconds, age_grade, age_category, total_runs, event_id) VALUES 
+		(1, 'Runner A', 1190, '66.5%', '', 12, 4),
+		(1, 'Runner A', 1195, '67.0%', 'VM40-44', 13, 5),
+		(1, 'Runner A', 1185, '67.5%', 'VM40-44', 14, 6)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spells, err := GetRunnerCategoryHistory(db, 1, "Runner A")
+	if err != nil {
+		t.Fatalf("GetRunnerCategoryHistory failed: %v", err)
+	}
+
+	want := []CategorySpell{
+		{Category: "VM35-39", From: parseDate(t, "2023-01-01"), To: parseDate(t, "2023-01-08"), Runs: 2},
+		{Category: "VM40-44", From: parseDate(t, "2023-06-10"), To: parseDate(t, "2023-06-17"), Runs: 2},
+	}
+	if len(spells) != len(want) {
+		t.Fatalf("Expected %d spells, got %+v", len(want), spells)
+	}
+	for i, w := range want {
+		got := spells[i]
+		if got.Category != w.Category || !got.From.Equal(w.From) || !got.To.Equal(w.To) || got.Runs != w.Runs {
+			t.Errorf("Spell %d: got %+v, want %+v", i, got, w)
+		}
+	}
+
+	spells, err = GetRunnerCategoryHistory(db, 1, "Nobody")
+	if err != nil {
+		t.Fatalf("GetRunnerCategoryHistory failed: %v", err)
+	}
+	if len(spells) != 0 {
+		t.Errorf("Expected no spells for an unknown runner, got %+v", spells)
+	}
+}
+
+func TestGetSharedRunners(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Runner A runs at both parks, Runner B only at the first and Runner C
+	// only at the second
+	_, err := db.Exec(`
+		UPDATE results SET athlete_id = 1001 WHERE name = 'Runner A';
+		UPDATE results SET athlete_id = 1002 WHERE name = 'Runner B';
+		UPDATE results SET athlete_id = 1003 WHERE name = 'Runner C';
+		INSERT INTO results (position, name, time_seconds, age_grade, age_category, total_runs, event_id, athlete_id) VALUES 
+		(2, 'Runner A', 1250, '63.0%', 'VM35-39', 12, 3, 1001)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared, err := GetSharedRunners(db, "test-park-1", "test-park-2")
+	if err != nil {
+		t.Fatalf("GetSharedRunners failed: %v", err)
+	}
+	want := []SharedRunner{{AthleteID: 1001, Name: "Runner A", Runs1: 2, Runs2: 1}}
+	if len(shared) != 1 || shared[0] != want[0] {
+		t.Errorf("GetSharedRunners() = %+v, want %+v", shared, want)
+	}
+
+	// No overlap once Runner A's run at the second park is gone
+	_, err = db.Exec(`DELETE FROM results WHERE event_id = 3 AND name = 'Runner A'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err = GetSharedRunners(db, "test-park-1", "test-park-2")
+	if err != nil {
+		t.Fatalf("GetSharedRunners failed: %v", err)
+	}
+	if len(shared) != 0 {
+		t.Errorf("Expected no shared runners, got %+v", shared)
+	}
+
+	if _, err := GetSharedRunners(db, "test-park-1", "missing-park"); err == nil {
+		t.Error("Expected an error for an unknown location")
+	}
+}
+
+func TestGetRunnerPositionTrend(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if _, err := db.Exec(`INSERT INTO locations (id, slug, country) VALUES (1, 'test-park', 'AUS')`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Runner A moves up two places a week: 20, 18, 16, 14, 12
+	for event := 1; event <= 5; event++ {
+		date := parseDate(t, "2023-01-07").AddDate(0, 0, 7*(event-1))
+		if _, err := db.Exec(`INSERT INTO events (id, event_number, location_id, date, url) VALUES (?, ?, 1, ?, '')`,
+			event, event, date); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO results (position, name, time_seconds, event_id) VALUES (?, 'Runner A', 1500, ?)`,
+			22-2*event, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO results (position, name, time_seconds, event_id) VALUES (1, 'Runner B', 1200, 1)`); err != nil {
+		t.Fatal(err)
+	}
+
+	slope, err := GetRunnerPositionTrend(db, 1, "Runner A")
+	if err != nil {
+		t.Fatalf("GetRunnerPositionTrend failed: %v", err)
+	}
+	if math.Abs(slope-(-2)) > 1e-9 {
+		t.Errorf("GetRunnerPositionTrend() = %v, want -2", slope)
+	}
+	if got := describePositionTrend(slope); got != "you typically finish ~2 places higher each week" {
+		t.Errorf("Unexpected description %q", got)
+	}
+
+	if _, err := GetRunnerPositionTrend(db, 1, "Runner B"); err != ErrTooFewRuns {
+		t.Errorf("Expected ErrTooFewRuns for a single run, got %v", err)
+	}
+}
+
+func TestGetGlobalRunnerProfile(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Runner A has run both parks, their best at park 2 and 49 runs elsewhere.
+	// Runner B has only run park 1.
+	_, err := db.Exec(`
+		UPDATE locations SET distance_km = 2 WHERE id = 2;
+		UPDATE results SET athlete_id = 1001 WHERE name = 'Runner A';
+		UPDATE results SET athlete_id = 1002 WHERE name = 'Runner B';
+		INSERT INTO results (position, name, time_seconds, total_runs, event_id, athlete_id) VALUES 
+		(2, 'Runner A', 1100, 60, 3, 1001)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := GetGlobalRunnerProfile(db, 1001)
+	if err != nil {
+		t.Fatalf("GetGlobalRunnerProfile failed: %v", err)
+	}
+	want := GlobalProfile{
+		AthleteID:    1001,
+		Name:         "Runner A",
+		TotalRuns:    3,
+		ParkrunTotal: 60,
+		Locations:    2,
+		DistanceKm:   12,
+		BestSeconds:  1100,
+		BestLocation: "test-park-2",
+		BestDate:     parseDate(t, "2023-01-01"),
+		Milestones:   []int{25, 50},
+	}
+	if !reflect.DeepEqual(*profile, want) {
+		t.Errorf("GetGlobalRunnerProfile() = %+v, want %+v", *profile, want)
+	}
+
+	profile, err = GetGlobalRunnerProfile(db, 1002)
+	if err != nil {
+		t.Fatalf("GetGlobalRunnerProfile failed: %v", err)
+	}
+	if profile.Locations != 1 || profile.TotalRuns != 1 || profile.BestLocation != "test-park-1" || profile.Milestones != nil {
+		t.Errorf("Unexpected single-location profile %+v", *profile)
+	}
+
+	if _, err := GetGlobalRunnerProfile(db, 9999); err == nil {
+		t.Error("Expected an error for an unknown athlete")
+	}
+
+	if id, err := findAthleteID(db, "Runner A"); err != nil || id != 1001 {
+		t.Errorf("findAthleteID(Runner A) = %d, %v, want 1001", id, err)
+	}
+	if _, err := findAthleteID(db, "Runner C"); err == nil {
+		t.Error("Expected an error for a runner without an athlete ID")
+	}
+}
+
+func TestGetRunnerAgeGradeProgression(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Runner A's fastest run is event 2, but a slower run at event 4 after a
+	// birthday is their best age grade. Event 3 has no age grade.
+	_, err := db.Exec(`
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(4, 3, 1, '2023-01-15', ''),
+		(5, 4, 1, '2023-01-22', '');
+		INSERT INTO results (position, name, time_seconds, age_grade, age_category, event_id) VALUES 
+		(1, 'Runner A', 1250, '', 'VM35-39', 4),
+		(1, 'Runner A', 1190, '67.1%', 'VM40-44', 5)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points, err := GetRunnerAgeGradeProgression(db, 1, "Runner A")
+	if err != nil {
+		t.Fatalf("GetRunnerAgeGradeProgression failed: %v", err)
+	}
+
+	want := []AGPoint{
+		{EventNumber: 1, Date: parseDate(t, "2023-01-01"), TimeSeconds: 1200, AgeGrade: 65.5, TimePB: true, AgeGradePB: true},
+		{EventNumber: 2, Date: parseDate(t, "2023-01-08"), TimeSeconds: 1180, AgeGrade: 66.0, TimePB: true, AgeGradePB: true},
+		{EventNumber: 3, Date: parseDate(t, "2023-01-15"), TimeSeconds: 1250},
+		{EventNumber: 4, Date: parseDate(t, "2023-01-22"), TimeSeconds: 1190, AgeGrade: 67.1, AgeGradePB: true},
+	}
+	if !reflect.DeepEqual(points, want) {
+		t.Errorf("GetRunnerAgeGradeProgression() = %+v, want %+v", points, want)
+	}
+}
+
+func TestGetRunnerPBEvents(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// A slower run isn't a PB, even with a stale PB note
+	_, err := db.Exec(`
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(4, 3, 1, '2023-01-15', '');
+		INSERT INTO results (position, name, time_seconds, note, event_id) VALUES 
+		(1, 'Runner A', 1250, 'New PB!', 4)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pbs, err := GetRunnerPBEvents(db, 1, "Runner A")
+	if err != nil {
+		t.Fatalf("GetRunnerPBEvents failed: %v", err)
+	}
+
+	want := []PBEvent{
+		{EventNumber: 1, Date: parseDate(t, "2023-01-01"), TimeSeconds: 1200},
+		{EventNumber: 2, Date: parseDate(t, "2023-01-08"), TimeSeconds: 1180, Improvement: 20},
+	}
+	if !reflect.DeepEqual(pbs, want) {
+		t.Errorf("GetRunnerPBEvents() = %+v, want %+v", pbs, want)
+	}
+}
+
+func TestGetTourismEdges(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Runner A has run at all three parks, Runner B at the first and third,
+	// and Runner C only at the second. Runner B's run at the second park was
+	// at an excluded event. The third park shares the first one's slug.
+	_, err := db.Exec(`
+		INSERT INTO locations (id, slug, country) VALUES (3, 'test-park-1', 'GBR');
+		INSERT INTO events (id, event_number, location_id, date, url, excluded) VALUES 
+		(4, 1, 3, '2023-01-15', '', 0),
+		(5, 2, 2, '2023-01-22', '', 1);
+		UPDATE results SET athlete_id = 1001 WHERE name = 'Runner A';
+		UPDATE results SET athlete_id = 1002 WHERE name = 'Runner B';
+		UPDATE results SET athlete_id = 1003 WHERE name = 'Runner C';
+		UPDATE results SET athlete_id = 1004 WHERE name = 'Runner D';
+		INSERT INTO results (position, name, time_seconds, event_id, athlete_id) VALUES 
+		(2, 'Runner A', 1250, 3, 1001),
+		(1, 'Runner A', 1190, 4, 1001),
+		(2, 'Runner B', 1400, 4, 1002),
+		(1, 'Runner B', 1450, 5, 1002)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edges, err := GetTourismEdges(db)
+	if err != nil {
+		t.Fatalf("GetTourismEdges failed: %v", err)
+	}
+
+	want := []TourismEdge{
+		{From: "test-park-1:AUS", To: "test-park-1:GBR", SharedRunners: 2},
+		{From: "test-park-1:AUS", To: "test-park-2", SharedRunners: 1},
+		{From: "test-park-2", To: "test-park-1:GBR", SharedRunners: 1},
+	}
+	if !reflect.DeepEqual(edges, want) {
+		t.Errorf("GetTourismEdges() = %+v, want %+v", edges, want)
+	}
+}
+
+func TestGetRunnerHistory(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Part of a name matches any runner with it in their name
+	runs, err := GetRunnerHistory(db, 1, "a", false)
+	if err != nil {
+		t.Fatalf("GetRunnerHistory failed: %v", err)
+	}
+	want := []RunnerRun{
+		{Name: "Runner A", EventNumber: 1, Date: parseDate(t, "2023-01-01"), Position: 1, TimeSeconds: 1200, AgeGrade: "65.5%"},
+		{Name: "Runner A", EventNumber: 2, Date: parseDate(t, "2023-01-08"), Position: 3, TimeSeconds: 1180, AgeGrade: "66.0%"},
+	}
+	if !reflect.DeepEqual(runs, want) {
+		t.Errorf("GetRunnerHistory() = %+v, want %+v", runs, want)
+	}
+
+	runs, err = GetRunnerHistory(db, 1, "Runner", false)
+	if err != nil {
+		t.Fatalf("GetRunnerHistory failed: %v", err)
+	}
+	if len(runs) != 4 {
+		t.Errorf("Expected 4 runs matching 'Runner', got %d", len(runs))
+	}
+
+	runs, err = GetRunnerHistory(db, 1, "Runner", true)
+	if err != nil {
+		t.Fatalf("GetRunnerHistory failed: %v", err)
+	}
+	if len(runs) != 0 {
+		t.Errorf("Expected no runs for exactly 'Runner', got %+v", runs)
+	}
+
+	// LIKE wildcards in the name only match themselves
+	for _, name := range []string{"%", "_"} {
+		runs, err = GetRunnerHistory(db, 1, name, false)
+		if err != nil {
+			t.Fatalf("GetRunnerHistory failed: %v", err)
+		}
+		if len(runs) != 0 {
+			t.Errorf("Expected no runs matching %q, got %+v", name, runs)
+		}
+	}
+}
+
+func TestGetRunnerSummary(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	summary, err := GetRunnerSummary(db, 1, "Runner A", false)
+	if err != nil {
+		t.Fatalf("GetRunnerSummary failed: %v", err)
+	}
+	want := RunnerSummary{
+		Name:           "Runner A",
+		TotalRuns:      2,
+		BestSeconds:    1180,
+		BestDate:       parseDate(t, "2023-01-08"),
+		AverageSeconds: 1190,
+		BestAgeGrade:   66.0,
+		CurrentStreak:  2,
+		LongestStreak:  2,
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("GetRunnerSummary() = %+v, want %+v", summary, want)
+	}
+
+	// Runner B missed the latest event, but only by a week
+	summary, err = GetRunnerSummary(db, 1, "Runner B", false)
+	if err != nil {
+		t.Fatalf("GetRunnerSummary failed: %v", err)
+	}
+	if summary.TotalRuns != 1 || summary.CurrentStreak != 1 || summary.LongestStreak != 1 {
+		t.Errorf("Expected 1 run and a streak of 1, got %+v", summary)
+	}
+
+	// Runner A and Runner B together aren't on anyone's streak
+	summary, err = GetRunnerSummary(db, 1, "Runner", false)
+	if err != nil {
+		t.Fatalf("GetRunnerSummary failed: %v", err)
+	}
+	if summary.CurrentStreak != 0 || summary.LongestStreak != 0 {
+		t.Errorf("Expected no streaks for several runners, got %+v", summary)
+	}
+
+	summary, err = GetRunnerSummary(db, 1, "Nobody", false)
+	if err != nil {
+		t.Fatalf("GetRunnerSummary failed: %v", err)
+	}
+	if summary.TotalRuns != 0 {
+		t.Errorf("Expected no runs, got %+v", summary)
+	}
+}
+
+func TestGetRunnerStreaks(t *testing.T) {
+	tests := []struct {
+		name  string
+		dates []string
+		// latestEvent is a later event at the location the runner missed, if any
+		latestEvent string
+		current     int
+		longest     int
+	}{
+		{"no runs", nil, "2024-01-06", 0, 0},
+		{"single event", []string{"2024-01-06"}, "", 1, 1},
+		{"all consecutive", []string{"2024-01-06", "2024-01-13", "2024-01-20", "2024-01-27"}, "", 4, 4},
+		{"extra event in the same week", []string{"2023-12-23", "2023-12-25", "2024-01-01", "2024-01-06"}, "", 4, 4},
+		{"alternating gaps", []string{"2023-12-16", "2023-12-23", "2024-01-06", "2024-01-13", "2024-01-27"}, "", 1, 2},
+		{"missed a week since", []string{"2023-12-30", "2024-01-06"}, "2024-01-20", 0, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, cleanup := setupTestDB(t)
+			defer cleanup()
+
+			_, err := db.Exec(`INSERT INTO locations (id, slug, country) VALUES (1, 'test-park', 'AUS')`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.latestEvent != "" {
+				_, err := db.Exec(`INSERT INTO events (location_id, event_number, date, url) VALUES (1, 100, ?, '')`, tt.latestEvent)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i, date := range tt.dates {
+				res, err := db.Exec(`INSERT INTO events (location_id, event_number, date, url) VALUES (1, ?, ?, '')`, i+1, date)
+				if err != nil {
+					t.Fatal(err)
+				}
+				eventID, err := res.LastInsertId()
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = db.Exec(`INSERT INTO results (event_id, position, name, time_seconds) VALUES (?, 1, 'Runner A', 1200)`, eventID)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			current, longest, err := GetRunnerStreaks(db, 1, "Runner A")
+			if err != nil {
+				t.Fatalf("GetRunnerStreaks failed: %v", err)
+			}
+			if current != tt.current || longest != tt.longest {
+				t.Errorf("GetRunnerStreaks() = %d, %d, want %d, %d", current, longest, tt.current, tt.longest)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// ANSI escape codes used to style terminal output
+const (
+	ansiBold  = "\x1b[1m"
+	ansiCyan  = "\x1b[36m"
+	ansiGreen = "\x1b[32m"
+	ansiReset = "\x1b[0m"
+)
+
+// colorOutput turns on coloured report output. main sets it with shouldColor.
+var colorOutput bool
+
+// shouldColor reports whether output to w can be coloured: w has to be a
+// terminal, and colour can't be turned off with --no-color or NO_COLOR
+func shouldColor(w io.Writer, noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// styled wraps s in an ANSI style when colour is on
+func styled(style, s string) string {
+	if !colorOutput {
+		return s
+	}
+	return style + s + ansiReset
+}
+
+// heading formats a report heading like "=== Title ==="
+func heading(format string, args ...interface{}) string {
+	return styled(ansiBold+ansiCyan, "=== "+fmt.Sprintf(format, args...)+" ===")
+}
+
+// highlight marks something worth noticing, like a new PB
+func highlight(s string) string {
+	return styled(ansiBold+ansiGreen, s)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShouldColor(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "report.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tests := []struct {
+		name    string
+		w       io.Writer
+		noColor bool
+		envVar  string
+	}{
+		{"Buffer", &bytes.Buffer{}, false, ""},
+		{"Regular file", file, false, ""},
+		{"No color flag", os.Stdout, true, ""},
+		{"NO_COLOR set", os.Stdout, false, "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.envVar)
+			if shouldColor(tt.w, tt.noColor) {
+				t.Errorf("Expected no colour for %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestReportsPlainWhenNotTTY(t *testing.T) {
+	var out bytes.Buffer
+	oldColor := colorOutput
+	defer func() { colorOutput = oldColor }()
+
+	colorOutput = shouldColor(&out, false)
+	printScrapeResult(&out, "test-park", ScrapeResult{EventsStored: 2, StopReason: StopEndOfEvents})
+	out.WriteString(highlight(newPBNote))
+	if strings.Contains(out.String(), "\x1b[") {
+		t.Errorf("Expected no escape codes, got %q", out.String())
+	}
+	if !strings.Contains(out.String(), "=== Scrape Result for test-park ===") {
+		t.Errorf("Expected a plain heading, got %q", out.String())
+	}
+
+	// With colour on, the same heading is styled
+	colorOutput = true
+	if got := heading("Scrape Result for %s", "test-park"); !strings.HasPrefix(got, "\x1b[") {
+		t.Errorf("Expected a styled heading, got %q", got)
+	}
+}
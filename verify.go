@@ -0,0 +1,306 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Duplicate represents an athlete listed more than once in a single event
+type Duplicate struct {
+	EventNumber int
+	AthleteID   int
+	Name        string
+	Count       int
+	Positions   string
+}
+
+// DateDuplicate is a date with more than one event at a location, which can
+// happen when parkrun renumbers a location's events and they are scraped again
+type DateDuplicate struct {
+	Date         time.Time
+	Count        int
+	EventNumbers string
+}
+
+// GetDuplicateRunnersPerEvent returns athletes that appear more than once in
+// the same event at a location
+func GetDuplicateRunnersPerEvent(db *sql.DB, locationID int) ([]Duplicate, error) {
+	query := `
+		SELECT 
+			e.event_number,
+			r.athlete_id,
+			MIN(r.name),
+			COUNT(*) as appearances,
+			GROUP_CONCAT(r.position, ', ')
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND r.athlete_id IS NOT NULL
+		GROUP BY e.id, r.athlete_id
+		HAVING appearances > 1
+		ORDER BY e.event_number, r.athlete_id`
+
+	rows, err := db.Query(query, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var duplicates []Duplicate
+	for rows.Next() {
+		var d Duplicate
+		if err := rows.Scan(&d.EventNumber, &d.AthleteID, &d.Name, &d.Count, &d.Positions); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		duplicates = append(duplicates, d)
+	}
+
+	return duplicates, nil
+}
+
+// GetDuplicateDatesPerLocation returns dates that have more than one event at
+// a location. The schema only keeps event numbers unique, so renumbered events
+// stored twice aren't caught by it.
+func GetDuplicateDatesPerLocation(db *sql.DB, locationID int) ([]DateDuplicate, error) {
+	query := `
+		SELECT 
+			e.date,
+			COUNT(*) as events,
+			GROUP_CONCAT(e.event_number, ', ')
+		FROM events e
+		WHERE e.location_id = ?
+		GROUP BY e.date
+		HAVING events > 1
+		ORDER BY e.date`
+
+	rows, err := db.Query(query, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	var duplicates []DateDuplicate
+	for rows.Next() {
+		var d DateDuplicate
+		if err := rows.Scan(&d.Date, &d.Count, &d.EventNumbers); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		duplicates = append(duplicates, d)
+	}
+
+	return duplicates, nil
+}
+
+// PrintVerifyReport checks a location's stored data for problems and prints any found
+func PrintVerifyReport(db *sql.DB, locationSlug string) error {
+	locationID, err := getLocationID(db, locationSlug)
+	if err != nil {
+		return err
+	}
+
+	meta, err := reportMeta(db, locationID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n", heading("Verifying %s", locationSlug))
+	printReportMeta(locationSlug, meta)
+
+	duplicates, err := GetDuplicateRunnersPerEvent(db, locationID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n--- Runners listed twice in one event ---\n")
+	if len(duplicates) == 0 {
+		fmt.Printf("None found\n")
+	}
+	for _, d := range duplicates {
+		fmt.Printf("Event %d: %s (athlete %d) listed %d times at positions %s\n",
+			d.EventNumber, d.Name, d.AthleteID, d.Count, d.Positions)
+	}
+
+	dateDuplicates, err := GetDuplicateDatesPerLocation(db, locationID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n--- Events sharing a date (possible renumbering) ---\n")
+	if len(dateDuplicates) == 0 {
+		fmt.Printf("None found\n")
+	}
+	for _, d := range dateDuplicates {
+		fmt.Printf("%s: %d events, numbered %s\n", d.Date.Format("2006-01-02"), d.Count, d.EventNumbers)
+	}
+
+	anomalies, err := GetAnomalousEvents(db, locationID)
+	if err != nil {
+		return err
+	}
+	printAnomalousEvents(anomalies)
+
+	discontinued, lastSeen, err := IsLikelyDiscontinued(db, locationID, discontinuedWeeks)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n--- Location likely discontinued (no event for %d weeks) ---\n", discontinuedWeeks)
+	switch {
+	case lastSeen.IsZero():
+		fmt.Printf("No events stored\n")
+	case discontinued:
+		fmt.Printf("Yes, the last event was on %s\n", lastSeen.Format("2006-01-02"))
+	default:
+		fmt.Printf("No\n")
+	}
+
+	return nil
+}
+
+// discontinuedWeeks is how many weeks a location can go without an event
+// before it's flagged as likely discontinued
+const discontinuedWeeks = 8
+
+// IsLikelyDiscontinued reports whether a location's latest stored event is
+// more than thresholdWeeks old, along with that event's date. A location with
+// no events isn't flagged and has a zero date.
+func IsLikelyDiscontinued(db *sql.DB, locationID int, thresholdWeeks int) (bool, time.Time, error) {
+	var latestDateStr sql.NullString
+	err := db.QueryRow(`SELECT MAX(date) FROM events WHERE location_id = ?`, locationID).Scan(&latestDateStr)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("error getting latest event date: %v", err)
+	}
+	if !latestDateStr.Valid {
+		return false, time.Time{}, nil
+	}
+	lastSeen, err := parseDateTime(latestDateStr.String)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	return isOlderThanWeeks(lastSeen, thresholdWeeks), lastSeen, nil
+}
+
+// isOlderThanWeeks reports whether date is more than weeks in the past
+func isOlderThanWeeks(date time.Time, weeks int) bool {
+	return clock.Now().Sub(date) > time.Duration(weeks)*7*24*time.Hour
+}
+
+// anomalyThreshold is how many standard deviations from a location's mean an
+// event's value has to be to count as anomalous
+const anomalyThreshold = 2.0
+
+// Anomaly is an event whose field size or median time is far from the
+// location's norm
+type Anomaly struct {
+	EventNumber int
+	Date        time.Time
+	Metric      string
+	Value       float64
+	Mean        float64
+	ZScore      float64
+}
+
+// GetAnomalousEvents flags events whose field size or median time is more than
+// anomalyThreshold standard deviations from the location's mean. These are
+// usually parse problems or special events worth excluding.
+func GetAnomalousEvents(db *sql.DB, locationID int) ([]Anomaly, error) {
+	series, err := GetAttendanceSeries(db, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT e.event_number, r.time_seconds
+		FROM results r
+		JOIN events e ON r.event_id = e.id
+		WHERE e.location_id = ?
+		AND e.excluded = 0
+		AND r.time_seconds > 0`
+
+	rows, err := db.Query(query, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	times := make(map[int][]int)
+	for rows.Next() {
+		var eventNumber, seconds int
+		if err := rows.Scan(&eventNumber, &seconds); err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		times[eventNumber] = append(times[eventNumber], seconds)
+	}
+
+	var participants, medians []float64
+	var timedEvents []EventAttendance
+	for _, event := range series {
+		participants = append(participants, float64(event.Participants))
+		if len(times[event.EventNumber]) > 0 {
+			medians = append(medians, float64(medianSeconds(times[event.EventNumber])))
+			timedEvents = append(timedEvents, event)
+		}
+	}
+
+	anomalies := findAnomalies(series, "participants", participants)
+	anomalies = append(anomalies, findAnomalies(timedEvents, "median time", medians)...)
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return anomalies[i].EventNumber < anomalies[j].EventNumber
+	})
+
+	return anomalies, nil
+}
+
+// findAnomalies returns the events whose value's z-score exceeds anomalyThreshold
+func findAnomalies(events []EventAttendance, metric string, values []float64) []Anomaly {
+	if len(values) == 0 {
+		return nil
+	}
+
+	var mean float64
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(values)))
+	if stddev == 0 {
+		return nil
+	}
+
+	var anomalies []Anomaly
+	for i, v := range values {
+		z := (v - mean) / stddev
+		if math.Abs(z) > anomalyThreshold {
+			anomalies = append(anomalies, Anomaly{
+				EventNumber: events[i].EventNumber,
+				Date:        events[i].Date,
+				Metric:      metric,
+				Value:       v,
+				Mean:        mean,
+				ZScore:      z,
+			})
+		}
+	}
+	return anomalies
+}
+
+// printAnomalousEvents prints events whose numbers are far from the location's norm
+func printAnomalousEvents(anomalies []Anomaly) {
+	fmt.Printf("\n--- Unusual events ---\n")
+	if len(anomalies) == 0 {
+		fmt.Printf("None found\n")
+	}
+	for _, a := range anomalies {
+		value, mean := fmt.Sprintf("%.0f", a.Value), fmt.Sprintf("%.0f", a.Mean)
+		if a.Metric == "median time" {
+			value, mean = secondsToTime(int(a.Value)), secondsToTime(int(a.Mean))
+		}
+		fmt.Printf("Event %d (%s): %s %s vs usual %s (%+.1f SD)\n",
+			a.EventNumber, a.Date.Format("2006-01-02"), a.Metric, value, mean, a.ZScore)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGetDuplicateRunnersPerEvent(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Runner A is listed twice in event 2, and once in event 1 which is fine
+	_, err := db.Exec(`
+		UPDATE results SET athlete_id = 1001 WHERE name = 'Runner A';
+		UPDATE results SET athlete_id = 1002 WHERE name = 'Runner B';
+		INSERT INTO results (position, name, time_seconds, event_id, athlete_id) VALUES 
+		(5, 'Runner A', 1210, 2, 1001);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicates, err := GetDuplicateRunnersPerEvent(db, 1)
+	if err != nil {
+		t.Fatalf("GetDuplicateRunnersPerEvent failed: %v", err)
+	}
+
+	if len(duplicates) != 1 {
+		t.Fatalf("Expected 1 duplicate, got %d: %+v", len(duplicates), duplicates)
+	}
+	want := Duplicate{EventNumber: 2, AthleteID: 1001, Name: "Runner A", Count: 2, Positions: "3, 5"}
+	if duplicates[0] != want {
+		t.Errorf("GetDuplicateRunnersPerEvent() = %+v, want %+v", duplicates[0], want)
+	}
+}
+
+func TestGetAnomalousEvents(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if _, err := db.Exec(`INSERT INTO locations (id, slug, country) VALUES (1, 'test-park', 'AUS')`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ten events of 10 runners, except event 7 which has 50
+	for event := 1; event <= 10; event++ {
+		date := parseDate(t, "2023-01-07").AddDate(0, 0, 7*(event-1))
+		if _, err := db.Exec(`INSERT INTO events (id, event_number, location_id, date, url) VALUES (?, ?, 1, ?, '')`,
+			event, event, date); err != nil {
+			t.Fatal(err)
+		}
+		runners := 10
+		if event == 7 {
+			runners = 50
+		}
+		for position := 1; position <= runners; position++ {
+			if _, err := db.Exec(`INSERT INTO results (position, name, time_seconds, event_id) VALUES (?, ?, 1500, ?)`,
+				position, fmt.Sprintf("Runner %d", position), event); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	anomalies, err := GetAnomalousEvents(db, 1)
+	if err != nil {
+		t.Fatalf("GetAnomalousEvents failed: %v", err)
+	}
+
+	// Median times are all equal, so only the field size stands out
+	if len(anomalies) != 1 {
+		t.Fatalf("Expected 1 anomaly, got %d: %+v", len(anomalies), anomalies)
+	}
+	a := anomalies[0]
+	if a.EventNumber != 7 || a.Metric != "participants" || a.Value != 50 || a.Mean != 14 {
+		t.Errorf("Unexpected anomaly %+v", a)
+	}
+	if a.ZScore < 2.9 || a.ZScore > 3.1 {
+		t.Errorf("ZScore = %.2f, want 3.0", a.ZScore)
+	}
+
+	// Excluding the event removes it from the norm as well as the results
+	if _, err := db.Exec(`UPDATE events SET excluded = 1 WHERE id = 7`); err != nil {
+		t.Fatal(err)
+	}
+	anomalies, err = GetAnomalousEvents(db, 1)
+	if err != nil {
+		t.Fatalf("GetAnomalousEvents failed: %v", err)
+	}
+	if len(anomalies) != 0 {
+		t.Errorf("Expected no anomalies once excluded, got %+v", anomalies)
+	}
+}
+
+func TestGetDuplicateDatesPerLocation(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	// Event 2 stored again as event 12 after a renumbering. Park 2's event on
+	// the same date as park 1's first is fine.
+	_, err := db.Exec(`
+		INSERT INTO events (id, event_number, location_id, date, url) VALUES 
+		(4, 12, 1, '2023-01-08', 'http://example.com/12')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicates, err := GetDuplicateDatesPerLocation(db, 1)
+	if err != nil {
+		t.Fatalf("GetDuplicateDatesPerLocation failed: %v", err)
+	}
+
+	if len(duplicates) != 1 {
+		t.Fatalf("Expected 1 duplicate date, got %d: %+v", len(duplicates), duplicates)
+	}
+	d := duplicates[0]
+	if !d.Date.Equal(parseDate(t, "2023-01-08")) || d.Count != 2 || d.EventNumbers != "2, 12" {
+		t.Errorf("Unexpected duplicate %+v", d)
+	}
+
+	duplicates, err = GetDuplicateDatesPerLocation(db, 2)
+	if err != nil {
+		t.Fatalf("GetDuplicateDatesPerLocation failed: %v", err)
+	}
+	if len(duplicates) != 0 {
+		t.Errorf("Expected no duplicates at park 2, got %+v", duplicates)
+	}
+}
+
+func TestIsLikelyDiscontinued(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	defer func(original Clock) { clock = original }(clock)
+	clock = fixedClock(parseDate(t, "2024-06-01"))
+
+	// The stale park's last event was 10 weeks ago and the current park's last week
+	_, err := db.Exec(`
+		INSERT INTO locations (id, slug, country) VALUES 
+		(1, 'stale-park', 'AUS'),
+		(2, 'current-park', 'AUS'),
+		(3, 'empty-park', 'AUS');
+		INSERT INTO events (event_number, location_id, date, url) VALUES 
+		(1, 1, '2024-03-16', ''),
+		(2, 1, '2024-03-23', ''),
+		(1, 2, '2024-05-25', '');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		locationID   int
+		discontinued bool
+		lastSeen     time.Time
+	}{
+		{"stale", 1, true, parseDate(t, "2024-03-23")},
+		{"current", 2, false, parseDate(t, "2024-05-25")},
+		{"no events", 3, false, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		discontinued, lastSeen, err := IsLikelyDiscontinued(db, tt.locationID, 8)
+		if err != nil {
+			t.Fatalf("%s: IsLikelyDiscontinued failed: %v", tt.name, err)
+		}
+		if discontinued != tt.discontinued {
+			t.Errorf("%s: discontinued = %v, want %v", tt.name, discontinued, tt.discontinued)
+		}
+		if !lastSeen.Equal(tt.lastSeen) {
+			t.Errorf("%s: last seen = %v, want %v", tt.name, lastSeen, tt.lastSeen)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// requestLimiter spaces requests shared between workers so the site sees no
+// more than one every interval, however many workers are running
+type requestLimiter struct {
+	mu          sync.Mutex
+	interval    time.Duration
+	next        time.Time
+	pausedUntil time.Time
+}
+
+// Wait blocks until the caller may make a request. A pause started while
+// waiting holds the caller until it ends.
+func (l *requestLimiter) Wait() {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		slot := now
+		if l.next.After(slot) {
+			slot = l.next
+		}
+		if l.pausedUntil.After(slot) {
+			slot = l.pausedUntil
+		}
+		l.next = slot.Add(l.interval)
+		l.mu.Unlock()
+
+		time.Sleep(slot.Sub(now))
+
+		l.mu.Lock()
+		paused := l.pausedUntil.After(time.Now())
+		l.mu.Unlock()
+		if !paused {
+			return
+		}
+	}
+}
+
+// Pause holds every worker's next request until d from now, e.g. while rate limited
+func (l *requestLimiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// fetchedEvent is one worker's attempt at an event
+type fetchedEvent struct {
+	eventID    int
+	event      Event
+	results    []Result
+	parseStats ParseStats
+	err        error
+	// failures counts attempts that errored before the last one
+	failures int
+}
+
+// scrapeEventsConcurrently is scrapeEvents with several workers fetching at
+// once, sharing one request limiter so the site isn't hit any harder. Events
+// are handed to handle in order from this goroutine, so the stored events
+// never have gaps and GetNextEventNumber is a safe resume point if the
+// process is killed.
+func scrapeEventsConcurrently(config LocationConfig, urlSlug string, startEvent, step, workers int, handle func(Event, []Result) (int, error)) ScrapeResult {
+	limiter := &requestLimiter{interval: waitBetweenRequests}
+	locale := localeFor(config.Country)
+
+	jobs := make(chan int)
+	fetched := make(chan fetchedEvent)
+	done := make(chan struct{})
+	// Workers don't get too far ahead of the event being stored
+	window := make(chan struct{}, workers*2)
+
+	go func() {
+		defer close(jobs)
+		for eventID := startEvent; eventID >= 1; eventID += step {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- eventID:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for eventID := range jobs {
+				result := fetchEventForWorker(limiter, config.BaseURL, locale, urlSlug, eventID)
+				select {
+				case fetched <- result:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(fetched)
+	}()
+
+	var scrapeResult ScrapeResult
+	pending := make(map[int]fetchedEvent)
+	eventID := startEvent
+	stopped := false
+	for f := range fetched {
+		if stopped {
+			continue
+		}
+		pending[f.eventID] = f
+		for !stopped {
+			next, ok := pending[eventID]
+			if !ok {
+				break
+			}
+			delete(pending, eventID)
+			<-window
+			stopped = !storeFetchedEvent(&scrapeResult, next, handle)
+			eventID += step
+		}
+		if !stopped && eventID < 1 {
+			log.Printf("Reached the first event. Scraping complete.")
+			scrapeResult.StopReason = StopEndOfEvents
+			stopped = true
+		}
+		if stopped {
+			// Let the workers finish up, dropping anything fetched past the end
+			close(done)
+		}
+	}
+
+	log.Printf("Scraping complete. Processed up to event %d", eventID-step)
+	return scrapeResult
+}
+
+// fetchEventForWorker fetches an event, retrying errors until maxFailures
+// of them in a row. Being rate limited pauses every worker.
+func fetchEventForWorker(limiter *requestLimiter, baseURL string, locale Locale, urlSlug string, eventID int) fetchedEvent {
+	result := fetchedEvent{eventID: eventID}
+	for {
+		limiter.Wait()
+		result.event, result.results, result.parseStats, result.err = parseResultsFrom(baseURL, locale, urlSlug, eventID)
+		if backoff, limited := rateLimitWait(result.err); limited {
+			log.Printf("Rate limited, pausing all workers for %d seconds...", backoff/time.Second)
+			limiter.Pause(backoff)
+			continue
+		}
+		if result.err == nil || errors.Is(result.err, ErrResultsPending) || errors.Is(result.err, ErrNoResults) || isEndOfEvents(result.err) {
+			return result
+		}
+		log.Printf("Error processing event %d: %v", eventID, result.err)
+		if result.failures+1 >= maxFailures(result.err) {
+			return result
+		}
+		result.failures++
+		if isTransient(result.err) {
+			time.Sleep(retryWait(result.err, result.failures))
+		}
+	}
+}
+
+// isEndOfEvents reports whether err is parkrun saying there's no such event yet
+func isEndOfEvents(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == 425
+}
+
+// storeFetchedEvent counts a worker's fetch and stores the event like
+// scrapeEvents does, returning false once the scrape should stop
+func storeFetchedEvent(scrapeResult *ScrapeResult, f fetchedEvent, handle func(Event, []Result) (int, error)) bool {
+	scrapeResult.Errors += f.failures
+	switch {
+	case errors.Is(f.err, ErrResultsPending):
+		log.Printf("Results for event %d are not published yet. Run again later to pick them up.", f.eventID)
+		scrapeResult.StopReason = StopPending
+		return false
+	case errors.Is(f.err, ErrNoResults):
+		logNoResults(f.eventID, f.event)
+		scrapeResult.EventsSkipped++
+		return true
+	case isEndOfEvents(f.err):
+		log.Printf("Reached end of events (425 error). Scraping complete.")
+		scrapeResult.StopReason = StopEndOfEvents
+		return false
+	case f.err != nil:
+		scrapeResult.Errors++
+		log.Printf("Reached %d consecutive errors. Stopping.", f.failures+1)
+		scrapeResult.StopReason = StopTooManyErrors
+		return false
+	}
+	scrapeResult.RowsSkipped.Add(f.parseStats)
+	return storeScrapedEvent(scrapeResult, f.eventID, f.event, f.results, handle)
+}
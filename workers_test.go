@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScrapeWithWorkers(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	pages := make(map[int]string)
+	for i := 1; i <= 12; i++ {
+		date := time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC).AddDate(0, 0, 7*(i-1))
+		pages[i] = fakeResultsPage(date.Format("02/01/2006"), fakeResultRow(1, "Runner A", "18:30"))
+	}
+	serve := servePages(pages)
+
+	// Event 5 is rate limited once, which should pause every worker
+	var mu sync.Mutex
+	limited := false
+	server := newFakeParkrunServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if eventNumber, _ := fakeEventNumber(r); eventNumber == 5 && !limited {
+			limited = true
+			mu.Unlock()
+			w.WriteHeader(405)
+			return
+		}
+		mu.Unlock()
+		serve(w, r)
+	})
+	defer server.Close()
+	rateLimitBackoff = 20 * time.Millisecond
+
+	result, err := Scrape(db, "test-park", ScrapeOptions{Workers: 4})
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	if result.EventsStored != 12 || result.StopReason != StopEndOfEvents || result.Errors != 0 {
+		t.Errorf("Expected 12 events stored up to the end, got %+v", result)
+	}
+	if !limited {
+		t.Error("Expected event 5 to have been rate limited")
+	}
+
+	locationID, err := getLocationID(db, "test-park")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := GetNextEventNumber(db, locationID); next != 13 {
+		t.Errorf("Expected to resume from event 13, got %d", next)
+	}
+}
+
+func TestScrapeEventsConcurrentlyStoresInOrder(t *testing.T) {
+	pages := make(map[int]string)
+	for i := 1; i <= 20; i++ {
+		pages[i] = fakeResultsPage("06/01/2024", fakeResultRow(1, "Runner A", "18:30"))
+	}
+	server := newFakeParkrunServer(t, servePages(pages))
+	defer server.Close()
+
+	var handled []int
+	result := scrapeEventsConcurrently(getLocationConfig("test-park"), "test-park", 1, 1, 5, func(event Event, results []Result) (int, error) {
+		handled = append(handled, event.EventNumber)
+		if event.EventNumber == 15 {
+			return 0, errPastDateRange
+		}
+		return len(results), nil
+	})
+
+	if result.StopReason != StopPastDateRange || result.EventsStored != 14 {
+		t.Errorf("Expected 14 events stored before the date range ended, got %+v", result)
+	}
+	for i, eventNumber := range handled {
+		if eventNumber != i+1 {
+			t.Fatalf("Expected events to be handled in order, got %v", handled)
+		}
+	}
+}
+
+func TestRequestLimiterSpacesRequests(t *testing.T) {
+	limiter := &requestLimiter{interval: 20 * time.Millisecond}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Wait()
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected 3 requests to take at least 40ms, took %v", elapsed)
+	}
+
+	// A pause holds the next request even if its slot has come
+	limiter.Pause(50 * time.Millisecond)
+	start = time.Now()
+	limiter.Wait()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the pause to hold the request for 50ms, took %v", elapsed)
+	}
+}